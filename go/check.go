@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"weather-aggregator/weather"
+)
+
+// checkCity is probed by --check unless --city is given.
+const checkCity = "Berlin"
+
+// runCheck probes every source once for --check and prints its health.
+func runCheck(agg *weather.Aggregator, opts options) int {
+	city := checkCity
+	if strings.TrimSpace(opts.city) != "" {
+		var err error
+		if city, err = validateCityName(opts.city); err != nil {
+			printCityValidationError(err)
+			return exitUsage
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	results, err := agg.Check(ctx, city)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailure
+	}
+	return printCheck(os.Stdout, city, results, weather.ListSources(), opts)
+}
+
+// printCheck prints one line per probed source, naming the key variable on auth failures,
+// and returns exitOK if all are up, exitPartial if some are and exitFailure if none is.
+func printCheck(w io.Writer, city string, results []weather.CheckResult, infos []weather.SourceInfo, opts options) int {
+	envKeys := make(map[string]string)
+	for _, s := range infos {
+		envKeys[s.Name] = s.EnvKey
+	}
+	fmt.Fprintf(w, "Checking %d sources with %s:\n", len(results), city)
+	ok, failed := opts.decor("✅", "[OK] "), opts.decor("❌", "[ERR]")
+	up := 0
+	for _, r := range results {
+		switch {
+		case r.Health == weather.HealthUp:
+			up++
+			fmt.Fprintf(w, "  %s %s: up in %v\n", ok, r.Source, r.Latency.Round(time.Millisecond))
+		case r.Health == weather.HealthAuth && envKeys[r.Source] != "":
+			fmt.Fprintf(w, "  %s %s: %s, check %s (%v)\n", failed, r.Source, r.Health, envKeys[r.Source], r.Error)
+		default:
+			fmt.Fprintf(w, "  %s %s: %s (%v)\n", failed, r.Source, r.Health, r.Error)
+		}
+	}
+	switch up {
+	case len(results):
+		return exitOK
+	case 0:
+		return exitFailure
+	}
+	return exitPartial
+}
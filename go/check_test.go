@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"weather-aggregator/weather"
+)
+
+func TestPrintCheck(t *testing.T) {
+	results := []weather.CheckResult{
+		{Source: "Open-Meteo", Health: weather.HealthUp, Latency: 231400 * time.Microsecond},
+		{Source: "WeatherAPI.com", Health: weather.HealthAuth, Error: errors.New("HTTP 401: 401 Unauthorized")},
+		{Source: "Station", Health: weather.HealthAuth, Error: errors.New("HTTP 403: 403 Forbidden")},
+		{Source: "Meteosource", Health: weather.HealthDown, Error: errors.New("request failed: timeout")},
+	}
+	var buf bytes.Buffer
+	code := printCheck(&buf, "Berlin", results, weather.ListSources(), options{plain: true})
+	want := `Checking 4 sources with Berlin:
+  [OK]  Open-Meteo: up in 231ms
+  [ERR] WeatherAPI.com: invalid API key, check WEATHER_API_COM_KEY (HTTP 401: 401 Unauthorized)
+  [ERR] Station: invalid API key (HTTP 403: 403 Forbidden)
+  [ERR] Meteosource: unavailable (request failed: timeout)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+	if code != exitPartial {
+		t.Errorf("exit code = %d, want %d", code, exitPartial)
+	}
+	if code := printCheck(&buf, "Berlin", results[:1], nil, options{}); code != exitOK {
+		t.Errorf("all up: exit code = %d, want %d", code, exitOK)
+	}
+	if code := printCheck(&buf, "Berlin", results[1:], nil, options{}); code != exitFailure {
+		t.Errorf("all down: exit code = %d, want %d", code, exitFailure)
+	}
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, check: true, cities: "A,B"}); err == nil {
+		t.Error("--check with --cities accepted")
+	}
+	opts := options{plain: true, timeout: time.Second}
+	agg := newAggregator(opts, []weather.WeatherSource{&stubSource{name: "Stub", temp: 20}})
+	for _, city := range []string{"-Berlin", "Ber\tlin", strings.Repeat("x", 200)} {
+		opts.city = city
+		var code int
+		out := captureStdout(t, func() { code = runCheck(agg, opts) })
+		if code != exitUsage {
+			t.Errorf("runCheck(%q) = %d, want %d", city, code, exitUsage)
+		}
+		if strings.Contains(out, "Checking") {
+			t.Errorf("runCheck(%q) probed sources:\n%s", city, out)
+		}
+	}
+}
@@ -1,16 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
+	"unicode"
+	"unicode/utf8"
+	"weather-aggregator/weather"
 )
 
+// validateCityName trims city and checks it is a plausible place name.
+// Returns the trimmed name.
 func validateCityName(city string) (string, error) {
 	trimmed := strings.TrimSpace(city)
 	if trimmed == "" {
@@ -19,7 +37,13 @@ func validateCityName(city string) (string, error) {
 	if strings.HasPrefix(trimmed, "-") {
 		return "", fmt.Errorf("city name cannot start with '-'")
 	}
-	if len(trimmed) > 100 {
+	// \s in the pattern below would let newlines and tabs through, so check control bytes first
+	if strings.IndexFunc(trimmed, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("city name must not contain control characters")
+	}
+	if n := utf8.RuneCountInString(trimmed); n < 2 {
+		return "", fmt.Errorf("city name must be at least 2 characters")
+	} else if n > 100 {
 		return "", fmt.Errorf("city name must not exceed 100 characters")
 	}
 	// Allow Unicode letters, digits, spaces, any dash, apostrophes, periods, underscore
@@ -30,33 +54,521 @@ func validateCityName(city string) (string, error) {
 	return trimmed, nil
 }
 
+// validateQueryOptions checks the options a --serve request can override with its
+// query parameters, so requests don't repeat the startup checks that read files.
+func validateQueryOptions(opts options) error {
+	switch opts.units {
+	case "metric", "imperial", "standard":
+	default:
+		return fmt.Errorf("invalid units %q (allowed: metric, imperial, standard)", opts.units)
+	}
+	switch opts.aggregate {
+	case "mean", "median", "trimmed":
+	default:
+		return fmt.Errorf("invalid aggregation %q (allowed: mean, median, trimmed)", opts.aggregate)
+	}
+	if opts.aggregate == "trimmed" && !(opts.trimPct > 0 && opts.trimPct < 50) {
+		return fmt.Errorf("--trim-pct must be above 0 and below 50")
+	}
+	return nil
+}
+
+// newAggregator builds the library Aggregator from the parsed flags.
+func newAggregator(opts options, sources []weather.WeatherSource) *weather.Aggregator {
+	wopts := weather.Options{
+		Sequential:     opts.sequential,
+		SourceTimeout:  opts.sourceTimeout,
+		MaxConcurrency: opts.maxConcurrency,
+		Retries:        opts.retries,
+		Country:        opts.country,
+		Admin:          strings.TrimSpace(opts.admin),
+		UserAgent:      userAgentFor(opts),
+	}
+	// Already validated by validateOptions
+	wopts.Location, _ = parseLocation(opts.lat, opts.lon)
+	wopts.Forecast, _ = parseForecast(opts.forecast)
+	wopts.Trend, wopts.Trace = opts.trend, opts.trace
+	if opts.serve != "" {
+		wopts.Metrics = weather.NewMetrics()
+	}
+	if opts.rate > 0 {
+		wopts.RateLimiter = weather.NewRateLimiter(opts.rate)
+	}
+	// Logs go to stderr so stdout stays clean for the emoji text and JSON output
+	level, _ := parseLogLevel(opts.logLevel)
+	if opts.trace && level > slog.LevelInfo {
+		level = slog.LevelInfo // traces are logged at info level
+	}
+	wopts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	// Fixture coordinates must not end up in the real cache
+	if opts.coordCache != "" && opts.fixtures == "" {
+		wopts.CoordCache = weather.LoadCoordCache(opts.coordCache, weather.CoordCacheTTL)
+	}
+	agg := weather.NewAggregator(sources, wopts)
+	agg.Client = newHTTPClient(opts)
+	if opts.airQuality {
+		agg.AirQuality = []weather.AirQualitySource{&weather.OpenMeteoAirQualitySource{}}
+	}
+	return agg
+}
+
+// userAgentFor returns the User-Agent for outbound requests: --user-agent as given, or else
+// the tool name with the build version and the optional --contact.
+func userAgentFor(opts options) string {
+	if opts.userAgent != "" {
+		return opts.userAgent
+	}
+	return weather.UserAgent(version, opts.contact)
+}
+
+// newHTTPClient returns the client for all source and geocoding requests.
+// Its transport is a copy of http.DefaultTransport, so proxies are taken from HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY; --insecure skips TLS certificate verification (e.g. for mitmproxy).
+// opts.transport and --fixtures replace the transport entirely.
+// There is no client Timeout; requests are bounded by the --timeout context of the run.
+func newHTTPClient(opts options) *http.Client {
+	if opts.transport != nil {
+		return &http.Client{Transport: opts.transport}
+	}
+	if opts.fixtures != "" {
+		return &http.Client{Transport: weather.FixtureTransport{Dir: opts.fixtures}}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = http.ProxyFromEnvironment
+	if opts.insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: tr}
+}
+
+// readCityLines returns the validated cities of r, one per line; blank lines are skipped.
+func readCityLines(r io.Reader) ([]string, error) {
+	var cities []string
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		city, err := validateCityName(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d %q: %w", line, strings.TrimSpace(sc.Text()), err)
+		}
+		cities = append(cities, city)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read cities: %w", err)
+	}
+	if len(cities) == 0 {
+		return nil, fmt.Errorf("no city names on stdin")
+	}
+	return cities, nil
+}
+
+// parseCityList returns the validated cities from --city or --cities.
+func parseCityList(opts options) ([]string, error) {
+	if opts.cities == "" {
+		city, err := validateCityName(opts.city)
+		if err != nil {
+			return nil, err
+		}
+		return []string{city}, nil
+	}
+	if opts.city != "" {
+		return nil, fmt.Errorf("use either --city or --cities, not both")
+	}
+
+	var cities []string
+	for _, part := range strings.Split(opts.cities, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		city, err := validateCityName(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", strings.TrimSpace(part), err)
+		}
+		cities = append(cities, city)
+	}
+	if len(cities) == 0 {
+		return nil, fmt.Errorf("--cities must contain at least one city name")
+	}
+	return cities, nil
+}
+
+// locating reports whether the city comes from --auto-locate.
+func locating(opts options) bool {
+	return opts.autoLocate && opts.city == "" && opts.cities == ""
+}
+
+// warmUpTimeout bounds the --warm-up geocoding at startup.
+const warmUpTimeout = 30 * time.Second
+
+// parseWarmUpCities parses --warm-up: a comma-separated list, or @file with one city per line
+// where empty lines and lines starting with # are skipped.
+func parseWarmUpCities(spec string) ([]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	parts := strings.Split(spec, ",")
+	if path, ok := strings.CutPrefix(spec, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("--warm-up: %w", err)
+		}
+		parts = strings.Split(string(data), "\n")
+	}
+	var cities []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part == "" || strings.HasPrefix(part, "#") {
+			continue
+		}
+		city, err := validateCityName(part)
+		if err != nil {
+			return nil, fmt.Errorf("--warm-up %q: %w", part, err)
+		}
+		cities = append(cities, city)
+	}
+	if len(cities) == 0 {
+		return nil, fmt.Errorf("--warm-up must contain at least one city name")
+	}
+	return cities, nil
+}
+
+// warmUp pre-geocodes the --warm-up cities so the first requests for them are fast.
+// Failures only cost the speed-up, so they are reported as a warning.
+func warmUp(agg *weather.Aggregator, cities []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+	defer cancel()
+	start := time.Now()
+	geocoded, cached, err := agg.WarmUp(ctx, cities, batchWorkers)
+	fmt.Fprintf(os.Stderr, "Warm-up: %d cities geocoded, %d already cached in %v\n", geocoded, cached, time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: warm-up incomplete: %v\n", err)
+	}
+}
+
+// autoLocate resolves the city for --auto-locate from the public IP address and pins the
+// aggregator to the found coordinates, so the sources don't geocode the city name again
+// (and can't end up in a namesake elsewhere).
+func autoLocate(ctx context.Context, agg *weather.Aggregator) (string, error) {
+	p, err := agg.LocateIP(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "Located by IP address: %s\n", p)
+	agg.Options.Location = &[2]float64{p.Lat, p.Lon}
+	return p.Name, nil
+}
+
 // printCityValidationError prints city validation error message and usage.
 func printCityValidationError(err error) {
 	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	fmt.Println("\nUsage: weather-aggregator --city <city> [OPTIONS]")
 	fmt.Println("\nOptions:")
-	fmt.Println("  --city       City name (required)")
+	fmt.Println("  --city       City name (required unless --cities or --auto-locate is given)")
+	fmt.Println("  --cities     Comma-separated list of cities, e.g. \"Berlin,Paris,New York\"")
+	fmt.Println("  --stdin      Read one city per line from stdin (also --city -), e.g. cat cities.txt | weather-aggregator --stdin --format json")
 	fmt.Println("  --sequential Use sequential fetching (optional)")
+	fmt.Println("  --verbose    Show raw provider condition codes (optional)")
+	fmt.Println("  --stream     Print each source as soon as it answers (text output only)")
+	fmt.Println("  --air-quality  Show US AQI and PM2.5 (optional)")
+	fmt.Println("  --forecast   Next hours or days per source, e.g. 12h or 3d (optional)")
+	fmt.Println("  --trend      Show ↑/↓/→ for the next 3h where a source has hourly data (optional)")
+	fmt.Println("  --compare    Show each source's temperature deviation from the aggregate (optional)")
+	fmt.Println("  --pretty-table  Compare all sources side by side with a consensus row (text output only)")
+	fmt.Println("  --log-level  Diagnostics on stderr: debug, info, warn (default) or error")
+	fmt.Println("  --trace      Log DNS, connect, TLS and time-to-first-byte per request on stderr (optional)")
+	fmt.Println("  --serve      Run an HTTP server, e.g. :8080 (GET /weather?city=Berlin, /healthz, /metrics)")
 	fmt.Println("  --exclude    Comma-separated source names to skip (optional)")
+	fmt.Println("  --only       Comma-separated source names to use exclusively (not with --exclude)")
+	fmt.Println("  --list-sources  Show all source names and whether their API key is set, then exit")
+	fmt.Println("  --check      Probe each source once and report up/down, latency and invalid API keys, then exit")
+	fmt.Println("  --strict     Exit with code 4 and list the failures if any source fails (--strict=auth: only invalid API keys)")
+	fmt.Println("  --units      metric (°C, default), imperial (°F) or standard (K)")
+	fmt.Println("  --format     text (default) or json")
+	fmt.Println("  --pretty     Indent JSON output for reading (default: one line per city)")
+	fmt.Println("  --no-color   Plain ASCII markers instead of emoji (also NO_COLOR; automatic when piped, FORCE_COLOR keeps emoji)")
+	fmt.Println("  --aggregate  mean (default), median or trimmed")
+	fmt.Println("  --trim-pct   Percentage dropped at each end with --aggregate trimmed (default 20)")
+	fmt.Println("  --sort       Order sources by name, temp, speed or source (configured order)")
+	fmt.Println("  --timeout    Overall deadline per city, e.g. 30s (default 15s)")
+	fmt.Println("  --source-timeout  Per-source timeout, e.g. 3s (optional)")
+	fmt.Println("  --retries    Retries for transient HTTP failures (default 2)")
+	fmt.Println("  --max-concurrency  Limit simultaneous source requests (default unlimited)")
+	fmt.Println("  --rate       Max requests per second and provider, e.g. 2 or 0.5 (default unlimited)")
+	fmt.Println("  --reject-outliers  Drop temperatures more than N std deviations from the median")
+	fmt.Println("  --max-age    Exclude readings observed longer ago, e.g. 2h (optional)")
+	fmt.Println("  --coord-cache  Coordinate cache file, \"\" disables (default: user cache dir)")
+	fmt.Println("  --cache-ttl  Reuse successful responses for this long, e.g. 1m (optional)")
+	fmt.Println("  --codes-file Custom weather_codes.json (default: built-in copy)")
+	fmt.Println("  --log-runs   Append each city's per-source results as a JSON line to this file")
+	fmt.Println("  --stats      Print success rate, latency and deviation per source from a --log-runs file, then exit")
+	fmt.Println("  --diff-against-last  Show temperature changes since the city's last run in the --log-runs file")
+	fmt.Println("  --config     JSON file selecting sources, API keys, weights and timeouts")
+	fmt.Println("  --fixtures   Offline mode: answer all requests from <dir>/<host>.json, e.g. ./fixtures")
+	fmt.Println("  --insecure   Skip TLS certificate verification, e.g. behind mitmproxy (proxies: HTTP(S)_PROXY)")
+	fmt.Println("  --user-agent User-Agent for all requests (env WEATHER_USER_AGENT, default: name, version, project URL)")
+	fmt.Println("  --contact    Contact such as an email address added to the default User-Agent (env WEATHER_CONTACT)")
+	fmt.Println("  --lat, --lon Use these coordinates instead of geocoding the city name")
+	fmt.Println("  --watch      Redraw every interval until Ctrl+C, e.g. 5m (single city, min 10s)")
+	fmt.Println("  --warm-up    With --serve/--watch, geocode these cities into the coordinate cache at startup: \"Berlin,Paris\" or @cities.txt")
+	fmt.Println("  --auto-locate  Without --city, use the location of your IP address (sent to ip-api.com)")
+	fmt.Println("  --country    ISO country code to disambiguate the city, e.g. US")
+	fmt.Println("  --admin      State/region to disambiguate the city, e.g. Illinois")
 	fmt.Println("\nExamples:")
 	fmt.Println("  ./weather-aggregator --city New York")
 	fmt.Println("  ./weather-aggregator --city \"O'Brien\"    # apostrophe needs double-quotes in the shell")
 	fmt.Println("  ./weather-aggregator --city Berlin --exclude WeatherAPI.com")
+	fmt.Println("  ./weather-aggregator --city Berlin --only Open-Meteo")
+	fmt.Println("  ./weather-aggregator --city New York --units imperial")
+	fmt.Println("  ./weather-aggregator --city Springfield --lat 39.8 --lon -89.65")
+	fmt.Println("  ./weather-aggregator --city Springfield --country US --admin Missouri --verbose")
+	fmt.Println("  ./weather-aggregator --serve localhost:8080")
 	fmt.Println("\nAPI keys are loaded from .env file.")
 }
 
-// parseFlags parses command-line flags and returns parsed city, exclude, and sequential values.
-func parseFlags() (city, exclude string, sequential bool) {
-	cityFlag := flag.String("city", "", "City name (required, spaces allowed)")
+// options holds the parsed command-line flags.
+type options struct {
+	city       string
+	cities     string
+	exclude    string
+	only       string
+	sequential bool
+	verbose    bool
+	units      string
+	format     string
+	// pretty indents the JSON output; compact single-line documents are the default
+	pretty    bool
+	aggregate string
+	// trimPct is the share of readings --aggregate trimmed drops at each end, in percent
+	trimPct float64
+	// timeout is the overall deadline per city (and per server request)
+	timeout time.Duration
+	// sourceTimeout limits each individual source; 0 means only the overall deadline applies
+	sourceTimeout time.Duration
+	retries       int
+	// maxConcurrency caps in-flight source fetches; 0 means unlimited
+	maxConcurrency int
+	// rate limits requests per second and provider host; 0 means unlimited
+	rate float64
+	// rejectOutliers is the outlier threshold in standard deviations; 0 disables rejection
+	rejectOutliers float64
+	// maxAge excludes readings observed longer ago from aggregation; 0 keeps all
+	maxAge time.Duration
+	// coordCache is the on-disk coordinate cache file; empty disables it
+	coordCache string
+	// cacheTTL enables the in-memory response cache when positive
+	cacheTTL time.Duration
+	// codesFile overrides the embedded weather_codes.json
+	codesFile string
+	// logRuns is a JSONL file that gets one line per city and run; empty disables it
+	logRuns string
+	// stats is a --log-runs file to summarize instead of fetching weather
+	stats string
+	// diffLast compares each run with the last one of the same city in the logRuns file
+	diffLast bool
+	// config is a JSON file selecting the sources; empty uses the API keys from the environment
+	config string
+	// lat and lon are raw flag values; when both are set geocoding is skipped
+	lat, lon string
+	// stdin reads one city per line from standard input (--stdin or --city -)
+	stdin bool
+	// watch re-runs the fetch for a single city at this interval; 0 runs once
+	watch time.Duration
+	// warmUp lists cities geocoded into the coordinate cache at startup of --serve/--watch:
+	// comma-separated, or @file with one city per line
+	warmUp string
+	// autoLocate finds the city by IP address when neither --city nor --cities is given
+	autoLocate bool
+	// country and admin disambiguate geocoding matches
+	country, admin string
+	// stream prints each source as soon as it answers (text output, single city)
+	stream bool
+	// serve is the listen address for HTTP server mode; empty runs the CLI
+	serve string
+	// logLevel is the minimum slog level written to stderr
+	logLevel string
+	// trace logs HTTP phase timings per request (at info level) and reports TTFB per source
+	trace bool
+	// forecast is the raw --forecast value, e.g. "12h" or "3d"; empty fetches current conditions only
+	forecast string
+	// airQuality adds the Open-Meteo air quality source
+	airQuality bool
+	// trend asks hourly-capable sources for a short forecast to show a temperature trend
+	trend bool
+	// compare prints each source's temperature delta from the aggregated temperature
+	compare bool
+	// prettyTable replaces the source table and aggregate with a side-by-side comparison
+	prettyTable bool
+	// sort orders the displayed sources: name, temp, speed or source; empty keeps arrival order
+	sort string
+	// sourceOrder is the configured source order used by --sort source
+	sourceOrder []string
+	// excluded are the available sources dropped by --only/--exclude, for the JSON metadata
+	excluded []string
+	// insecure disables TLS certificate verification
+	insecure bool
+	// userAgent replaces the User-Agent of all requests; empty sends the default with the
+	// version and contact, see userAgentFor
+	userAgent, contact string
+	// plain replaces emoji with ASCII markers in text output; see plainOutput
+	plain bool
+	// listSources prints the known sources and exits
+	listSources bool
+	// check probes each source once and reports up/down instead of the weather
+	check bool
+	// strict fails the run with exitStrict when sources fail: "all", "auth" or "" (off)
+	strict strictMode
+	// fixtures is a directory of canned API responses that replaces the network; empty = online
+	fixtures string
+	// transport replaces the HTTP transport built by newHTTPClient; only set by tests
+	transport http.RoundTripper
+}
+
+// parseFlags parses command-line flags into options.
+func parseFlags() options {
+	cityFlag := flag.String("city", "", "City name (required, spaces allowed; - reads cities from stdin)")
+	stdinFlag := flag.Bool("stdin", false, "Read one city per line from standard input, like --cities")
+	citiesFlag := flag.String("cities", "", "Comma-separated list of cities to fetch in one run")
+	verboseFlag := flag.Bool("verbose", false, "Show raw provider condition codes/text next to the normalized condition")
+	airQualityFlag := flag.Bool("air-quality", false, "Also fetch US AQI and PM2.5 from Open-Meteo")
+	forecastFlag := flag.String("forecast", "", "Also fetch a forecast: next N hours (e.g. 12h, max 48h) or days (e.g. 3d, max 7d)")
+	trendFlag := flag.Bool("trend", false, "Show the temperature trend over the next 3 hours (extra hourly data, Open-Meteo only)")
+	compareFlag := flag.Bool("compare", false, "Show each source's temperature deviation from the aggregate and flag outliers")
+	prettyTableFlag := flag.Bool("pretty-table", false, "Show all sources side by side (temperature, humidity, condition, feels like, wind, duration) with a consensus row")
+	logLevelFlag := flag.String("log-level", "warn", "Diagnostics written to stderr: debug, info, warn or error")
+	traceFlag := flag.Bool("trace", false, "Log DNS/connect/TLS/time-to-first-byte of every request to stderr")
+	serveFlag := flag.String("serve", "", "Run as HTTP server on this address (e.g. :8080) instead of fetching once")
+	streamFlag := flag.Bool("stream", false, "Print each source's result as soon as it arrives")
 	seqFlag := flag.Bool("sequential", false, "Use sequential fetching for performance comparison")
-	excludeFlag := flag.String("exclude", "", "Comma-separated source names to exclude (e.g., 'wttr.in,WeatherAPI.com')")
+	excludeFlag := flag.String("exclude", "", "Comma-separated source names to exclude (e.g., 'Meteosource,WeatherAPI.com')")
+	listSourcesFlag := flag.Bool("list-sources", false, "List all sources with their API key status and exit")
+	checkFlag := flag.Bool("check", false, "Probe each source once (with --city or "+checkCity+") and report up/down and latency")
+	var strict strictMode
+	flag.Var(&strict, "strict", "Exit with code 4 if any source fails; --strict=auth only for rejected API keys")
+	onlyFlag := flag.String("only", "", "Comma-separated source names to use exclusively (e.g., 'Open-Meteo')")
+	unitsFlag := flag.String("units", "metric", "Temperature units: metric (°C), imperial (°F) or standard (K)")
+	formatFlag := flag.String("format", "text", "Output format: text or json")
+	prettyFlag := flag.Bool("pretty", false, "Indent JSON output with two spaces instead of one line per document")
+	noColorFlag := flag.Bool("no-color", false, "Plain ASCII output without emoji (default when stdout is not a terminal)")
+	aggregateFlag := flag.String("aggregate", "mean", "Aggregation of temperature/humidity: mean, median or trimmed")
+	trimPctFlag := flag.Float64("trim-pct", weather.DefaultTrimPct, "Percentage of highest and lowest readings --aggregate trimmed drops (above 0 and below 50)")
+	sortFlag := flag.String("sort", "", "Sort sources by name, temp, speed (fastest first) or source (configured order)")
+	maxAgeFlag := flag.Duration("max-age", 0, "Exclude readings observed longer ago than this from aggregation, e.g. 2h (0 = off)")
+	outlierFlag := flag.Float64("reject-outliers", 0, "Reject temperatures more than N standard deviations from the median (0 = off, e.g. 3)")
+	coordCacheFlag := flag.String("coord-cache", weather.DefaultCoordCachePath(), "Coordinate cache file (empty to disable)")
+	cacheTTLFlag := flag.Duration("cache-ttl", 0, "Reuse successful source responses for this long (e.g. 1m); 0 disables")
+	maxConcFlag := flag.Int("max-concurrency", 0, "Maximum number of simultaneous source requests (0 = unlimited)")
+	rateFlag := flag.Float64("rate", 0, "Maximum requests per second to each provider, with jitter (0 = unlimited)")
+	codesFileFlag := flag.String("codes-file", "", "Path to a weather_codes.json overriding the embedded copy")
+	logRunsFlag := flag.String("log-runs", "", "Append each city's per-source results as JSON lines to this file")
+	statsFlag := flag.String("stats", "", "Print a per-source reliability scoreboard from a --log-runs file and exit")
+	diffLastFlag := flag.Bool("diff-against-last", false, "Show each source's and the consensus temperature change since the last run of the city in the --log-runs file")
+	fixturesFlag := flag.String("fixtures", "", "Directory with canned responses named <host>.json; no network requests are made")
+	insecureFlag := flag.Bool("insecure", false, "Skip TLS certificate verification (for testing through an intercepting proxy)")
+	userAgentFlag := flag.String("user-agent", os.Getenv("WEATHER_USER_AGENT"), "User-Agent sent to providers (default: tool name, version and project URL; env WEATHER_USER_AGENT)")
+	contactFlag := flag.String("contact", os.Getenv("WEATHER_CONTACT"), "Contact, e.g. an email address, added to the default User-Agent (env WEATHER_CONTACT)")
+	configFlag := flag.String("config", "", "JSON file declaring the sources to use, their API keys, weights and timeouts")
+	retriesFlag := flag.Int("retries", 2, "Retries per request for network errors, 429 and 5xx responses")
+	latFlag := flag.String("lat", "", "Latitude (-90..90); together with --lon skips geocoding")
+	lonFlag := flag.String("lon", "", "Longitude (-180..180); together with --lat skips geocoding")
+	watchFlag := flag.Duration("watch", 0, "Refresh the results at this interval (e.g. 5m, min 10s) until interrupted")
+	warmUpFlag := flag.String("warm-up", "", "With --serve/--watch, pre-geocode these cities at startup: comma-separated or @file (one per line)")
+	autoLocateFlag := flag.Bool("auto-locate", false, "Without --city, use the location of your public IP address (via ip-api.com)")
+	countryFlag := flag.String("country", "", "ISO country code the geocoded city must be in (e.g. US)")
+	adminFlag := flag.String("admin", "", "State/region the geocoded city must be in (e.g. Illinois)")
+	timeoutFlag := flag.Duration("timeout", defaultRunTimeout, "Overall deadline for fetching one city (e.g. 30s)")
+	sourceTimeoutFlag := flag.Duration("source-timeout", 0, "Per-source timeout (e.g. 3s); 0 uses only the overall --timeout")
 	flag.Parse()
 
-	// Handle multi-word arguments
-	city, exclude = parseMultiWordArgs(*cityFlag, *excludeFlag, seqFlag)
-	sequential = *seqFlag
+	// Handle multi-word arguments; remaining flags are read afterwards since they may follow the city
+	city, exclude := parseMultiWordArgs(*cityFlag, *excludeFlag, seqFlag)
+	stdin := *stdinFlag
+	if city == "-" {
+		city, stdin = "", true
+	}
+
+	return options{
+		city:       city,
+		cities:     *citiesFlag,
+		stdin:      stdin,
+		exclude:    exclude,
+		only:       *onlyFlag,
+		sequential: *seqFlag,
+		verbose:    *verboseFlag,
+		units:      *unitsFlag,
+		format:     *formatFlag,
+		pretty:     *prettyFlag,
+		aggregate:  *aggregateFlag,
+		trimPct:    *trimPctFlag,
+
+		timeout:       *timeoutFlag,
+		sourceTimeout: *sourceTimeoutFlag,
+		retries:       *retriesFlag,
+
+		maxConcurrency: *maxConcFlag,
+		rate:           *rateFlag,
+
+		rejectOutliers: *outlierFlag,
+		maxAge:         *maxAgeFlag,
+		coordCache:     *coordCacheFlag,
+		cacheTTL:       *cacheTTLFlag,
+		codesFile:      *codesFileFlag,
+		logRuns:        *logRunsFlag,
+		stats:          *statsFlag,
+		diffLast:       *diffLastFlag,
+		config:         *configFlag,
+		insecure:       *insecureFlag,
+		userAgent:      strings.TrimSpace(*userAgentFlag),
+		contact:        strings.TrimSpace(*contactFlag),
+		plain:          plainOutput(*noColorFlag, os.Stdout),
+		listSources:    *listSourcesFlag,
+		check:          *checkFlag,
+		strict:         strict,
+		fixtures:       *fixturesFlag,
+		lat:            *latFlag,
+		autoLocate:     *autoLocateFlag,
+		watch:          *watchFlag,
+		warmUp:         *warmUpFlag,
+		lon:            *lonFlag,
+		country:        *countryFlag,
+		admin:          *adminFlag,
+		stream:         *streamFlag,
+		serve:          *serveFlag,
+		logLevel:       *logLevelFlag,
+		trace:          *traceFlag,
+		forecast:       *forecastFlag,
+		airQuality:     *airQualityFlag,
+		trend:          *trendFlag,
+		compare:        *compareFlag,
+		prettyTable:    *prettyTableFlag,
+		sort:           *sortFlag,
+	}
+}
+
+// plainOutput reports whether text output goes without emoji: with --no-color, a non-empty
+// NO_COLOR (see no-color.org), or when stdout is not a terminal unless FORCE_COLOR is set.
+func plainOutput(noColor bool, stdout *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return true
+	}
+	if os.Getenv("FORCE_COLOR") != "" {
+		return false
+	}
+	fi, err := stdout.Stat()
+	return err != nil || fi.Mode()&os.ModeCharDevice == 0
+}
+
+// decor returns the emoji decoration, or its ASCII replacement in plain output.
+func (o options) decor(emoji, ascii string) string {
+	if o.plain {
+		return ascii
+	}
+	return emoji
+}
 
-	return city, exclude, sequential
+// conditionEmoji returns " " plus the emoji for cond, or "" in plain output.
+func conditionEmoji(cond string, opts options) string {
+	return opts.decor(" "+weather.GetConditionEmoji(cond), "")
 }
 
 // parseMultiWordArgs handles Python argparse-like behavior for multi-word arguments.
@@ -91,6 +603,10 @@ func parseMultiWordArgs(cityFlag, excludeFlag string, seqFlag *bool) (city, excl
 		case strings.HasPrefix(arg, "--sequential"):
 			*seqFlag = true
 
+		case strings.HasPrefix(arg, "-"):
+			// Any other flag after a multi-word city, e.g. "--city New York --units imperial"
+			i = setTrailingFlag(args, i)
+
 		case !strings.HasPrefix(arg, "-"):
 			if strings.Contains(arg, ",") {
 				excludeParts = append(excludeParts, arg)
@@ -103,100 +619,1515 @@ func parseMultiWordArgs(cityFlag, excludeFlag string, seqFlag *bool) (city, excl
 	return strings.Join(cityParts, " "), strings.Join(excludeParts, " ")
 }
 
-// displayResults prints per-source results and aggregated statistics.
-func displayResults(data []WeatherData) {
+// setTrailingFlag applies a flag found after flag.Parse() stopped at a non-flag argument.
+// Supports "--name=value", "--name value" and bare boolean flags. Returns the index of the last consumed arg.
+func setTrailingFlag(args []string, i int) int {
+	name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+	f := flag.Lookup(name)
+	if f == nil {
+		return i
+	}
+	if !hasValue {
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+			value = "true"
+		} else if i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+	}
+	if err := f.Value.Set(value); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid value %q for flag --%s: %v\n", value, name, err)
+		os.Exit(exitUsage)
+	}
+	return i
+}
+
+// validateOptions checks flag values that have a fixed set of allowed values.
+func validateOptions(opts options) error {
+	if err := validateQueryOptions(opts); err != nil {
+		return err
+	}
+	switch opts.format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid format %q (allowed: text, json)", opts.format)
+	}
+	if opts.pretty && opts.format != "json" {
+		return fmt.Errorf("--pretty requires --format json")
+	}
+	if opts.prettyTable && (opts.format == "json" || opts.stream) {
+		return fmt.Errorf("--pretty-table requires text output without --stream")
+	}
+	if opts.diffLast && (opts.logRuns == "" || opts.format == "json" || opts.serve != "") {
+		return fmt.Errorf("--diff-against-last requires text output and --log-runs, without --serve")
+	}
+	if opts.fixtures != "" {
+		if fi, err := os.Stat(opts.fixtures); err != nil || !fi.IsDir() {
+			return fmt.Errorf("--fixtures %q is not a directory", opts.fixtures)
+		}
+	}
+	if opts.only != "" && opts.exclude != "" {
+		return fmt.Errorf("--only and --exclude cannot be combined")
+	}
+	switch opts.sort {
+	case "", "name", "temp", "speed", "source":
+	default:
+		return fmt.Errorf("invalid sort %q (allowed: name, temp, speed, source)", opts.sort)
+	}
+	if opts.sort != "" && opts.stream {
+		return fmt.Errorf("--sort cannot be combined with --stream")
+	}
+	if opts.timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if opts.sourceTimeout < 0 {
+		return fmt.Errorf("source timeout must not be negative")
+	}
+	if opts.retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if opts.maxConcurrency < 0 {
+		return fmt.Errorf("max concurrency must not be negative")
+	}
+	if opts.rate < 0 || math.IsNaN(opts.rate) || math.IsInf(opts.rate, 0) {
+		return fmt.Errorf("rate must be a non-negative number")
+	}
+	if opts.rejectOutliers < 0 {
+		return fmt.Errorf("outlier threshold must not be negative")
+	}
+	if opts.maxAge < 0 {
+		return fmt.Errorf("max age must not be negative")
+	}
+	if strings.ContainsAny(opts.userAgent+opts.contact, "\r\n") {
+		return fmt.Errorf("--user-agent and --contact must be a single line")
+	}
+	if opts.userAgent != "" && opts.contact != "" {
+		return fmt.Errorf("--contact only extends the default User-Agent; include it in --user-agent instead")
+	}
+	if opts.cacheTTL < 0 {
+		return fmt.Errorf("cache TTL must not be negative")
+	}
+	loc, err := parseLocation(opts.lat, opts.lon)
+	if err != nil {
+		return err
+	}
+	if _, err := parseLogLevel(opts.logLevel); err != nil {
+		return err
+	}
+	if _, err := parseForecast(opts.forecast); err != nil {
+		return err
+	}
+	if opts.serve != "" && (opts.city != "" || opts.cities != "" || opts.stream) {
+		return fmt.Errorf("--serve takes the city per request; drop --city/--cities/--stream")
+	}
+	if opts.stream && opts.format == "json" {
+		return fmt.Errorf("--stream requires text output")
+	}
+	if opts.stream && opts.cities != "" {
+		return fmt.Errorf("--stream cannot be combined with --cities")
+	}
+	if opts.watch != 0 && opts.watch < minWatchInterval {
+		return fmt.Errorf("watch interval must be at least %v", minWatchInterval)
+	}
+	if opts.watch != 0 && (opts.cities != "" || opts.serve != "") {
+		return fmt.Errorf("--watch works with a single city; drop --cities/--serve")
+	}
+	if opts.stdin && (opts.city != "" || opts.cities != "" || opts.serve != "" || opts.watch != 0 || opts.autoLocate || opts.check) {
+		return fmt.Errorf("--stdin replaces --city/--cities; drop --serve/--watch/--auto-locate/--check")
+	}
+	if opts.strict != "" && (opts.serve != "" || opts.check) {
+		return fmt.Errorf("--strict sets the exit code of a run; drop --serve/--check")
+	}
+	if opts.warmUp != "" && opts.serve == "" && opts.watch == 0 {
+		return fmt.Errorf("--warm-up requires --serve or --watch")
+	}
+	if opts.warmUp != "" && (opts.coordCache == "" || opts.fixtures != "") {
+		return fmt.Errorf("--warm-up needs the coordinate cache; drop --coord-cache \"\"/--fixtures")
+	}
+	if _, err := parseWarmUpCities(opts.warmUp); err != nil {
+		return err
+	}
+	if opts.check && (opts.cities != "" || opts.serve != "" || opts.watch != 0 || opts.stream || opts.autoLocate) {
+		return fmt.Errorf("--check probes a single city; drop --cities/--serve/--watch/--stream/--auto-locate")
+	}
+	if opts.autoLocate && (loc != nil || opts.serve != "") {
+		return fmt.Errorf("--auto-locate cannot be combined with --lat/--lon or --serve")
+	}
+	if loc != nil && opts.cities != "" {
+		return fmt.Errorf("--lat/--lon cannot be combined with --cities")
+	}
+	if loc != nil && (opts.country != "" || opts.admin != "") {
+		return fmt.Errorf("--country/--admin have no effect with --lat/--lon")
+	}
+	if opts.country != "" && !countryCodePattern.MatchString(opts.country) {
+		return fmt.Errorf("invalid country %q (expected a 2-letter ISO code, e.g. US)", opts.country)
+	}
+	return nil
+}
+
+var countryCodePattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// parseLogLevel parses the --log-level flag; empty means warn.
+func parseLogLevel(level string) (slog.Level, error) {
+	l := slog.LevelWarn
+	if level == "" {
+		return l, nil
+	}
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("invalid log level %q (allowed: debug, info, warn, error)", level)
+	}
+	return l, nil
+}
+
+// parseForecast parses the --forecast flag: "<N>h" for hourly or "<N>d" for daily points.
+func parseForecast(s string) (weather.ForecastSpec, error) {
+	if s == "" {
+		return weather.ForecastSpec{}, nil
+	}
+	invalid := fmt.Errorf("invalid forecast %q (allowed: 1h..%dh or 1d..%dd)", s, weather.MaxForecastHours, weather.MaxForecastDays)
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 1 {
+		return weather.ForecastSpec{}, invalid
+	}
+	switch unit := s[len(s)-1]; {
+	case unit == 'h' && n <= weather.MaxForecastHours:
+		return weather.ForecastSpec{Hours: n}, nil
+	case unit == 'd' && n <= weather.MaxForecastDays:
+		return weather.ForecastSpec{Days: n}, nil
+	}
+	return weather.ForecastSpec{}, invalid
+}
+
+// parseLocation parses the --lat/--lon pair. Returns nil if neither is set.
+func parseLocation(lat, lon string) (*[2]float64, error) {
+	if lat == "" && lon == "" {
+		return nil, nil
+	}
+	if lat == "" || lon == "" {
+		return nil, fmt.Errorf("--lat and --lon must be given together")
+	}
+	latV, err := strconv.ParseFloat(lat, 64)
+	if err != nil || math.IsNaN(latV) || latV < -90 || latV > 90 {
+		return nil, fmt.Errorf("invalid latitude %q (allowed: -90..90)", lat)
+	}
+	lonV, err := strconv.ParseFloat(lon, 64)
+	if err != nil || math.IsNaN(lonV) || lonV < -180 || lonV > 180 {
+		return nil, fmt.Errorf("invalid longitude %q (allowed: -180..180)", lon)
+	}
+	return &[2]float64{latV, lonV}, nil
+}
+
+// airQualityText formats the air quality readings, e.g. "US AQI 42 (Good), PM2.5 8.1 µg/m³".
+func airQualityText(aqi *int, pm25 *float64) string {
+	var parts []string
+	if aqi != nil {
+		parts = append(parts, fmt.Sprintf("US AQI %d (%s)", *aqi, weather.AQICategory(*aqi)))
+	}
+	if pm25 != nil {
+		parts = append(parts, fmt.Sprintf("PM2.5 %.1f µg/m³", *pm25))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sunTimes returns sunrise and sunset from the first valid source reporting both.
+func sunTimes(data []weather.WeatherData) (rise, set *time.Time) {
 	for _, d := range data {
-		if d.Error != nil {
-			fmt.Printf("❌ %-18s ERROR: %v (%.0fms)\n", d.Source+":", d.Error, d.Duration.Seconds()*1000)
-		} else {
+		if d.Error == nil && d.Sunrise != nil && d.Sunset != nil {
+			return d.Sunrise, d.Sunset
+		}
+	}
+	return nil, nil
+}
+
+// spreadText renders the temperature range and standard deviation, e.g. " (range 12.1–16.8, σ=1.4)".
+// Empty for a single reading; a warning is appended when sources disagree.
+func spreadText(res weather.AggregationResult, opts options) string {
+	units := opts.units
+	if res.Valid < 2 {
+		return ""
+	}
+	lo, _ := convertTemp(res.MinTemp, units)
+	hi, _ := convertTemp(res.MaxTemp, units)
+	s := fmt.Sprintf(" (range %.1f–%.1f, σ=%.1f)", lo, hi, convertTempDelta(res.StdDevTemp, units))
+	if res.LowAgreement() {
+		s += opts.decor(" ⚠️  low agreement", " [WARN] low agreement")
+	}
+	return s
+}
+
+// convertTempDelta converts a Celsius temperature difference; unlike convertTemp there is no offset.
+func convertTempDelta(delta float64, unit string) float64 {
+	if unit == "imperial" {
+		return delta * 9 / 5
+	}
+	return delta
+}
+
+// convertTemp converts a Celsius temperature into the requested unit system.
+// Returns the converted value and its symbol. Unknown units fall back to Celsius.
+func convertTemp(celsius float64, unit string) (float64, string) {
+	switch unit {
+	case "imperial":
+		return celsius*9/5 + 32, "°F"
+	case "standard":
+		return celsius + 273.15, "K"
+	default:
+		return celsius, "°C"
+	}
+}
+
+// displayResults renders results in the selected format and returns the number of valid sources.
+// Temperatures are stored in Celsius and only converted to units here.
+func displayResults(city string, data []weather.WeatherData, opts options, meta *metaJSON) int {
+	data = sortResults(data, opts.sort, opts.sourceOrder)
+	if opts.format == "json" {
+		return displayJSON(city, data, opts, meta)
+	}
+	return displayText(data, opts)
+}
+
+// sortResults returns a sorted copy of data for --sort; an empty mode keeps the order as is.
+// Failed sources always come last, air quality entries after the weather readings when
+// sorting by temperature. The sort is stable, so ties keep their arrival order.
+func sortResults(data []weather.WeatherData, mode string, order []string) []weather.WeatherData {
+	if mode == "" {
+		return data
+	}
+	rank := func(d weather.WeatherData) int {
+		switch {
+		case d.Error != nil:
+			return 2
+		case d.AirQuality && mode == "temp":
+			return 1
+		}
+		return 0
+	}
+	sorted := slices.Clone(data)
+	slices.SortStableFunc(sorted, func(a, b weather.WeatherData) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		switch mode {
+		case "name":
+			return strings.Compare(strings.ToLower(a.Source), strings.ToLower(b.Source))
+		case "temp":
+			if a.AirQuality {
+				return 0
+			}
+			return cmp.Compare(a.Temperature, b.Temperature)
+		case "speed":
+			return cmp.Compare(a.Duration, b.Duration)
+		case "source":
+			return sourceIndex(order, a.Source) - sourceIndex(order, b.Source)
+		}
+		return 0
+	})
+	return sorted
+}
+
+// sourceIndex is the position of name in order; unknown sources go to the end.
+func sourceIndex(order []string, name string) int {
+	if i := slices.Index(order, name); i >= 0 {
+		return i
+	}
+	return len(order)
+}
+
+// strategyFor returns the aggregation strategy selected by --aggregate.
+func strategyFor(opts options) weather.AggregationStrategy {
+	switch opts.aggregate {
+	case "median":
+		return weather.MedianAggregator{}
+	case "trimmed":
+		return weather.TrimmedMeanAggregator{TrimPct: opts.trimPct}
+	}
+	return weather.MeanAggregator{}
+}
+
+// aggregate summarizes data with the --aggregate strategy; AvgTemp and AvgHumidity hold its
+// central values.
+func aggregate(data []weather.WeatherData, opts options) weather.AggregationResult {
+	return strategyFor(opts).Aggregate(data)
+}
+
+// displayText prints per-source results and aggregated statistics.
+func displayText(data []weather.WeatherData, opts options) int {
+	var valid int
+	if opts.prettyTable {
+		valid = printPrettyTable(os.Stdout, data, opts)
+	} else {
+		printSourceTable(os.Stdout, data, opts)
+		valid = printAggregate(data, opts)
+	}
+	printComparison(data, opts)
+	printAlerts(weather.MergeAlerts(data), opts)
+	printForecasts(data, opts)
+	return valid
+}
+
+// printAlerts prints the active severe weather alerts, if any source reported some.
+func printAlerts(alerts []weather.Alert, opts options) {
+	if len(alerts) == 0 {
+		return
+	}
+	fmt.Printf("\n%sWeather Alerts (%d):\n", opts.decor("⚠️  ", "[WARN] "), len(alerts))
+	for _, a := range alerts {
+		fmt.Printf("   %s\n", alertLine(a))
+	}
+}
+
+// alertLine formats one alert, e.g. "Wind Advisory [Moderate] until Tue 18:00 (Pirate-Weather, WeatherAPI.com)".
+func alertLine(a weather.Alert) string {
+	var b strings.Builder
+	b.WriteString(a.Title)
+	if a.Severity != "" {
+		fmt.Fprintf(&b, " [%s]", a.Severity)
+	}
+	if a.Expires != nil {
+		fmt.Fprintf(&b, " until %s", a.Expires.Format("Mon 15:04"))
+	}
+	if len(a.Sources) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(a.Sources, ", "))
+	}
+	return b.String()
+}
+
+// printForecasts prints a compact forecast table per source, if a forecast was requested.
+func printForecasts(data []weather.WeatherData, opts options) {
+	if opts.forecast == "" {
+		return
+	}
+	fmt.Printf("\n%sForecast (next %s):\n", opts.decor("📅 ", ""), opts.forecast)
+	for _, d := range data {
+		if d.Error != nil || d.AirQuality {
+			continue
+		}
+		if d.ForecastError != nil {
+			fmt.Printf("   %-18s %v\n", d.Source+":", d.ForecastError)
+			continue
+		}
+		fmt.Printf("   %s:\n", d.Source)
+		for _, p := range d.Forecast {
+			fmt.Printf("     %s\n", forecastLine(p, opts))
+		}
+	}
+}
+
+// forecastLine formats one forecast point, e.g. "Tue 14:00   12.3°C  Cloudy ☁️"
+// or for days "Tue 14 Oct   8.1–14.3°C  Rainy 🌧️".
+func forecastLine(p weather.ForecastPoint, opts options) string {
+	units := opts.units
+	high, symbol := convertTemp(p.Temperature, units)
+	cond := p.Condition + conditionEmoji(p.Condition, opts)
+	if p.Low == nil {
+		return fmt.Sprintf("%s  %6.1f%s  %s", p.Time.Format("Mon 15:04"), high, symbol, cond)
+	}
+	low, _ := convertTemp(*p.Low, units)
+	return fmt.Sprintf("%s  %5.1f–%.1f%s  %s", p.Time.Format("Mon 02 Jan"), low, high, symbol, cond)
+}
+
+// printSourceTable prints the per-source results as aligned columns. The status markers are
+// added after tabwriter has aligned the rest: it counts runes, not terminal cells, so emoji
+// like ⚠️ (two runes) would shift their row. All fancy markers are two cells wide.
+func printSourceTable(w io.Writer, data []weather.WeatherData, opts options) {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Source\tTemp\tHumidity\tCondition\tDuration\t")
+	markers := make([]string, 0, len(data))
+	for _, d := range data {
+		ms := fmt.Sprintf("%.0fms", d.Duration.Seconds()*1000)
+		if d.TTFB > 0 {
+			ms += fmt.Sprintf(" (TTFB %.0fms)", d.TTFB.Seconds()*1000)
+		}
+		switch {
+		case d.AirQuality && d.Error == nil:
+			markers = append(markers, opts.decor("🌫️", "[AQ]"))
+			fmt.Fprintf(tw, "%s\t-\t-\tair quality\t%s\t%s\n", d.Source, ms, airQualityText(d.AQI, d.PM25))
+		case excluded(d):
+			markers = append(markers, opts.decor("⚠️", "[WARN]"))
+			fmt.Fprintf(tw, "%s\t-\t-\tREJECTED\t%s\t%v\n", d.Source, ms, d.Error)
+		case d.Error != nil:
+			markers = append(markers, opts.decor("❌", "[ERR]"))
+			fmt.Fprintf(tw, "%s\t-\t-\tERROR\t%s\t%v\n", d.Source, ms, d.Error)
+		default:
+			markers = append(markers, opts.decor("✅", "[OK]"))
 			humStr := "N/A"
 			if d.Humidity != nil {
 				humStr = fmt.Sprintf("%.0f%%", *d.Humidity)
 			}
-			fmt.Printf("✅ %-18s %.1f°C, %s humidity, %s (%.0fms)\n", d.Source+":", d.Temperature, humStr, d.Condition, d.Duration.Seconds()*1000)
+			temp, symbol := convertTemp(d.Temperature, opts.units)
+			cond := d.Condition
+			if opts.verbose {
+				cond += rawConditionText(d)
+			}
+			var details []string
+			if d.FeelsLike != nil {
+				feels, _ := convertTemp(*d.FeelsLike, opts.units)
+				details = append(details, fmt.Sprintf("feels %.1f%s", feels, symbol))
+			}
+			if dp := dewPointText(d, opts.units); dp != "" {
+				details = append(details, strings.TrimPrefix(dp, ", "))
+			}
+			if wp := windPressureText(d); wp != "" {
+				details = append(details, strings.TrimPrefix(wp, ", "))
+			}
+			if obs := observedText(d, time.Now()); obs != "" {
+				details = append(details, obs)
+			}
+			fmt.Fprintf(tw, "%s\t%.1f%s%s\t%s\t%s\t%s\t%s\n", d.Source, temp, symbol, trendText(d), humStr, cond, ms, strings.Join(details, ", "))
+		}
+	}
+	tw.Flush()
+
+	markerWidth := 2
+	if opts.plain {
+		markerWidth = len("[WARN]")
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	for i, line := range lines {
+		marker := strings.Repeat(" ", markerWidth)
+		if i > 0 {
+			marker = markers[i-1]
+			if opts.plain {
+				marker = fmt.Sprintf("%-*s", markerWidth, marker)
+			}
+		}
+		fmt.Fprintf(w, "%s %s\n", marker, strings.TrimRight(line, " "))
+	}
+}
+
+// printPrettyTable prints the weather sources side by side for --pretty-table, N/A marking
+// readings a source doesn't provide, and a final row with the aggregate and consensus
+// condition. Air quality entries are left out. Returns the number of valid sources.
+func printPrettyTable(w io.Writer, data []weather.WeatherData, opts options) int {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Source\tTemp\tHumidity\tCondition\tFeels Like\tWind\tDuration\t")
+	tempText := func(c float64) string {
+		t, symbol := convertTemp(c, opts.units)
+		return fmt.Sprintf("%.1f%s", t, symbol)
+	}
+	na := func(v *float64, format func(float64) string) string {
+		if v == nil {
+			return "N/A"
+		}
+		return format(*v)
+	}
+	percent := func(v float64) string { return fmt.Sprintf("%.0f%%", v) }
+	wind := func(v float64) string { return fmt.Sprintf("%.1f m/s", v) }
+	for _, d := range data {
+		ms := fmt.Sprintf("%.0fms", d.Duration.Seconds()*1000)
+		switch {
+		case d.AirQuality:
+		case excluded(d):
+			fmt.Fprintf(tw, "%s\t-\t-\tREJECTED\t-\t-\t%s\t%v\n", d.Source, ms, d.Error)
+		case d.Error != nil:
+			fmt.Fprintf(tw, "%s\t-\t-\tERROR\t-\t-\t%s\t%v\n", d.Source, ms, d.Error)
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", d.Source, tempText(d.Temperature), na(d.Humidity, percent),
+				d.Condition, na(d.FeelsLike, tempText), na(d.WindSpeed, wind), ms)
 		}
 	}
 
-	avgTemp, avgHum, cond, valid := AggregateWeather(data)
-	emoji := GetConditionEmoji(cond)
+	res := aggregate(data, opts)
+	if res.Valid > 0 {
+		avg := func(v float64, n int) *float64 {
+			if n == 0 {
+				return nil
+			}
+			return &v
+		}
+		cond := res.Consensus
+		if res.Valid > 1 {
+			cond += fmt.Sprintf(" (%d/%d)", res.ConsensusVotes, res.Valid)
+		}
+		fmt.Fprintf(tw, "Consensus\t%s\t%s\t%s\t%s\t%s\t-\t\n", tempText(res.AvgTemp), na(avg(res.AvgHumidity, res.HumidityCount), percent),
+			cond, na(avg(res.AvgFeelsLike, res.FeelsLikeCount), tempText), na(avg(res.AvgWindSpeed, res.WindCount), wind))
+	} else {
+		fmt.Fprintln(tw, "Consensus\tN/A\tN/A\tno valid data\tN/A\tN/A\t-\t")
+	}
+	tw.Flush()
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+	return res.Valid
+}
 
-	fmt.Printf("\n📊 Aggregated (%d/%d valid):\n", valid, len(data))
-	if valid > 0 {
-		fmt.Printf("→ Avg Temperature: %.2f°C\n", avgTemp)
-		if avgHum > 0 {
-			fmt.Printf("→ Avg Humidity:    %.1f%%\n", avgHum)
+// printSource prints the result line of a single source; --stream uses it as results arrive.
+func printSource(d weather.WeatherData, opts options) {
+	if d.AirQuality && d.Error == nil {
+		fmt.Printf("%s %-18s %s (%.0fms)\n", opts.decor("🌫️ ", "[AQ]"), d.Source+":", airQualityText(d.AQI, d.PM25), d.Duration.Seconds()*1000)
+		return
+	}
+	if excluded(d) {
+		fmt.Printf("%s %-18s REJECTED: %v (%.0fms)\n", opts.decor("⚠️ ", "[WARN]"), d.Source+":", d.Error, d.Duration.Seconds()*1000)
+	} else if d.Error != nil {
+		fmt.Printf("%s %-18s ERROR: %v (%.0fms)\n", opts.decor("❌", "[ERR]"), d.Source+":", d.Error, d.Duration.Seconds()*1000)
+	} else {
+		humStr := "N/A"
+		if d.Humidity != nil {
+			humStr = fmt.Sprintf("%.0f%%", *d.Humidity)
+		}
+		temp, symbol := convertTemp(d.Temperature, opts.units)
+		cond := d.Condition
+		if opts.verbose {
+			cond += rawConditionText(d)
+		}
+		if obs := observedText(d, time.Now()); obs != "" {
+			cond += " (" + obs + ")"
+		}
+		fmt.Printf("%s %-18s %.1f%s%s%s, %s humidity%s%s, %s (%.0fms)\n", opts.decor("✅", "[OK]"), d.Source+":", temp, symbol, trendText(d), feelsLikeText(d, opts.units), humStr, dewPointText(d, opts.units), windPressureText(d), cond, d.Duration.Seconds()*1000)
+	}
+}
+
+// printAggregate prints the aggregated statistics and returns the number of valid sources.
+func printAggregate(data []weather.WeatherData, opts options) int {
+	units := opts.units
+	res := aggregate(data, opts)
+	label := "Avg"
+	switch opts.aggregate {
+	case "median":
+		label = "Med"
+	case "trimmed":
+		label = "Trim"
+	}
+
+	var notes []string
+	if rejected := countOutliers(data); rejected > 0 {
+		notes = append(notes, fmt.Sprintf("%d outlier(s) rejected", rejected))
+	}
+	if stale := countStale(data); stale > 0 {
+		notes = append(notes, fmt.Sprintf("%d stale excluded", stale))
+	}
+	if len(notes) > 0 {
+		fmt.Printf("\n%sAggregated (%d/%d valid, %s):\n", opts.decor("📊 ", ""), res.Valid, res.Total, strings.Join(notes, ", "))
+	} else {
+		fmt.Printf("\n%sAggregated (%d/%d valid):\n", opts.decor("📊 ", ""), res.Valid, res.Total)
+	}
+	if res.Valid > 0 {
+		temp, symbol := convertTemp(res.AvgTemp, units)
+		fmt.Printf("→ %s Temperature: %.2f%s%s\n", label, temp, symbol, spreadText(res, opts))
+		if res.Valid > 1 {
+			lo, _ := convertTemp(res.MinTemp, units)
+			hi, _ := convertTemp(res.MaxTemp, units)
+			fmt.Printf("→ Range:           coolest %s %.1f%s, warmest %s %.1f%s\n", res.MinSource, lo, symbol, res.MaxSource, hi, symbol)
+		}
+		if res.FeelsLikeCount > 0 {
+			feels, _ := convertTemp(res.AvgFeelsLike, units)
+			fmt.Printf("→ Avg Feels Like:  %.2f%s\n", feels, symbol)
+		}
+		if res.HumidityCount > 0 {
+			fmt.Printf("→ %s Humidity:    %.1f%%\n", label, res.AvgHumidity)
+		} else {
+			fmt.Printf("→ %s Humidity:    N/A\n", label)
+		}
+		if res.DewPointCount > 0 {
+			dew, _ := convertTemp(res.AvgDewPoint, units)
+			fmt.Printf("→ Avg Dew Point:   %.2f%s\n", dew, symbol)
+		}
+		if res.WindCount > 0 {
+			fmt.Printf("→ Avg Wind:        %.1f m/s\n", res.AvgWindSpeed)
+		}
+		if res.PressureCount > 0 {
+			fmt.Printf("→ Avg Pressure:    %.0f hPa\n", res.AvgPressure)
+		}
+		if res.Valid > 1 {
+			fmt.Printf("→ Consensus:       %s%s (%d/%d, %.0f%%)\n", res.Consensus, conditionEmoji(res.Consensus, opts), res.ConsensusVotes, res.Valid, res.Agreement()*100)
 		} else {
-			fmt.Printf("→ Avg Humidity:    N/A\n")
+			fmt.Printf("→ Consensus:       %s%s\n", res.Consensus, conditionEmoji(res.Consensus, opts))
+		}
+		if res.AQI != nil || res.PM25 != nil {
+			fmt.Printf("→ Air Quality:     %s\n", airQualityText(res.AQI, res.PM25))
+		}
+		if rise, set := sunTimes(data); rise != nil {
+			fmt.Printf("→ Sunrise/Sunset:  %s / %s\n", rise.Format("15:04"), set.Format("15:04"))
 		}
-		fmt.Printf("→ Consensus:       %s %s\n", cond, emoji)
 	} else {
 		fmt.Println("→ No valid data available")
 	}
+	return res.Valid
+}
+
+// feelsLikeText formats the optional apparent temperature, e.g. " (feels 9.8°C)".
+func feelsLikeText(d weather.WeatherData, units string) string {
+	if d.FeelsLike == nil {
+		return ""
+	}
+	feels, symbol := convertTemp(*d.FeelsLike, units)
+	return fmt.Sprintf(" (feels %.1f%s)", feels, symbol)
+}
+
+// dewPointText formats the optional dew point, e.g. ", dew point 9.3°C".
+func dewPointText(d weather.WeatherData, units string) string {
+	if d.DewPoint == nil {
+		return ""
+	}
+	dew, symbol := convertTemp(*d.DewPoint, units)
+	return fmt.Sprintf(", dew point %.1f%s", dew, symbol)
+}
+
+// compareThreshold is the deviation from the aggregate (°C) above which --compare flags a source.
+// It matches the spread at which the aggregate warns about low agreement.
+const compareThreshold = weather.LowAgreementStdDev
+
+// sourceDelta is one source's temperature deviation from the aggregated temperature.
+type sourceDelta struct {
+	Source string
+	Delta  float64 // °C, positive when the source reads warmer
+}
+
+// Off reports whether the source deviates by more than compareThreshold.
+func (d sourceDelta) Off() bool { return math.Abs(d.Delta) > compareThreshold }
+
+// compareDeltas returns the delta of every valid weather reading from center, in data order.
+func compareDeltas(data []weather.WeatherData, center float64) []sourceDelta {
+	var deltas []sourceDelta
+	for _, d := range data {
+		if d.Error != nil || d.AirQuality {
+			continue
+		}
+		deltas = append(deltas, sourceDelta{Source: d.Source, Delta: d.Temperature - center})
+	}
+	return deltas
+}
+
+// printComparison prints the signed deviation of each source from the aggregate with --compare.
+func printComparison(data []weather.WeatherData, opts options) {
+	res := aggregate(data, opts)
+	if !opts.compare || res.Valid < 2 {
+		return
+	}
+	center := res.AvgTemp
+	_, symbol := convertTemp(0, opts.units)
+	label := "mean"
+	switch opts.aggregate {
+	case "median":
+		label = "median"
+	case "trimmed":
+		label = "trimmed mean"
+	}
+	fmt.Printf("\n%sDeviation from the %s:\n", opts.decor("🔍 ", ""), label)
+	for _, d := range compareDeltas(data, center) {
+		line := fmt.Sprintf("   %-18s %+.1f%s", d.Source+":", convertTempDelta(d.Delta, opts.units), symbol)
+		if d.Off() {
+			line += fmt.Sprintf("  %soff by more than %.1f%s", opts.decor("⚠️  ", "[WARN] "), convertTempDelta(compareThreshold, opts.units), symbol)
+		}
+		fmt.Println(line)
+	}
+}
+
+// observedText formats the observation time in the location's time zone, e.g. "as of 14:20"
+// or "as of 09:05, stale" (see weather.StaleAfter); "" if the source doesn't report it.
+func observedText(d weather.WeatherData, now time.Time) string {
+	if d.ObservedAt == nil {
+		return ""
+	}
+	s := "as of " + d.ObservedAt.Format("15:04")
+	if d.Stale(now) {
+		s += ", stale"
+	}
+	return s
+}
+
+// trendText formats the optional temperature trend, e.g. " ↑".
+func trendText(d weather.WeatherData) string {
+	if d.Trend == "" {
+		return ""
+	}
+	return " " + d.Trend
+}
+
+// windPressureText formats the optional wind and pressure readings, e.g. ", 3.2 m/s wind, 1013 hPa".
+func windPressureText(d weather.WeatherData) string {
+	var b strings.Builder
+	if d.WindSpeed != nil {
+		fmt.Fprintf(&b, ", %.1f m/s wind", *d.WindSpeed)
+	}
+	if d.Pressure != nil {
+		fmt.Fprintf(&b, ", %.0f hPa", *d.Pressure)
+	}
+	return b.String()
+}
+
+// rawConditionText describes the provider's raw condition and how it normalized,
+// e.g. ` [raw: code 61 → Rainy]`. Used by --verbose to spot gaps in weather_codes.json.
+func rawConditionText(d weather.WeatherData) string {
+	var parts []string
+	if d.RawCode != nil {
+		parts = append(parts, fmt.Sprintf("code %d", *d.RawCode))
+	}
+	if d.RawCondition != "" {
+		parts = append(parts, fmt.Sprintf("%q", d.RawCondition))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "n/a")
+	}
+	return fmt.Sprintf(" [raw: %s → %s]", strings.Join(parts, ", "), weather.NormalizeCondition(d.Condition))
+}
+
+// countOutliers counts readings marked by rejectOutliers.
+func countOutliers(data []weather.WeatherData) int {
+	n := 0
+	for _, d := range data {
+		if errors.Is(d.Error, weather.ErrOutlier) {
+			n++
+		}
+	}
+	return n
+}
+
+// countStale counts readings marked by --max-age.
+func countStale(data []weather.WeatherData) int {
+	n := 0
+	for _, d := range data {
+		if errors.Is(d.Error, weather.ErrStale) {
+			n++
+		}
+	}
+	return n
+}
+
+// excluded reports whether d was set aside by --max-age or --reject-outliers rather than failing.
+func excluded(d weather.WeatherData) bool {
+	return errors.Is(d.Error, weather.ErrOutlier) || errors.Is(d.Error, weather.ErrStale)
+}
+
+// rejectReadings applies --max-age and then --reject-outliers, so the outlier statistics
+// only see fresh readings.
+func rejectReadings(data []weather.WeatherData, opts options) []weather.WeatherData {
+	data, _ = weather.RejectStale(data, opts.maxAge, time.Now())
+	data, _ = weather.RejectOutliers(data, opts.rejectOutliers)
+	return data
+}
+
+// sourceJSON is the JSON form of weather.WeatherData: errors become strings, missing values are omitted.
+type sourceJSON struct {
+	Source       string   `json:"source"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	FeelsLike    *float64 `json:"feels_like,omitempty"`
+	Humidity     *float64 `json:"humidity,omitempty"`
+	DewPoint     *float64 `json:"dew_point,omitempty"`
+	WindSpeed    *float64 `json:"wind_speed,omitempty"`
+	Pressure     *float64 `json:"pressure,omitempty"`
+	Trend        string   `json:"trend,omitempty"`
+	Delta        *float64 `json:"delta,omitempty"` // deviation from the aggregated temperature, with --compare
+	Condition    string   `json:"condition,omitempty"`
+	RawCondition string   `json:"raw_condition,omitempty"`
+	RawCode      *int     `json:"raw_code,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	DurationMs   float64  `json:"duration_ms"`
+	TTFBMs       float64  `json:"ttfb_ms,omitempty"` // with --trace
+
+	ObservedAt    string         `json:"observed_at,omitempty"` // RFC 3339, when the source measured the reading
+	Stale         bool           `json:"stale,omitempty"`       // observed more than an hour ago
+	Sunrise       string         `json:"sunrise,omitempty"`     // RFC 3339 with the location's offset
+	Sunset        string         `json:"sunset,omitempty"`
+	Forecast      []forecastJSON `json:"forecast,omitempty"`
+	ForecastError string         `json:"forecast_error,omitempty"`
+	AQI           *int           `json:"us_aqi,omitempty"`
+	PM25          *float64       `json:"pm2_5,omitempty"`
+}
+
+// forecastJSON is the JSON form of one forecast point, in the requested units.
+type forecastJSON struct {
+	Time        string   `json:"time"` // RFC 3339 with the location's offset
+	Temperature float64  `json:"temperature"`
+	Low         *float64 `json:"low,omitempty"`
+	Condition   string   `json:"condition"`
+}
+
+// aggregateJSON is the JSON form of the aggregation result.
+// Avg temperature/humidity hold the median when --aggregate median is used.
+type aggregateJSON struct {
+	Method         string         `json:"method"`
+	AvgTemperature *float64       `json:"avg_temperature,omitempty"`
+	MinTemperature *float64       `json:"min_temperature,omitempty"`
+	MaxTemperature *float64       `json:"max_temperature,omitempty"`
+	CoolestSource  string         `json:"coolest_source,omitempty"` // source of min_temperature
+	WarmestSource  string         `json:"warmest_source,omitempty"` // source of max_temperature
+	StdDev         *float64       `json:"temperature_stddev,omitempty"`
+	LowAgreement   bool           `json:"low_agreement,omitempty"`
+	AvgFeelsLike   *float64       `json:"avg_feels_like,omitempty"`
+	AvgHumidity    *float64       `json:"avg_humidity,omitempty"`
+	AvgDewPoint    *float64       `json:"avg_dew_point,omitempty"`
+	AvgWindSpeed   *float64       `json:"avg_wind_speed,omitempty"`
+	AvgPressure    *float64       `json:"avg_pressure,omitempty"`
+	Consensus      string         `json:"consensus"`
+	Agreement      *float64       `json:"consensus_agreement,omitempty"` // share of valid sources, 0 to 1
+	Votes          map[string]int `json:"votes,omitempty"`
+	Valid          int            `json:"valid"`
+	Total          int            `json:"total"`
+	Rejected       int            `json:"rejected,omitempty"`
+	Stale          int            `json:"stale_excluded,omitempty"` // readings older than --max-age
+	AQI            *int           `json:"us_aqi,omitempty"`
+	PM25           *float64       `json:"pm2_5,omitempty"`
+	Alerts         []alertJSON    `json:"alerts,omitempty"`
+}
+
+// alertJSON is the JSON form of a deduplicated weather alert.
+type alertJSON struct {
+	Title    string   `json:"title"`
+	Severity string   `json:"severity,omitempty"`
+	Expires  string   `json:"expires,omitempty"` // RFC 3339
+	Sources  []string `json:"sources"`
+}
+
+// resultsJSON is the top-level document written by --format json.
+type resultsJSON struct {
+	City       string        `json:"city"`
+	Unit       string        `json:"unit"`
+	Meta       *metaJSON     `json:"meta,omitempty"`
+	Sources    []sourceJSON  `json:"sources"`
+	Aggregated aggregateJSON `json:"aggregated"`
+}
+
+// version is reported in the JSON metadata; release builds set it with
+// go build -ldflags "-X main.version=1.2.0".
+var version = "dev"
+
+// metaJSON is the provenance of a JSON document: where, when and how the readings were taken.
+type metaJSON struct {
+	Time       string   `json:"time"`        // RFC 3339 in UTC, when fetching started
+	DurationMs float64  `json:"duration_ms"` // fetching all sources for the city
+	Version    string   `json:"version"`
+	Lat        *float64 `json:"lat,omitempty"` // resolved coordinates; missing if the city couldn't be located
+	Lon        *float64 `json:"lon,omitempty"`
+	Excluded   []string `json:"excluded,omitempty"` // available sources dropped by --only/--exclude
+}
+
+// newMetaJSON collects the metadata of a run that started at start. coords are the ones
+// Aggregator.FetchCoords gave the sources, so the metadata never geocodes the city again.
+func newMetaJSON(coords *[2]float64, start time.Time, duration time.Duration, opts options) *metaJSON {
+	meta := &metaJSON{
+		Time:       start.UTC().Format(time.RFC3339),
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		Version:    version,
+		Excluded:   opts.excluded,
+	}
+	if coords != nil {
+		meta.Lat, meta.Lon = &coords[0], &coords[1]
+	}
+	return meta
+}
+
+// excludedSources returns the names of the available sources that are not in used.
+func excludedSources(available, used []weather.WeatherSource) []string {
+	var excluded []string
+	for _, s := range available {
+		if !slices.ContainsFunc(used, func(u weather.WeatherSource) bool { return u.Name() == s.Name() }) {
+			excluded = append(excluded, s.Name())
+		}
+	}
+	return excluded
+}
+
+// buildResultsJSON converts results into the JSON DTO, converting temperatures to units.
+// Without --sort the sources are ordered by name instead of arrival, so runs are diffable.
+func buildResultsJSON(city string, data []weather.WeatherData, opts options) resultsJSON {
+	if opts.sort == "" {
+		data = sortResults(data, "name", nil)
+	}
+	units := opts.units
+	_, symbol := convertTemp(0, units)
+	out := resultsJSON{City: city, Unit: symbol, Sources: make([]sourceJSON, 0, len(data))}
+
+	for _, d := range data {
+		s := sourceJSON{Source: d.Source, DurationMs: float64(d.Duration.Microseconds()) / 1000, TTFBMs: float64(d.TTFB.Microseconds()) / 1000}
+		if d.Error != nil {
+			s.Error = d.Error.Error()
+		} else if d.AirQuality {
+			s.AQI, s.PM25 = d.AQI, d.PM25
+		} else {
+			temp, _ := convertTemp(d.Temperature, units)
+			s.Temperature = &temp
+			if d.FeelsLike != nil {
+				feels, _ := convertTemp(*d.FeelsLike, units)
+				s.FeelsLike = &feels
+			}
+			s.Humidity = d.Humidity
+			if d.DewPoint != nil {
+				dew, _ := convertTemp(*d.DewPoint, units)
+				s.DewPoint = &dew
+			}
+			s.WindSpeed, s.Pressure = d.WindSpeed, d.Pressure
+			s.Condition, s.Trend = d.Condition, d.Trend
+			s.RawCondition, s.RawCode = d.RawCondition, d.RawCode
+			if d.Sunrise != nil && d.Sunset != nil {
+				s.Sunrise, s.Sunset = d.Sunrise.Format(time.RFC3339), d.Sunset.Format(time.RFC3339)
+			}
+			if d.ObservedAt != nil {
+				s.ObservedAt, s.Stale = d.ObservedAt.Format(time.RFC3339), d.Stale(time.Now())
+			}
+			if d.ForecastError != nil {
+				s.ForecastError = d.ForecastError.Error()
+			}
+			for _, p := range d.Forecast {
+				f := forecastJSON{Time: p.Time.Format(time.RFC3339), Condition: p.Condition}
+				f.Temperature, _ = convertTemp(p.Temperature, units)
+				if p.Low != nil {
+					low, _ := convertTemp(*p.Low, units)
+					f.Low = &low
+				}
+				s.Forecast = append(s.Forecast, f)
+			}
+		}
+		out.Sources = append(out.Sources, s)
+	}
+
+	res := aggregate(data, opts)
+	out.Aggregated = aggregateJSON{
+		Method:    opts.aggregate,
+		Consensus: res.Consensus,
+		Votes:     res.Votes,
+		Valid:     res.Valid,
+		Total:     res.Total,
+		Rejected:  countOutliers(data),
+		Stale:     countStale(data),
+		AQI:       res.AQI,
+		PM25:      res.PM25,
+	}
+	for _, a := range res.Alerts {
+		aj := alertJSON{Title: a.Title, Severity: a.Severity, Sources: a.Sources}
+		if a.Expires != nil {
+			aj.Expires = a.Expires.Format(time.RFC3339)
+		}
+		out.Aggregated.Alerts = append(out.Aggregated.Alerts, aj)
+	}
+	if res.Valid > 0 {
+		temp, _ := convertTemp(res.AvgTemp, units)
+		out.Aggregated.AvgTemperature = &temp
+		lo, _ := convertTemp(res.MinTemp, units)
+		hi, _ := convertTemp(res.MaxTemp, units)
+		sd := convertTempDelta(res.StdDevTemp, units)
+		out.Aggregated.MinTemperature, out.Aggregated.MaxTemperature, out.Aggregated.StdDev = &lo, &hi, &sd
+		out.Aggregated.CoolestSource, out.Aggregated.WarmestSource = res.MinSource, res.MaxSource
+		out.Aggregated.LowAgreement = res.LowAgreement()
+		agreement := res.Agreement()
+		out.Aggregated.Agreement = &agreement
+		if res.FeelsLikeCount > 0 {
+			feels, _ := convertTemp(res.AvgFeelsLike, units)
+			out.Aggregated.AvgFeelsLike = &feels
+		}
+		if res.HumidityCount > 0 {
+			out.Aggregated.AvgHumidity = &res.AvgHumidity
+		}
+		if res.DewPointCount > 0 {
+			dew, _ := convertTemp(res.AvgDewPoint, units)
+			out.Aggregated.AvgDewPoint = &dew
+		}
+		if opts.compare && res.Valid > 1 {
+			center := res.AvgTemp
+			for i, d := range data { // out.Sources is in data order
+				if d.Error == nil && !d.AirQuality {
+					delta := convertTempDelta(d.Temperature-center, units)
+					out.Sources[i].Delta = &delta
+				}
+			}
+		}
+		if res.WindCount > 0 {
+			out.Aggregated.AvgWindSpeed = &res.AvgWindSpeed
+		}
+		if res.PressureCount > 0 {
+			out.Aggregated.AvgPressure = &res.AvgPressure
+		}
+	}
+	return out
+}
+
+// displayJSON writes results as a single-line JSON document to stdout (one line per city),
+// or indented with --pretty.
+func displayJSON(city string, data []weather.WeatherData, opts options, meta *metaJSON) int {
+	out := buildResultsJSON(city, data, opts)
+	out.Meta = meta
+	if err := encodeJSON(os.Stdout, out, opts.pretty); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+	}
+	return out.Aggregated.Valid
+}
+
+// encodeJSON writes v as one line, or indented by two spaces when pretty is set.
+func encodeJSON(w io.Writer, v any, pretty bool) error {
+	enc := json.NewEncoder(w)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// loadSources creates the sources declared in the --config file, or the env-based defaults without one.
+// In fixture mode all known sources are created unless a config file selects them.
+func loadSources(configPath string, fixtures bool) ([]weather.WeatherSource, error) {
+	if configPath == "" && fixtures {
+		return weather.FixtureSources(), nil
+	}
+	if configPath == "" {
+		return weather.InitSources(), nil
+	}
+	cfg, err := weather.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.NewSources()
 }
 
 // filterExcludedSources removes excluded sources from the list.
-func filterExcludedSources(allSources []WeatherSource, exclude string) []WeatherSource {
+func filterExcludedSources(allSources []weather.WeatherSource, exclude string) []weather.WeatherSource {
 	if exclude == "" {
 		return allSources
 	}
 
 	excludedMap := make(map[string]bool)
 	for _, name := range strings.Split(exclude, ",") {
-		excludedMap[normalizeSourceName(strings.TrimSpace(name))] = true
+		excludedMap[weather.NormalizeSourceName(strings.TrimSpace(name))] = true
 	}
 
-	sources := make([]WeatherSource, 0, len(allSources))
+	sources := make([]weather.WeatherSource, 0, len(allSources))
 	for _, s := range allSources {
-		if !excludedMap[normalizeSourceName(s.Name())] {
+		if !excludedMap[weather.NormalizeSourceName(s.Name())] {
 			sources = append(sources, s)
 		}
 	}
 	return sources
 }
 
+// missingKeySources returns the sources selected by --only and --exclude that need an API key
+// which isn't set (or whose key file is unreadable), in ListSources order.
+func missingKeySources(infos []weather.SourceInfo, only, exclude string) []weather.SourceInfo {
+	names := func(list string) map[string]bool {
+		set := make(map[string]bool)
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				set[weather.NormalizeSourceName(name)] = true
+			}
+		}
+		return set
+	}
+	wanted, excluded := names(only), names(exclude)
+	var missing []weather.SourceInfo
+	for _, s := range infos {
+		name := weather.NormalizeSourceName(s.Name)
+		if s.EnvKey != "" && !s.KeyPresent && (only == "" || wanted[name]) && !excluded[name] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// printNoUsableSources explains that no source can succeed because the selected ones all lack
+// their API keys, and how to set them up.
+func printNoUsableSources(w io.Writer, missing []weather.SourceInfo) {
+	fmt.Fprintln(w, "Error: no usable sources, the selected ones need API keys that are not set:")
+	for _, s := range missing {
+		if s.KeyError != nil {
+			fmt.Fprintf(w, "  %-16s %v\n", s.Name, s.KeyError)
+		} else {
+			fmt.Fprintf(w, "  %-16s set %s\n", s.Name, s.EnvKey)
+		}
+	}
+	fmt.Fprintln(w, "Add the keys to the .env file in the repository root (see .env.example) or export them, then verify with --list-sources.")
+}
+
+// printSourceList prints one line per source: its name for --only/--exclude and its API key status.
+func printSourceList(w io.Writer, infos []weather.SourceInfo, opts options) {
+	fmt.Fprintln(w, "Available sources (use these names with --only/--exclude):")
+	ok, missing := opts.decor("✅", "[OK] "), opts.decor("❌", "[ERR]")
+	for _, s := range infos {
+		switch {
+		case s.EnvKey == "":
+			fmt.Fprintf(w, "  %s %-16s no API key needed\n", ok, s.Name)
+		case s.KeyError != nil:
+			fmt.Fprintf(w, "  %s %-16s %v\n", missing, s.Name, s.KeyError)
+		case s.KeyPresent:
+			fmt.Fprintf(w, "  %s %-16s %s is set\n", ok, s.Name, s.EnvKey)
+		default:
+			fmt.Fprintf(w, "  %s %-16s %s missing\n", missing, s.Name, s.EnvKey)
+		}
+	}
+}
+
+// warnUnknownSources writes a warning for each name in the comma-separated list that matches
+// no known source, so typos in --only/--exclude don't go unnoticed.
+func warnUnknownSources(w io.Writer, flagName, list string) {
+	if list == "" {
+		return
+	}
+	known := make(map[string]bool)
+	for _, name := range weather.SourceNames() {
+		known[weather.NormalizeSourceName(name)] = true
+	}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" && !known[weather.NormalizeSourceName(name)] {
+			fmt.Fprintf(w, "Warning: %s %q matches no known source (known: %s)\n", flagName, name, strings.Join(weather.SourceNames(), ", "))
+		}
+	}
+}
+
+// filterOnlySources keeps the sources named in the comma-separated only list, in their original order.
+// Returns an error if none of them is available.
+func filterOnlySources(allSources []weather.WeatherSource, only string) ([]weather.WeatherSource, error) {
+	wanted := make(map[string]bool)
+	for _, name := range strings.Split(only, ",") {
+		wanted[weather.NormalizeSourceName(strings.TrimSpace(name))] = true
+	}
+
+	var sources []weather.WeatherSource
+	for _, s := range allSources {
+		if wanted[weather.NormalizeSourceName(s.Name())] {
+			sources = append(sources, s)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no available source matches --only %q", only)
+	}
+	return sources, nil
+}
+
 // runWeatherFetch executes weather fetching with the chosen strategy.
-func runWeatherFetch(ctx context.Context, cityName string, sources []WeatherSource, sequential bool) []WeatherData {
-	fmt.Printf("🌍 %s | Fetching from %d sources...\n", cityName, len(sources))
+// Progress lines are only printed in text mode so JSON output stays parseable.
+// Also returns the coordinates the sources were queried with, see Aggregator.FetchCoords.
+func runWeatherFetch(ctx context.Context, agg *weather.Aggregator, cityName string, opts options) ([]weather.WeatherData, *[2]float64, time.Duration) {
+	text := opts.format != "json"
+	if text {
+		fmt.Printf("%s%s | Fetching from %d sources...\n", opts.decor("🌍 ", ""), cityName, len(agg.Sources))
+	}
 
-	start := time.Now()
-	var data []WeatherData
+	if text {
+		printLocation(ctx, agg, cityName, opts)
+	}
 
-	if sequential {
-		data = fetchSequential(ctx, cityName, sources)
-	} else {
-		data = fetchWeatherConcurrently(ctx, cityName, sources)
+	start := time.Now()
+	data, coords, err := agg.FetchCoords(ctx, cityName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	}
 	duration := time.Since(start)
 
-	fmt.Printf("⏱️  Completed in %.3fs\n\n", duration.Seconds())
+	if text {
+		fmt.Printf("%sCompleted in %.3fs\n\n", opts.decor("⏱️  ", ""), duration.Seconds())
+	}
+	return data, coords, duration
+}
+
+// printLocation shows which place the name resolved to with --verbose, so ambiguous names can be checked.
+func printLocation(ctx context.Context, agg *weather.Aggregator, cityName string, opts options) {
+	if !opts.verbose {
+		return
+	}
+	if place, err := agg.Locate(ctx, cityName); err == nil {
+		fmt.Printf("%s%s\n", opts.decor("📍 ", "Location: "), place)
+	}
+}
+
+// runStreaming prints each source's result the moment it arrives and the aggregate once all are done.
+// Only this goroutine prints, so results finishing at the same time never interleave their lines.
+// Returns the number of valid sources.
+func runStreaming(ctx context.Context, agg *weather.Aggregator, cityName string, opts options) []weather.WeatherData {
+	fmt.Printf("%s%s | Streaming from %d sources...\n", opts.decor("🌍 ", ""), cityName, len(agg.Sources))
+	printLocation(ctx, agg, cityName, opts)
+
+	start := time.Now()
+	ch, err := agg.Stream(ctx, cityName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil
+	}
+	var data []weather.WeatherData
+	for d := range ch {
+		printSource(d, opts)
+		data = append(data, d)
+	}
+	fmt.Printf("%sCompleted in %.3fs\n", opts.decor("⏱️  ", ""), time.Since(start).Seconds())
+
+	// Outliers are only known once everything arrived; stale readings are marked with them
+	data = rejectReadings(data, opts)
+	for _, d := range data {
+		if excluded(d) {
+			printSource(d, opts)
+		}
+	}
+	printAggregate(data, opts)
+	printComparison(data, opts)
+	printAlerts(weather.MergeAlerts(data), opts)
+	printForecasts(data, opts)
+	return data
+}
+
+// Exit codes of a CLI run, so scripts can tell a degraded result from a failed one.
+const (
+	exitOK      = 0 // every source answered
+	exitUsage   = 1 // invalid flags or configuration
+	exitPartial = 2 // some sources failed or were rejected as outliers or older than --max-age
+	exitFailure = 3 // no valid weather reading at all
+	exitStrict  = 4 // with --strict: a source failed
+)
+
+// exitCodeFor derives the exit code from the results of a run (all cities in batch mode).
+func exitCodeFor(results []weather.WeatherData) int {
+	valid, failed := 0, 0
+	for _, d := range results {
+		switch {
+		case d.Error != nil:
+			failed++
+		case !d.AirQuality:
+			valid++
+		}
+	}
+	switch {
+	case valid == 0:
+		return exitFailure
+	case failed > 0:
+		return exitPartial
+	}
+	return exitOK
+}
+
+// strictMode is the value of --strict: "all" (also for a bare --strict), "auth" or "" (off).
+type strictMode string
+
+func (m *strictMode) String() string   { return string(*m) }
+func (m *strictMode) IsBoolFlag() bool { return true }
+
+func (m *strictMode) Set(v string) error {
+	switch v {
+	case "true", "all":
+		*m = "all"
+	case "false":
+		*m = ""
+	case "auth":
+		*m = "auth"
+	default:
+		return fmt.Errorf("allowed: all, auth")
+	}
+	return nil
+}
+
+// strictFailures returns the failed sources that fail a run under mode: with "all" every
+// source error except outlier and stale exclusions, with "auth" only rejected API keys, so flaky
+// networks don't break a key check.
+func strictFailures(results []weather.WeatherData, mode strictMode) []weather.WeatherData {
+	var failures []weather.WeatherData
+	for _, d := range results {
+		switch {
+		case mode == "" || d.Error == nil || excluded(d):
+		case mode == "auth" && !errors.Is(d.Error, weather.ErrAuth):
+		default:
+			failures = append(failures, d)
+		}
+	}
+	return failures
+}
+
+// runExitCode is exitCodeFor unless --strict applies; then it lists the failures on w,
+// once per source and reason, and returns exitStrict.
+func runExitCode(w io.Writer, results []weather.WeatherData, opts options) int {
+	failures := strictFailures(results, opts.strict)
+	if len(failures) == 0 {
+		return exitCodeFor(results)
+	}
+	fmt.Fprintln(w, "Strict mode, failed sources:")
+	seen := make(map[string]bool)
+	for _, d := range failures {
+		line := fmt.Sprintf("  %s: %s (%v)", d.Source, weather.ClassifyHealth(d.Error), d.Error)
+		if !seen[line] {
+			seen[line] = true
+			fmt.Fprintln(w, line)
+		}
+	}
+	return exitStrict
+}
+
+// defaultRunTimeout is the default --timeout, the overall deadline for fetching one city.
+const defaultRunTimeout = 15 * time.Second
+
+// batchWorkers is how many cities are fetched at once in concurrent batch mode.
+const batchWorkers = 3
+
+// runBatch fetches several cities and prints one result block per city.
+// Each city gets its own deadline. Returns the exit code over all cities' results.
+func runBatch(cities []string, agg *weather.Aggregator, opts options) int {
+	text := opts.format != "json"
+	if text {
+		fmt.Printf("%s%d cities | Fetching from %d sources each...\n", opts.decor("🌍 ", ""), len(cities), len(agg.Sources))
+	}
+
+	workers := batchWorkers
+	if opts.sequential {
+		workers = 1
+	}
+	start := time.Now()
+	// The coordinates each city was fetched with, for the JSON metadata
+	var mu sync.Mutex
+	coords := make(map[string]*[2]float64)
+	results := weather.FetchCities(context.Background(), cities, workers, func(ctx context.Context, city string) []weather.WeatherData {
+		ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+		data, c, _ := agg.FetchCoords(ctx, city)
+		mu.Lock()
+		coords[city] = c
+		mu.Unlock()
+		return data
+	})
+	if text {
+		fmt.Printf("%sCompleted in %.3fs\n", opts.decor("⏱️  ", ""), time.Since(start).Seconds())
+	}
+
+	var all []weather.WeatherData
+	for _, r := range results {
+		if text {
+			rule := opts.decor("━━━", "===")
+			fmt.Printf("\n%s %s (%.3fs) %s\n", rule, r.City, r.Duration.Seconds(), rule)
+		}
+		data := rejectReadings(r.Data, opts)
+		var meta *metaJSON
+		if !text {
+			meta = newMetaJSON(coords[r.City], r.Start, r.Duration, opts)
+		}
+		displayResults(r.City, data, opts, meta)
+		if opts.diffLast {
+			printLastRunDiff(os.Stdout, opts, r.City, data, time.Now())
+		}
+		logRun(opts, r.City, data)
+		all = append(all, data...)
+	}
+	return runExitCode(os.Stderr, all, opts)
+}
+
+// runOnce fetches and prints the weather for a single city and logs the run.
+func runOnce(ctx context.Context, agg *weather.Aggregator, cityName string, opts options) []weather.WeatherData {
+	var data []weather.WeatherData
+	if opts.stream {
+		data = runStreaming(ctx, agg, cityName, opts)
+	} else {
+		start := time.Now()
+		var coords *[2]float64
+		var duration time.Duration
+		data, coords, duration = runWeatherFetch(ctx, agg, cityName, opts)
+		data = rejectReadings(data, opts)
+		var meta *metaJSON
+		if opts.format == "json" {
+			meta = newMetaJSON(coords, start, duration, opts)
+		}
+		displayResults(cityName, data, opts, meta)
+	}
+	if opts.diffLast {
+		printLastRunDiff(os.Stdout, opts, cityName, data, time.Now())
+	}
+	logRun(opts, cityName, data)
 	return data
 }
 
 func main() {
 	_ = godotenv.Load("../.env")
 
-	if err := loadWeatherCodes(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading weather codes: %v\n", err)
-		os.Exit(1)
+	opts := parseFlags()
+
+	if err := weather.LoadWeatherCodes(opts.codesFile); err != nil {
+		// readings don't depend on the codes; only condition names degrade to raw codes
+		fmt.Fprintf(os.Stderr, "Warning: weather codes unavailable, showing raw condition codes: %v\n", err)
 	}
 
-	city, exclude, sequential := parseFlags()
+	if opts.listSources {
+		printSourceList(os.Stdout, weather.ListSources(), opts)
+		return
+	}
+	if opts.stats != "" {
+		os.Exit(runStats(opts.stats, opts))
+	}
 
-	cityName, err := validateCityName(city)
-	if err != nil {
-		printCityValidationError(err)
-		os.Exit(1)
+	// In server mode the city comes with each request
+	var cities []string
+	if opts.serve == "" && !locating(opts) && !opts.check {
+		var err error
+		if opts.stdin && opts.city == "" && opts.cities == "" {
+			cities, err = readCityLines(os.Stdin)
+		} else {
+			cities, err = parseCityList(opts)
+		}
+		if err != nil {
+			printCityValidationError(err)
+			os.Exit(exitUsage)
+		}
+	}
+	if err := validateOptions(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
 
-	sources := filterExcludedSources(initSources(), exclude)
+	sources, err := loadSources(opts.config, opts.fixtures != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	warnUnknownSources(os.Stderr, "--only", opts.only)
+	warnUnknownSources(os.Stderr, "--exclude", opts.exclude)
+	available := sources
+	var onlyErr error
+	if opts.only != "" {
+		sources, onlyErr = filterOnlySources(sources, opts.only)
+	}
+	sources = filterExcludedSources(sources, opts.exclude)
+	opts.excluded = excludedSources(available, sources)
 	if len(sources) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: All sources were excluded")
-		os.Exit(1)
+		// Without --config, sources lacking their API key were skipped by InitSources
+		missing := missingKeySources(weather.ListSources(), opts.only, opts.exclude)
+		switch {
+		case opts.config == "" && opts.fixtures == "" && len(missing) > 0:
+			printNoUsableSources(os.Stderr, missing)
+		case onlyErr != nil:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", onlyErr)
+		default:
+			fmt.Fprintln(os.Stderr, "Error: All sources were excluded")
+		}
+		os.Exit(exitUsage)
+	}
+	if opts.cacheTTL > 0 {
+		sources = weather.WithResponseCache(sources, weather.NewMemoryCache(opts.cacheTTL))
+	}
+	agg := newAggregator(opts, sources)
+	for _, s := range sources {
+		opts.sourceOrder = append(opts.sourceOrder, s.Name())
+	}
+	for _, s := range agg.AirQuality {
+		opts.sourceOrder = append(opts.sourceOrder, s.Name())
+	}
+
+	if opts.check {
+		os.Exit(runCheck(agg, opts))
+	}
+	if cities, _ := parseWarmUpCities(opts.warmUp); len(cities) > 0 {
+		warmUp(agg, cities)
+	}
+	if opts.serve != "" {
+		if err := serve(opts.serve, agg, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	if len(cities) > 1 {
+		os.Exit(runBatch(cities, agg, opts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
 	defer cancel()
 
-	data := runWeatherFetch(ctx, cityName, sources, sequential)
-	displayResults(data)
+	var cityName string
+	if locating(opts) {
+		if cityName, err = autoLocate(ctx, agg); err != nil {
+			printCityValidationError(fmt.Errorf("could not determine your location (%v); pass --city instead", err))
+			os.Exit(exitUsage)
+		}
+	} else {
+		cityName = cities[0]
+	}
+	if opts.watch > 0 {
+		cancel()
+		os.Exit(runWatch(agg, cityName, opts))
+	}
+	data := runOnce(ctx, agg, cityName, opts)
+	if code := runExitCode(os.Stderr, data, opts); code != exitOK {
+		cancel()
+		os.Exit(code)
+	}
 }
@@ -0,0 +1,1242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"weather-aggregator/weather"
+)
+
+func init() {
+	if err := weather.LoadWeatherCodes(""); err != nil {
+		panic(err)
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestValidateCityName(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantCity  string
+		wantError bool
+	}{
+		{"valid single", "Munich", "Munich", false},
+		{"valid multi-word", "New York", "New York", false},
+		{"valid Unicode", "São Paulo", "São Paulo", false},
+		{"valid with dash", "Baden-Baden", "Baden-Baden", false},
+		{"empty string", "", "", true},
+		{"only whitespace", "   ", "", true},
+		{"dash prefix", "-Baden-Baden", "", true},
+		{"exceeds max length", "A" + string(make([]byte, 100)), "", true},
+		{"invalid char @", "City@Name", "", true},
+		{"numeric", "123", "123", false},
+		{"too short", "A", "", true},
+		{"embedded newline", "New\nYork", "", true},
+		{"null byte", "Zürich\x00", "", true},
+		{"100 multi-byte runes", strings.Repeat("ü", 100), strings.Repeat("ü", 100), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateCityName(tt.input)
+			if (err != nil) != tt.wantError {
+				t.Errorf("error = %v, wantErr = %v", err, tt.wantError)
+			}
+			if got != tt.wantCity {
+				t.Errorf("got %q, want %q", got, tt.wantCity)
+			}
+		})
+	}
+}
+
+func TestConvertTemp(t *testing.T) {
+	tests := []struct {
+		unit       string
+		celsius    float64
+		wantValue  float64
+		wantSymbol string
+	}{
+		{"metric", 20, 20, "°C"},
+		{"imperial", 20, 68, "°F"},
+		{"imperial", -40, -40, "°F"},
+		{"standard", 0, 273.15, "K"},
+		{"", 12.5, 12.5, "°C"},
+	}
+
+	for _, tt := range tests {
+		got, symbol := convertTemp(tt.celsius, tt.unit)
+		if math.Abs(got-tt.wantValue) > 1e-9 || symbol != tt.wantSymbol {
+			t.Errorf("convertTemp(%.2f, %q) = %.2f%s, want %.2f%s", tt.celsius, tt.unit, got, symbol, tt.wantValue, tt.wantSymbol)
+		}
+	}
+
+	if err := validateOptions(options{units: "kelvin", format: "text"}); err == nil {
+		t.Error("expected error for unknown units")
+	}
+}
+
+func TestBuildResultsJSON(t *testing.T) {
+	data := []weather.WeatherData{
+		{Source: "A", Temperature: 10, Humidity: floatPtr(40), Condition: "Clear", Duration: 120 * time.Millisecond},
+		{Source: "B", Temperature: 0, Condition: "Clear"},
+		{Source: "C", Error: errors.New("test error")},
+	}
+
+	opts := options{units: "metric", aggregate: "mean"}
+	b, err := json.Marshal(buildResultsJSON("X", data, opts))
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	want := `{"city":"X","unit":"°C","sources":[` +
+		`{"source":"A","temperature":10,"humidity":40,"condition":"Clear","duration_ms":120},` +
+		`{"source":"B","temperature":0,"condition":"Clear","duration_ms":0},` +
+		`{"source":"C","error":"test error","duration_ms":0}],` +
+		`"aggregated":{"method":"mean","avg_temperature":5,"min_temperature":0,"max_temperature":10,"coolest_source":"B","warmest_source":"A","temperature_stddev":5,"low_agreement":true,"avg_humidity":40,"consensus":"Clear","consensus_agreement":1,"votes":{"Clear":2},"valid":2,"total":3}}`
+	if string(b) != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+
+	if out := buildResultsJSON("X", data[2:], opts); out.Aggregated.Valid != 0 || out.Aggregated.AvgTemperature != nil {
+		t.Errorf("all-error aggregate = %+v, want valid 0 and no temperature", out.Aggregated)
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	// arrival order differs between runs; the document must not
+	data := []weather.WeatherData{
+		{Source: "Tomorrow.io", Temperature: 11, Condition: "Clear"},
+		{Source: "Meteosource", Error: errors.New("HTTP 401")},
+		{Source: "Open-Meteo", Temperature: 10, Humidity: floatPtr(40), Condition: "Clear"},
+	}
+	reversed := slices.Clone(data)
+	slices.Reverse(reversed)
+	opts := options{units: "metric", aggregate: "mean", format: "json"}
+	var compact, again, pretty bytes.Buffer
+	if err := encodeJSON(&compact, buildResultsJSON("X", data, opts), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeJSON(&again, buildResultsJSON("X", reversed, opts), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeJSON(&pretty, buildResultsJSON("X", data, opts), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if compact.String() != again.String() {
+		t.Errorf("output depends on arrival order:\n%s%s", compact.String(), again.String())
+	}
+	if strings.Count(compact.String(), "\n") != 1 {
+		t.Errorf("compact output spans several lines:\n%s", compact.String())
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact.Bytes(), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	if pretty.String() != indented.String() {
+		t.Errorf("pretty output:\n%s\nwant the compact document indented:\n%s", pretty.String(), indented.String())
+	}
+	if !strings.Contains(pretty.String(), "\n  \"sources\": [\n    {\n      \"source\": \"Open-Meteo\"") {
+		t.Errorf("pretty output lacks two-space indentation or name order:\n%s", pretty.String())
+	}
+
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, pretty: true}); err == nil {
+		t.Error("--pretty accepted with text output")
+	}
+}
+
+func TestRawConditionText(t *testing.T) {
+	code := 61
+	tests := []struct {
+		data weather.WeatherData
+		want string
+	}{
+		{weather.WeatherData{Condition: "Rainy", RawCode: &code}, ` [raw: code 61 → Rainy]`},
+		{weather.WeatherData{Condition: "Light drizzle", RawCondition: "Light drizzle", RawCode: &code}, ` [raw: code 61, "Light drizzle" → Rainy]`},
+		{weather.WeatherData{Condition: "Mostly sunny", RawCondition: "Mostly sunny"}, ` [raw: "Mostly sunny" → Clear]`},
+		{weather.WeatherData{Condition: "Weird"}, ` [raw: n/a → Weird]`},
+	}
+
+	for _, tt := range tests {
+		if got := rawConditionText(tt.data); got != tt.want {
+			t.Errorf("rawConditionText(%+v) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseCityList(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    options
+		want    []string
+		wantErr bool
+	}{
+		{"single city", options{city: "New York"}, []string{"New York"}, false},
+		{"city list", options{cities: "Berlin, São Paulo,,Rome "}, []string{"Berlin", "São Paulo", "Rome"}, false},
+		{"both flags", options{city: "Berlin", cities: "Rome"}, nil, true},
+		{"invalid entry", options{cities: "Berlin,Ci@ty"}, nil, true},
+		{"empty list", options{cities: " , "}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCityList(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStdinCities(t *testing.T) {
+	cities, err := readCityLines(strings.NewReader("Berlin\n\n  São Paulo  \r\nRome"))
+	if err != nil || !slices.Equal(cities, []string{"Berlin", "São Paulo", "Rome"}) {
+		t.Fatalf("readCityLines = %q, %v; want three cities", cities, err)
+	}
+	for _, in := range []string{"", " \n\n", "Berlin\nCi@ty\n"} {
+		if _, err := readCityLines(strings.NewReader(in)); err == nil {
+			t.Errorf("readCityLines(%q) accepted", in)
+		}
+	}
+
+	opts := options{units: "metric", format: "json", aggregate: "mean", timeout: defaultRunTimeout, fixtures: "fixtures", stdin: true}
+	if err := validateOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	all, err := loadSources("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := newAggregator(opts, all[:1])
+	out := captureStdout(t, func() { runBatch(cities, agg, opts) })
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("output has %d lines, want one JSON record per city:\n%s", len(lines), out)
+	}
+	for i, line := range lines {
+		var doc struct {
+			City string `json:"city"`
+		}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil || doc.City != cities[i] {
+			t.Errorf("record %d = %s (%v), want %s", i, line, err, cities[i])
+		}
+	}
+
+	opts.city = "Berlin"
+	if err := validateOptions(opts); err == nil {
+		t.Error("--stdin with --city accepted")
+	}
+}
+
+func TestParseWarmUpCities(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cities.txt")
+	if err := os.WriteFile(file, []byte("# hot cities\nBerlin\n\n  São Paulo  \nNew York\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"Berlin, Rome,,Oslo", []string{"Berlin", "Rome", "Oslo"}, false},
+		{"@" + file, []string{"Berlin", "São Paulo", "New York"}, false},
+		{"@" + file + ".missing", nil, true},
+		{"Berlin,Ci@ty", nil, true},
+		{" , ", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWarmUpCities(tt.spec)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("parseWarmUpCities(%q) = %q, %v; want %q, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	base := options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, coordCache: "coords.json", warmUp: "Berlin"}
+	if err := validateOptions(base); err == nil {
+		t.Error("--warm-up without --serve/--watch accepted")
+	}
+	base.serve = ":8080"
+	if err := validateOptions(base); err != nil {
+		t.Errorf("--warm-up with --serve: %v", err)
+	}
+	base.coordCache = ""
+	if err := validateOptions(base); err == nil {
+		t.Error("--warm-up without a coordinate cache accepted")
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon string
+		want     *[2]float64
+		wantErr  bool
+	}{
+		{"unset", "", "", nil, false},
+		{"valid", "52.52", "-13.4", &[2]float64{52.52, -13.4}, false},
+		{"bounds", "-90", "180", &[2]float64{-90, 180}, false},
+		{"lat only", "52.52", "", nil, true},
+		{"lon only", "", "13.4", nil, true},
+		{"lat out of range", "90.1", "0", nil, true},
+		{"lon out of range", "0", "-180.5", nil, true},
+		{"not a number", "north", "0", nil, true},
+		{"NaN", "NaN", "0", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLocation(tt.lat, tt.lon)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", cities: "A,B", lat: "1", lon: "2"}); err == nil {
+		t.Error("expected error for --lat/--lon with --cities")
+	}
+}
+
+func TestValidateCountry(t *testing.T) {
+	base := options{units: "metric", format: "text", aggregate: "mean", timeout: defaultRunTimeout}
+	for country, wantErr := range map[string]bool{"": false, "US": false, "de": false, "USA": true, "1A": true} {
+		opts := base
+		opts.country = country
+		if err := validateOptions(opts); (err != nil) != wantErr {
+			t.Errorf("country %q: error = %v, wantErr = %v", country, err, wantErr)
+		}
+	}
+
+	opts := base
+	opts.lat, opts.lon, opts.admin = "1", "2", "Illinois"
+	if err := validateOptions(opts); err == nil {
+		t.Error("expected error for --admin with --lat/--lon")
+	}
+}
+
+func TestSpreadText(t *testing.T) {
+	res := weather.Aggregate([]weather.WeatherData{
+		{Source: "A", Temperature: 12.1},
+		{Source: "B", Temperature: 14.2},
+		{Source: "C", Temperature: 16.3},
+	})
+	if got, want := spreadText(res, options{units: "metric"}), " (range 12.1–16.3, σ=1.7)"; got != want {
+		t.Errorf("metric = %q, want %q", got, want)
+	}
+	if got, want := spreadText(res, options{units: "imperial"}), " (range 53.8–61.3, σ=3.1)"; got != want {
+		t.Errorf("imperial = %q, want %q", got, want)
+	}
+	if got := spreadText(weather.Aggregate([]weather.WeatherData{{Source: "A", Temperature: 5}}), options{units: "metric"}); got != "" {
+		t.Errorf("single reading = %q, want empty", got)
+	}
+}
+
+func TestTrimmedAggregate(t *testing.T) {
+	data := []weather.WeatherData{
+		{Source: "A", Temperature: 14, Humidity: floatPtr(70)},
+		{Source: "B", Temperature: -3, Humidity: floatPtr(10)}, // broken low
+		{Source: "C", Temperature: 15, Humidity: floatPtr(72)},
+		{Source: "D", Temperature: 35, Humidity: floatPtr(99)}, // broken high
+		{Source: "E", Temperature: 16.5, Humidity: floatPtr(77)},
+	}
+	opts := options{units: "metric", format: "json", aggregate: "trimmed", trimPct: 20, timeout: defaultRunTimeout}
+	if err := validateOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	// B and D are dropped: (14+15+16.5)/3 and (70+72+77)/3
+	agg := buildResultsJSON("Berlin", data, opts).Aggregated
+	if agg.Method != "trimmed" || agg.AvgTemperature == nil || math.Abs(*agg.AvgTemperature-15.1666666) > 1e-6 || math.Abs(*agg.AvgHumidity-73) > 1e-9 {
+		t.Errorf("aggregate = %s %v°C %v%%, want trimmed 15.17°C 73%%", agg.Method, *agg.AvgTemperature, *agg.AvgHumidity)
+	}
+	if mean := aggregate(data, options{aggregate: "mean"}); mean.AvgTemp != 15.5 {
+		t.Errorf("mean = %v, want 15.5 with the broken sources", mean.AvgTemp)
+	}
+	// fewer than 3 valid sources degrade to the plain mean
+	if res := aggregate(data[:2], opts); res.AvgTemp != 5.5 {
+		t.Errorf("two sources: %v, want the mean 5.5", res.AvgTemp)
+	}
+
+	for _, pct := range []float64{0, -5, 50, math.NaN()} {
+		opts.trimPct = pct
+		if err := validateOptions(opts); err == nil {
+			t.Errorf("--trim-pct %v accepted", pct)
+		}
+	}
+}
+
+func TestValidateStream(t *testing.T) {
+	base := options{units: "metric", format: "text", aggregate: "mean", timeout: defaultRunTimeout, stream: true}
+	if err := validateOptions(base); err != nil {
+		t.Errorf("text stream rejected: %v", err)
+	}
+	opts := base
+	opts.format = "json"
+	if err := validateOptions(opts); err == nil {
+		t.Error("expected error for --stream with JSON output")
+	}
+	opts = base
+	opts.cities = "A,B"
+	if err := validateOptions(opts); err == nil {
+		t.Error("expected error for --stream with --cities")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for level, want := range map[string]slog.Level{"": slog.LevelWarn, "debug": slog.LevelDebug, "INFO": slog.LevelInfo, "error": slog.LevelError} {
+		if got, err := parseLogLevel(level); err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", level, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestParseForecast(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    weather.ForecastSpec
+		wantErr bool
+	}{
+		{"", weather.ForecastSpec{}, false},
+		{"12h", weather.ForecastSpec{Hours: 12}, false},
+		{"3d", weather.ForecastSpec{Days: 3}, false},
+		{"48h", weather.ForecastSpec{Hours: 48}, false},
+		{"49h", weather.ForecastSpec{}, true},
+		{"8d", weather.ForecastSpec{}, true},
+		{"0h", weather.ForecastSpec{}, true},
+		{"3w", weather.ForecastSpec{}, true},
+		{"h", weather.ForecastSpec{}, true},
+		{"twelve", weather.ForecastSpec{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseForecast(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseForecast(%q) = %+v, %v; want %+v, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestForecastLine(t *testing.T) {
+	at := time.Date(2026, 10, 13, 14, 0, 0, 0, time.UTC)
+	if got, want := forecastLine(weather.ForecastPoint{Time: at, Temperature: 12.34, Condition: "Cloudy"}, options{units: "metric"}), "Tue 14:00    12.3°C  Cloudy ☁️"; got != want {
+		t.Errorf("hourly = %q, want %q", got, want)
+	}
+	daily := weather.ForecastPoint{Time: at, Temperature: 20, Low: floatPtr(10), Condition: "Clear"}
+	if got, want := forecastLine(daily, options{units: "imperial"}), "Tue 13 Oct   50.0–68.0°F  Clear ☀️"; got != want {
+		t.Errorf("daily = %q, want %q", got, want)
+	}
+}
+
+func TestSunTimesJSON(t *testing.T) {
+	zone := time.FixedZone("", 2*3600)
+	rise, set := time.Date(2026, 10, 14, 7, 24, 0, 0, zone), time.Date(2026, 10, 14, 18, 31, 0, 0, zone)
+	data := []weather.WeatherData{
+		{Source: "A", Error: errors.New("down"), Sunrise: &set, Sunset: &set},
+		{Source: "B", Temperature: 10},
+		{Source: "C", Temperature: 11, Sunrise: &rise, Sunset: &set},
+	}
+	if r, s := sunTimes(data); r != &rise || s != &set {
+		t.Errorf("sunTimes = %v, %v; want the first valid source's times", r, s)
+	}
+	out := buildResultsJSON("X", data, options{units: "metric", aggregate: "mean"})
+	if c := jsonSource(out, "C"); c.Sunrise != "2026-10-14T07:24:00+02:00" || c.Sunset != "2026-10-14T18:31:00+02:00" {
+		t.Errorf("JSON sunrise/sunset = %q / %q", c.Sunrise, c.Sunset)
+	}
+	if b := jsonSource(out, "B"); b.Sunrise != "" {
+		t.Errorf("source without sun times has sunrise %q", b.Sunrise)
+	}
+}
+
+func TestObservedText(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	zone := time.FixedZone("", 2*3600)
+	fresh, old := now.Add(-20*time.Minute).In(zone), now.Add(-3*time.Hour)
+	tests := []struct {
+		d    weather.WeatherData
+		want string
+	}{
+		{weather.WeatherData{ObservedAt: &fresh}, "as of 13:40"},
+		{weather.WeatherData{ObservedAt: &old}, "as of 09:00, stale"},
+		{weather.WeatherData{}, ""},
+	}
+	for _, tt := range tests {
+		if got := observedText(tt.d, now); got != tt.want {
+			t.Errorf("observedText(%v) = %q, want %q", tt.d.ObservedAt, got, tt.want)
+		}
+	}
+
+	out := buildResultsJSON("X", []weather.WeatherData{{Source: "A", Temperature: 10, ObservedAt: &old}}, options{units: "metric", aggregate: "mean"})
+	if a := jsonSource(out, "A"); a.ObservedAt != old.Format(time.RFC3339) || !a.Stale {
+		t.Errorf("JSON observed_at = %q, stale = %v", a.ObservedAt, a.Stale)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	fresh, cached := time.Now().Add(-5*time.Minute), time.Now().Add(-3*time.Hour)
+	data := []weather.WeatherData{
+		{Source: "A", Temperature: 10, Condition: "Rain", ObservedAt: &fresh},
+		{Source: "B", Temperature: 12, Condition: "Rain", ObservedAt: &fresh},
+		{Source: "C", Temperature: 25, Condition: "Clear", ObservedAt: &cached},
+	}
+	opts := options{units: "metric", aggregate: "mean"}
+	if out := buildResultsJSON("X", rejectReadings(data, opts), opts); out.Aggregated.Valid != 3 || out.Aggregated.Stale != 0 {
+		t.Errorf("without --max-age: %d valid, %d stale; want 3, 0", out.Aggregated.Valid, out.Aggregated.Stale)
+	}
+
+	opts.maxAge = time.Hour
+	out := buildResultsJSON("X", rejectReadings(data, opts), opts)
+	if agg := out.Aggregated; agg.Valid != 2 || agg.Stale != 1 || *agg.AvgTemperature != 11 {
+		t.Errorf("--max-age 1h: %d valid, %d stale, avg %v; want 2, 1, 11", agg.Valid, agg.Stale, *agg.AvgTemperature)
+	}
+	if c := jsonSource(out, "C"); !strings.Contains(c.Error, "stale") {
+		t.Errorf("stale source error = %q", c.Error)
+	}
+	if got := strictFailures(rejectReadings(data, opts), "all"); len(got) != 0 {
+		t.Errorf("--strict counts stale exclusions as failures: %v", got)
+	}
+}
+
+// jsonSource returns the entry of the named source in out.
+func jsonSource(out resultsJSON, name string) sourceJSON {
+	for _, s := range out.Sources {
+		if s.Source == name {
+			return s
+		}
+	}
+	return sourceJSON{}
+}
+
+func TestAlertLine(t *testing.T) {
+	expires := time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		alert weather.Alert
+		want  string
+	}{
+		{weather.Alert{Title: "Wind Advisory", Severity: "Moderate", Expires: &expires, Sources: []string{"Pirate-Weather", "WeatherAPI.com"}},
+			"Wind Advisory [Moderate] until Wed 18:00 (Pirate-Weather, WeatherAPI.com)"},
+		{weather.Alert{Title: "Flood Watch"}, "Flood Watch"},
+	}
+	for _, tt := range tests {
+		if got := alertLine(tt.alert); got != tt.want {
+			t.Errorf("alertLine = %q, want %q", got, tt.want)
+		}
+	}
+
+	data := []weather.WeatherData{
+		{Source: "A", Temperature: 10, Alerts: []weather.Alert{{Title: "Wind Advisory", Expires: &expires, Sources: []string{"A"}}}},
+		{Source: "B", Temperature: 11, Alerts: []weather.Alert{{Title: "Wind Advisory", Sources: []string{"B"}}}},
+	}
+	out := buildResultsJSON("X", data, options{units: "metric", aggregate: "mean"})
+	if a := out.Aggregated.Alerts; len(a) != 1 || a[0].Expires != "2026-10-14T18:00:00Z" || len(a[0].Sources) != 2 {
+		t.Errorf("JSON alerts = %+v, want one deduplicated alert from both sources", a)
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 12, Duration: 300 * time.Millisecond},
+		{Source: "broken", Error: errors.New("down"), Duration: time.Millisecond},
+		{Source: "WeatherAPI.com", Temperature: 9, Duration: 100 * time.Millisecond},
+		{Source: "Open-Meteo AQ", AirQuality: true, Duration: 50 * time.Millisecond},
+		{Source: "Meteosource", Temperature: 11, Duration: 200 * time.Millisecond},
+	}
+	order := []string{"Open-Meteo", "Meteosource", "WeatherAPI.com", "broken", "Open-Meteo AQ"}
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"", []string{"Open-Meteo", "broken", "WeatherAPI.com", "Open-Meteo AQ", "Meteosource"}},
+		{"name", []string{"Meteosource", "Open-Meteo", "Open-Meteo AQ", "WeatherAPI.com", "broken"}},
+		{"temp", []string{"WeatherAPI.com", "Meteosource", "Open-Meteo", "Open-Meteo AQ", "broken"}},
+		{"speed", []string{"Open-Meteo AQ", "WeatherAPI.com", "Meteosource", "Open-Meteo", "broken"}},
+		{"source", []string{"Open-Meteo", "Meteosource", "WeatherAPI.com", "Open-Meteo AQ", "broken"}},
+	}
+	for _, tt := range tests {
+		sorted := sortResults(data, tt.mode, order)
+		var got []string
+		for _, d := range sorted {
+			got = append(got, d.Source)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("sort %q = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+	if data[0].Source != "Open-Meteo" || data[1].Source != "broken" {
+		t.Error("sortResults modified its input")
+	}
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", sort: "fastest"}); err == nil {
+		t.Error("expected error for unknown sort mode")
+	}
+}
+
+// fakeTransport answers every request with body and records the requested URLs.
+type fakeTransport struct {
+	body   string
+	urls   []string
+	agents []string // User-Agent of each request
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.urls = append(f.urls, req.URL.String())
+	f.agents = append(f.agents, req.Header.Get("User-Agent"))
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(f.body)), Request: req}, nil
+}
+
+func TestExitCodeFor(t *testing.T) {
+	ok := weather.WeatherData{Source: "A", Temperature: 10}
+	failed := weather.WeatherData{Source: "B", Error: errors.New("timeout")}
+	outlier := weather.WeatherData{Source: "C", Error: fmt.Errorf("%w: far off", weather.ErrOutlier)}
+	air := weather.WeatherData{Source: "Air", AirQuality: true}
+	airFailed := weather.WeatherData{Source: "Air", AirQuality: true, Error: errors.New("down")}
+	tests := []struct {
+		name string
+		data []weather.WeatherData
+		want int
+	}{
+		{"all ok", []weather.WeatherData{ok, ok, air}, exitOK},
+		{"one failed", []weather.WeatherData{ok, failed}, exitPartial},
+		{"outlier rejected", []weather.WeatherData{ok, ok, outlier}, exitPartial},
+		{"air quality failed", []weather.WeatherData{ok, airFailed}, exitPartial},
+		{"all failed", []weather.WeatherData{failed, outlier}, exitFailure},
+		{"only air quality", []weather.WeatherData{air}, exitFailure},
+		{"no results", nil, exitFailure},
+	}
+	for _, tt := range tests {
+		if got := exitCodeFor(tt.data); got != tt.want {
+			t.Errorf("%s: exitCodeFor = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStrictExitCode(t *testing.T) {
+	ok := weather.WeatherData{Source: "A", Temperature: 10}
+	network := weather.WeatherData{Source: "B", Error: errors.New("request failed: connection reset")}
+	auth := weather.WeatherData{Source: "WeatherAPI.com", Error: fmt.Errorf("weather request failed: %w", weather.ErrAuth)}
+	outlier := weather.WeatherData{Source: "C", Error: fmt.Errorf("%w: far off", weather.ErrOutlier)}
+	tests := []struct {
+		name string
+		mode strictMode
+		data []weather.WeatherData
+		want int
+	}{
+		{"off", "", []weather.WeatherData{ok, network, auth}, exitPartial},
+		{"all ok", "all", []weather.WeatherData{ok, ok}, exitOK},
+		{"network error", "all", []weather.WeatherData{ok, network}, exitStrict},
+		{"outliers don't count", "all", []weather.WeatherData{ok, outlier}, exitPartial},
+		{"nothing valid", "all", []weather.WeatherData{network}, exitStrict},
+		{"auth ignores the network", "auth", []weather.WeatherData{ok, network}, exitPartial},
+		{"auth failure", "auth", []weather.WeatherData{ok, network, auth, auth}, exitStrict},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if got := runExitCode(&buf, tt.data, options{strict: tt.mode}); got != tt.want {
+			t.Errorf("%s: exit code = %d, want %d", tt.name, got, tt.want)
+		}
+		if (buf.Len() > 0) != (tt.want == exitStrict) {
+			t.Errorf("%s: output %q, want the failures listed only for exitStrict", tt.name, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	runExitCode(&buf, []weather.WeatherData{ok, network, auth, auth}, options{strict: "auth"})
+	want := "Strict mode, failed sources:\n  WeatherAPI.com: invalid API key (weather request failed: authentication failed)\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+
+	for _, tt := range []struct {
+		arg  string
+		want strictMode
+	}{{"--strict", "all"}, {"--strict=auth", "auth"}, {"--strict=false", ""}} {
+		var m strictMode
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Var(&m, "strict", "")
+		if err := fs.Parse([]string{tt.arg}); err != nil || m != tt.want {
+			t.Errorf("%s: mode %q, %v; want %q", tt.arg, m, err, tt.want)
+		}
+	}
+	if err := new(strictMode).Set("network"); err == nil {
+		t.Error("--strict=network accepted")
+	}
+}
+
+func TestTimeoutFlag(t *testing.T) {
+	parse := func(args ...string) options {
+		t.Helper()
+		oldArgs, oldFlags := os.Args, flag.CommandLine
+		defer func() { os.Args, flag.CommandLine = oldArgs, oldFlags }()
+		os.Args = append([]string{"weather-aggregator"}, args...)
+		flag.CommandLine = flag.NewFlagSet("weather-aggregator", flag.ContinueOnError)
+		return parseFlags()
+	}
+	if opts := parse("--city", "Berlin"); opts.timeout != defaultRunTimeout {
+		t.Errorf("default timeout = %v, want %v", opts.timeout, defaultRunTimeout)
+	}
+	opts := parse("--city", "Berlin", "--timeout", "2s")
+	if opts.timeout != 2*time.Second {
+		t.Errorf("timeout = %v, want 2s", opts.timeout)
+	}
+	// The run context carries the deadline; a client Timeout could cut it short
+	if c := newHTTPClient(opts); c.Timeout != 0 {
+		t.Errorf("client timeout = %v, want none", c.Timeout)
+	}
+	for _, d := range []time.Duration{0, -time.Second} {
+		if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", timeout: d}); err == nil {
+			t.Errorf("timeout %v accepted", d)
+		}
+	}
+}
+
+// captureStdout returns what fn prints to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = wr
+	defer func() { os.Stdout = orig }()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(rd)
+		done <- string(b)
+	}()
+	fn()
+	wr.Close()
+	return <-done
+}
+
+func TestPlainOutput(t *testing.T) {
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 14.2, Humidity: floatPtr(71), Condition: "Rainy", Duration: 120 * time.Millisecond},
+		{Source: "Tomorrow.io", Temperature: 13.8, Humidity: floatPtr(75), Condition: "Light Rain", Duration: 80 * time.Millisecond},
+		{Source: "Meteosource", Error: errors.New("HTTP 401"), Duration: 30 * time.Millisecond},
+	}
+	render := func(plain bool) string {
+		opts := options{units: "metric", aggregate: "mean", plain: plain}
+		return captureStdout(t, func() {
+			for _, d := range data {
+				printSource(d, opts)
+			}
+			printAggregate(data, opts)
+		})
+	}
+	want := `[OK] Open-Meteo:        14.2°C, 71% humidity, Rainy (120ms)
+[OK] Tomorrow.io:       13.8°C, 75% humidity, Light Rain (80ms)
+[ERR] Meteosource:       ERROR: HTTP 401 (30ms)
+
+Aggregated (2/3 valid):
+→ Avg Temperature: 14.00°C (range 13.8–14.2, σ=0.2)
+→ Range:           coolest Tomorrow.io 13.8°C, warmest Open-Meteo 14.2°C
+→ Avg Humidity:    73.0%
+→ Consensus:       Rainy (2/2, 100%)
+`
+	if got := render(true); got != want {
+		t.Errorf("plain output:\n%s\nwant:\n%s", got, want)
+	}
+	// Only the decorations differ, the data stays the same
+	fancy := render(false)
+	for _, s := range []string{"✅ Open-Meteo:", "❌ Meteosource:", "📊 Aggregated (2/3 valid):", "14.00°C (range 13.8–14.2, σ=0.2)", "Consensus:       Rainy 🌧️"} {
+		if !strings.Contains(fancy, s) {
+			t.Errorf("decorated output lacks %q:\n%s", s, fancy)
+		}
+	}
+
+	var buf bytes.Buffer
+	printSourceList(&buf, []weather.SourceInfo{{Name: "Open-Meteo"}, {Name: "Tomorrow.io", EnvKey: "TOMORROW_API_KEY"}}, options{plain: true})
+	if got := buf.String(); !strings.Contains(got, "  [OK]  Open-Meteo ") || !strings.Contains(got, "  [ERR] Tomorrow.io ") {
+		t.Errorf("plain source list:\n%s", got)
+	}
+}
+
+func TestCompareDeltas(t *testing.T) {
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 13.5},
+		{Source: "WeatherAPI.com", Temperature: 14.9},
+		{Source: "Meteosource", Error: errors.New("HTTP 401")},
+		{Source: "Air Quality", AirQuality: true},
+		{Source: "Pirate-Weather", Temperature: 10.6},
+	}
+	res := weather.Aggregate(data)
+	center := res.AvgTemp
+	got := compareDeltas(data, center)
+	want := []struct {
+		source string
+		delta  float64
+		off    bool
+	}{{"Open-Meteo", 0.5, false}, {"WeatherAPI.com", 1.9, false}, {"Pirate-Weather", -2.4, true}}
+	if len(got) != len(want) {
+		t.Fatalf("deltas = %+v, want %d entries", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Source != w.source || math.Abs(got[i].Delta-w.delta) > 1e-9 || got[i].Off() != w.off {
+			t.Errorf("delta %d = %+v (off %v), want %s %+.1f (off %v)", i, got[i], got[i].Off(), w.source, w.delta, w.off)
+		}
+	}
+
+	out := captureStdout(t, func() {
+		printComparison(data, options{units: "imperial", aggregate: "mean", compare: true, plain: true})
+	})
+	for _, line := range []string{"WeatherAPI.com:    +3.4°F", "Pirate-Weather:    -4.3°F  [WARN] off by more than 3.6°F"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("comparison lacks %q:\n%s", line, out)
+		}
+	}
+	doc := buildResultsJSON("Berlin", data, options{units: "metric", aggregate: "mean", compare: true})
+	if d := jsonSource(doc, "WeatherAPI.com").Delta; d == nil || math.Abs(*d-1.9) > 1e-9 || jsonSource(doc, "Meteosource").Delta != nil {
+		t.Errorf("JSON deltas = %v, %v; want +1.9 and none for the failed source", d, jsonSource(doc, "Meteosource").Delta)
+	}
+}
+
+// TestSourceTable compares the rendered table with testdata/source_table*.golden.
+// Regenerate the files with UPDATE_GOLDEN=1 go test -run SourceTable.
+func TestSourceTable(t *testing.T) {
+	aqi := 42
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 14.2, FeelsLike: floatPtr(12.9), Humidity: floatPtr(71), DewPoint: floatPtr(9), WindSpeed: floatPtr(3.4), Pressure: floatPtr(1012.5), Condition: "Rainy", Trend: weather.TrendRising, Duration: 120 * time.Millisecond},
+		{Source: "Tomorrow.io", Temperature: 13.8, Humidity: floatPtr(75), Condition: "Light Rain", Duration: 80 * time.Millisecond},
+		{Source: "Meteosource", Error: errors.New("HTTP 401"), Duration: 30 * time.Millisecond},
+		{Source: "Visual Crossing", Temperature: 14.1, Condition: "Partially cloudy", Duration: 1450 * time.Millisecond},
+		{Source: "Pirate-Weather", Temperature: 21, Error: fmt.Errorf("%w: 21.0°C is 3.1σ from the median", weather.ErrOutlier), Duration: 95 * time.Millisecond},
+		{Source: "Air Quality", AirQuality: true, AQI: &aqi, PM25: floatPtr(8.2), Duration: 60 * time.Millisecond},
+	}
+	for _, tt := range []struct {
+		file  string
+		plain bool
+	}{
+		{"testdata/source_table.golden", false},
+		{"testdata/source_table_plain.golden", true},
+	} {
+		var buf bytes.Buffer
+		printSourceTable(&buf, data, options{units: "metric", plain: tt.plain})
+		if os.Getenv("UPDATE_GOLDEN") != "" {
+			if err := os.WriteFile(tt.file, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != string(want) {
+			t.Errorf("%s differs:\n%s\nwant:\n%s", tt.file, got, want)
+		}
+	}
+}
+
+func TestPrettyTable(t *testing.T) {
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 14.2, FeelsLike: floatPtr(12.9), Humidity: floatPtr(71), WindSpeed: floatPtr(3.4), Condition: "Rainy", Duration: 120 * time.Millisecond},
+		{Source: "Tomorrow.io", Temperature: 13.8, FeelsLike: floatPtr(12.1), Humidity: floatPtr(75), WindSpeed: floatPtr(4.1), Condition: "Rainy", Duration: 80 * time.Millisecond},
+		{Source: "Visual Crossing", Temperature: 14.6, Condition: "Partially cloudy", Duration: 1450 * time.Millisecond},
+		{Source: "Meteosource", Error: errors.New("HTTP 401"), Duration: 30 * time.Millisecond},
+		{Source: "Pirate-Weather", Error: fmt.Errorf("%w: 21.0°C is 3.1σ from the median", weather.ErrOutlier), Duration: 95 * time.Millisecond},
+		{Source: "Air Quality", AirQuality: true, PM25: floatPtr(8.2), Duration: 60 * time.Millisecond},
+	}
+	for _, tt := range []struct {
+		file  string
+		units string
+	}{
+		{"testdata/pretty_table.golden", "metric"},
+		{"testdata/pretty_table_imperial.golden", "imperial"},
+	} {
+		var buf bytes.Buffer
+		if valid := printPrettyTable(&buf, data, options{units: tt.units, aggregate: "mean"}); valid != 3 {
+			t.Errorf("%s: valid = %d, want 3", tt.file, valid)
+		}
+		if os.Getenv("UPDATE_GOLDEN") != "" {
+			if err := os.WriteFile(tt.file, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != string(want) {
+			t.Errorf("%s differs:\n%s\nwant:\n%s", tt.file, got, want)
+		}
+	}
+}
+
+func TestPlainOutputDetection(t *testing.T) {
+	f, err := os.Create(t.TempDir() + "/out.txt") // a regular file, like a pipe or redirect
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tests := []struct {
+		noColor           bool
+		noColorEnv, force string
+		want              bool
+	}{
+		{false, "", "", true},
+		{false, "", "1", false},
+		{true, "", "1", true},
+		{false, "1", "1", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColorEnv)
+		t.Setenv("FORCE_COLOR", tt.force)
+		if got := plainOutput(tt.noColor, f); got != tt.want {
+			t.Errorf("plainOutput(%v) with NO_COLOR=%q FORCE_COLOR=%q = %v, want %v", tt.noColor, tt.noColorEnv, tt.force, got, tt.want)
+		}
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	fake := &fakeTransport{body: `{"current":{"temperature_2m":7.5,"relative_humidity_2m":60,"weather_code":0}}`}
+	opts := options{lat: "52.52", lon: "13.41", transport: fake}
+	agg := newAggregator(opts, []weather.WeatherSource{&weather.OpenMeteoSource{}})
+	data, err := agg.Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.urls) != 1 || !strings.HasPrefix(fake.urls[0], "https://api.open-meteo.com/") {
+		t.Errorf("requests = %v, want one Open-Meteo request through the injected transport", fake.urls)
+	}
+	if data[0].Error != nil || data[0].Temperature != 7.5 {
+		t.Errorf("result = %.1f, %v; want the fake response", data[0].Temperature, data[0].Error)
+	}
+
+	tr, ok := newHTTPClient(options{}).Transport.(*http.Transport)
+	if !ok || tr.Proxy == nil {
+		t.Fatal("default transport must take proxies from the environment")
+	}
+
+	// --insecure accepts the test server's self-signed certificate
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	if _, err := newHTTPClient(options{}).Get(srv.URL); err == nil {
+		t.Error("expected a certificate error without --insecure")
+	}
+	resp, err := newHTTPClient(options{insecure: true}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("--insecure request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestUserAgent(t *testing.T) {
+	orig := version
+	version = "1.2.0"
+	t.Cleanup(func() { version = orig })
+
+	tests := []struct {
+		name string
+		opts options
+		want string
+	}{
+		{"default", options{}, "weather-aggregator/1.2.0 (+https://github.com/dustin2023/concepts-of-programming-languages-compared-with-go)"},
+		{"contact", options{contact: "ops@example.com"}, "weather-aggregator/1.2.0 (+https://github.com/dustin2023/concepts-of-programming-languages-compared-with-go; ops@example.com)"},
+		{"custom", options{userAgent: "acme-dashboard/3.1 (it@acme.example)"}, "acme-dashboard/3.1 (it@acme.example)"},
+	}
+	for _, tt := range tests {
+		fake := &fakeTransport{body: `{"current":{"temperature_2m":7.5}}`}
+		tt.opts.transport, tt.opts.lat, tt.opts.lon = fake, "52.52", "13.41"
+		agg := newAggregator(tt.opts, []weather.WeatherSource{&weather.OpenMeteoSource{}})
+		if _, err := agg.Fetch(context.Background(), "Berlin"); err != nil {
+			t.Fatal(err)
+		}
+		if len(fake.agents) != 1 || fake.agents[0] != tt.want {
+			t.Errorf("%s: User-Agent = %q, want %q", tt.name, fake.agents, tt.want)
+		}
+	}
+
+	base := options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, retries: 1}
+	if err := validateOptions(base); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []options{{userAgent: "a\r\nX-Evil: 1"}, {userAgent: "a", contact: "b"}} {
+		o := base
+		o.userAgent, o.contact = opts.userAgent, opts.contact
+		if validateOptions(o) == nil {
+			t.Errorf("validateOptions accepted user agent %q with contact %q", o.userAgent, o.contact)
+		}
+	}
+}
+
+func TestFilterOnlySources(t *testing.T) {
+	all := []weather.WeatherSource{&stubSource{name: "Open-Meteo"}, &stubSource{name: "WeatherAPI.com"}, &stubSource{name: "Pirate-Weather"}}
+	got, err := filterOnlySources(all, " pirate-weather , Open-Meteo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name() != "Open-Meteo" || got[1].Name() != "Pirate-Weather" {
+		t.Errorf("filterOnlySources = %v, want Open-Meteo and Pirate-Weather in source order", got)
+	}
+	if _, err := filterOnlySources(all, "Tomorrow.io"); err == nil {
+		t.Error("expected error when no source matches")
+	}
+
+	opts := options{units: "metric", format: "text", aggregate: "mean", only: "Open-Meteo", exclude: "WeatherAPI.com"}
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "--only") {
+		t.Errorf("validateOptions = %v, want the --only/--exclude conflict", err)
+	}
+}
+
+func TestSourceNameMatching(t *testing.T) {
+	all := []weather.WeatherSource{&stubSource{name: "Open-Meteo"}, &stubSource{name: "WeatherAPI.com"}}
+	for _, name := range []string{"OPEN-METEO", "open meteo", "openmeteo"} {
+		if got := filterExcludedSources(all, name); len(got) != 1 || got[0].Name() != "WeatherAPI.com" {
+			t.Errorf("--exclude %q kept %v, want only WeatherAPI.com", name, got)
+		}
+		if got, err := filterOnlySources(all, name); err != nil || len(got) != 1 || got[0].Name() != "Open-Meteo" {
+			t.Errorf("--only %q = %v, %v; want only Open-Meteo", name, got, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	warnUnknownSources(&buf, "--exclude", "open meteo, wetterapi,Pirate Weather")
+	if out := buf.String(); strings.Count(out, "Warning:") != 1 || !strings.Contains(out, `--exclude "wetterapi" matches no known source`) {
+		t.Errorf("warnings = %q, want exactly one for wetterapi", out)
+	}
+}
+
+func TestNoUsableSources(t *testing.T) {
+	infos := []weather.SourceInfo{
+		{Name: "Open-Meteo"},
+		{Name: "Tomorrow.io", EnvKey: "TOMORROW_API_KEY", KeyPresent: true},
+		{Name: "WeatherAPI.com", EnvKey: "WEATHER_API_COM_KEY"},
+		{Name: "Meteosource", EnvKey: "METEOSOURCE_API_KEY", KeyError: errors.New("read METEOSOURCE_API_KEY_FILE: permission denied")},
+	}
+	names := func(s []weather.SourceInfo) string {
+		var out []string
+		for _, i := range s {
+			out = append(out, i.Name)
+		}
+		return strings.Join(out, ",")
+	}
+	tests := []struct {
+		only, exclude string
+		want          string
+	}{
+		{"weatherapi.com", "", "WeatherAPI.com"},
+		{"", "Open-Meteo,Tomorrow.io", "WeatherAPI.com,Meteosource"},
+		{"Open-Meteo", "", ""},
+		{"WeatherAPI.com,Meteosource", "meteosource", "WeatherAPI.com"},
+		{"Tomorrow.io", "", ""},
+	}
+	for _, tt := range tests {
+		if got := names(missingKeySources(infos, tt.only, tt.exclude)); got != tt.want {
+			t.Errorf("missingKeySources(only %q, exclude %q) = %q, want %q", tt.only, tt.exclude, got, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	printNoUsableSources(&buf, missingKeySources(infos, "", "Open-Meteo,Tomorrow.io"))
+	want := `Error: no usable sources, the selected ones need API keys that are not set:
+  WeatherAPI.com   set WEATHER_API_COM_KEY
+  Meteosource      read METEOSOURCE_API_KEY_FILE: permission denied
+Add the keys to the .env file in the repository root (see .env.example) or export them, then verify with --list-sources.
+`
+	if got := buf.String(); got != want {
+		t.Errorf("message:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintSourceList(t *testing.T) {
+	for _, env := range []string{"TOMORROW_API_KEY", "WEATHER_API_COM_KEY", "METEOSOURCE_API_KEY", "OPENWEATHER_API_KEY", "VISUALCROSSING_API_KEY", "ACCUWEATHER_API_KEY"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("PIRATE_WEATHER_API_KEY", "k")
+
+	var buf bytes.Buffer
+	printSourceList(&buf, weather.ListSources(), options{})
+	want := `Available sources (use these names with --only/--exclude):
+  ✅ Open-Meteo       no API key needed
+  ❌ Tomorrow.io      TOMORROW_API_KEY missing
+  ❌ WeatherAPI.com   WEATHER_API_COM_KEY missing
+  ❌ Meteosource      METEOSOURCE_API_KEY missing
+  ✅ Pirate-Weather   PIRATE_WEATHER_API_KEY is set
+  ❌ OpenWeatherMap   OPENWEATHER_API_KEY missing
+  ❌ Visual Crossing  VISUALCROSSING_API_KEY missing
+  ❌ AccuWeather      ACCUWEATHER_API_KEY missing
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The listing must agree with the sources InitSources actually creates
+	var used []string
+	for _, s := range weather.InitSources() {
+		used = append(used, s.Name())
+	}
+	if got := strings.Join(used, ","); got != "Open-Meteo,Pirate-Weather" {
+		t.Errorf("InitSources = %s, want the sources marked ✅", got)
+	}
+}
+
+// hostRecorder records the hosts requested through next.
+type hostRecorder struct {
+	next  http.RoundTripper
+	hosts []string
+}
+
+func (h *hostRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.hosts = append(h.hosts, req.URL.Host)
+	return h.next.RoundTrip(req)
+}
+
+func TestAutoLocate(t *testing.T) {
+	rec := &hostRecorder{next: weather.FixtureTransport{Dir: "fixtures"}}
+	opts := options{units: "metric", format: "text", aggregate: "mean", timeout: defaultRunTimeout, autoLocate: true, transport: rec}
+	if err := validateOptions(opts); err != nil || !locating(opts) {
+		t.Fatalf("validate = %v, locating = %v; want --auto-locate without a city accepted", err, locating(opts))
+	}
+	agg := newAggregator(opts, []weather.WeatherSource{&weather.OpenMeteoSource{}})
+	city, err := autoLocate(context.Background(), agg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := agg.Options.Location; city != "Berlin" || loc == nil || *loc != [2]float64{52.5196, 13.4069} {
+		t.Fatalf("city = %q, location = %v; want Berlin at the fixture's coordinates", city, loc)
+	}
+	data, err := agg.Fetch(context.Background(), city)
+	if err != nil || data[0].Error != nil {
+		t.Fatalf("fetch: %v %v", err, data[0].Error)
+	}
+	// the located coordinates replace geocoding
+	if want := []string{"ip-api.com", "api.open-meteo.com"}; !slices.Equal(rec.hosts, want) {
+		t.Errorf("requests = %v, want %v", rec.hosts, want)
+	}
+
+	opts.transport = weather.FixtureTransport{Dir: t.TempDir()}
+	if _, err := autoLocate(context.Background(), newAggregator(opts, nil)); err == nil {
+		t.Error("expected an error when the geolocation service fails")
+	}
+	if opts.city = "Paris"; locating(opts) {
+		t.Error("--city must take precedence over --auto-locate")
+	}
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, autoLocate: true, lat: "1", lon: "2"}); err == nil {
+		t.Error("--auto-locate with --lat/--lon accepted")
+	}
+}
+
+func TestJSONMeta(t *testing.T) {
+	opts := options{units: "metric", format: "json", aggregate: "mean", timeout: defaultRunTimeout, fixtures: "fixtures", exclude: "WeatherAPI.com"}
+	all, err := loadSources("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := filterExcludedSources(all, opts.exclude)
+	opts.excluded = excludedSources(all, sources)
+	agg := newAggregator(opts, sources[:1])
+
+	before := time.Now().Add(-time.Second)
+	out := captureStdout(t, func() { runOnce(context.Background(), agg, "Berlin", opts) })
+	var doc struct {
+		City string    `json:"city"`
+		Meta *metaJSON `json:"meta"`
+	}
+	dec := json.NewDecoder(strings.NewReader(out))
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("output %q: %v", out, err)
+	}
+	m := doc.Meta
+	if doc.City != "Berlin" || m == nil {
+		t.Fatalf("document = %s, want Berlin with metadata", out)
+	}
+	if ts, err := time.Parse(time.RFC3339, m.Time); err != nil || ts.Before(before.Truncate(time.Second)) {
+		t.Errorf("time = %q (%v), want the start of this run", m.Time, err)
+	}
+	if m.Version != version || m.DurationMs < 0 {
+		t.Errorf("version = %q, duration = %vms", m.Version, m.DurationMs)
+	}
+	// the coordinates of the geocoding fixture
+	if m.Lat == nil || m.Lon == nil || *m.Lat != 52.52437 || *m.Lon != 13.41053 {
+		t.Errorf("coordinates = %v, %v; want the geocoded Berlin", m.Lat, m.Lon)
+	}
+	if !slices.Equal(m.Excluded, []string{"WeatherAPI.com"}) {
+		t.Errorf("excluded = %v, want WeatherAPI.com", m.Excluded)
+	}
+}
+
+// TestStreamAlerts checks that --stream prints the merged alerts once the stream closes.
+func TestStreamAlerts(t *testing.T) {
+	opts := options{units: "metric", format: "text", aggregate: "mean", timeout: defaultRunTimeout, fixtures: "fixtures", stream: true, plain: true}
+	sources, err := loadSources("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := newAggregator(opts, sources)
+	out := captureStdout(t, func() { runStreaming(context.Background(), agg, "Berlin", opts) })
+	// the Pirate Weather fixture carries a wind warning
+	if !strings.Contains(out, "Weather Alerts (1):") || !strings.Contains(out, "Wind warning [Moderate]") {
+		t.Errorf("--stream output lacks the alerts:\n%s", out)
+	}
+}
+
+// TestFixtures runs every source against the sample fixtures through the real decoders.
+func TestFixtures(t *testing.T) {
+	opts := options{units: "metric", format: "text", aggregate: "mean", timeout: defaultRunTimeout, fixtures: "fixtures", airQuality: true}
+	if err := validateOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := loadSources("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := newAggregator(opts, sources)
+	data, err := agg.Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"Open-Meteo": 14.3, "Tomorrow.io": 14.8, "WeatherAPI.com": 14, "Meteosource": 13.9, "Pirate-Weather": 14.5, "OpenWeatherMap": 14.2, "Visual Crossing": 14.1, "AccuWeather": 14.4}
+	for _, d := range data {
+		if d.Error != nil {
+			t.Errorf("%s: %v", d.Source, d.Error)
+			continue
+		}
+		if d.AirQuality {
+			if d.AQI == nil || *d.AQI != 38 {
+				t.Errorf("%s: AQI = %v, want 38", d.Source, d.AQI)
+			}
+			continue
+		}
+		if d.Temperature != want[d.Source] {
+			t.Errorf("%s: temperature = %.1f, want %.1f", d.Source, d.Temperature, want[d.Source])
+		}
+	}
+	res := weather.Aggregate(data)
+	if res.Valid != len(want) || res.Consensus != "Cloudy" || len(res.Alerts) != 1 {
+		t.Errorf("aggregate: valid=%d consensus=%q alerts=%d; want %d, Cloudy, 1", res.Valid, res.Consensus, len(res.Alerts), len(want))
+	}
+	if rise, _ := sunTimes(data); rise == nil || rise.Format("15:04") != "07:24" {
+		t.Errorf("sunrise = %v, want 07:24 local time", rise)
+	}
+
+	opts.fixtures = "no-such-dir"
+	if err := validateOptions(opts); err == nil {
+		t.Error("expected error for a missing fixtures directory")
+	}
+}
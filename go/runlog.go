@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"weather-aggregator/weather"
+)
+
+// runLogEntry is one line of the --log-runs file, written once per city and run.
+// The schema only grows: fields may be added, but existing ones keep their name and
+// meaning, so logs written by older versions stay comparable.
+//
+//	{"time":"2026-10-14T09:40:00Z","city":"Berlin","sources":[
+//	  {"source":"Open-Meteo","temperature":14.2,"humidity":71,"condition":"Rainy","duration_ms":120},
+//	  {"source":"Meteosource","error":"weather request failed: HTTP 401","duration_ms":30}]}
+type runLogEntry struct {
+	Time    string         `json:"time"` // RFC 3339 in UTC, when the results were logged
+	City    string         `json:"city"`
+	Sources []runLogSource `json:"sources"` // every queried source, failed ones included
+}
+
+// runLogSource is the result of one source. Values are always metric, independent of --units.
+type runLogSource struct {
+	Source      string   `json:"source"`
+	Temperature *float64 `json:"temperature,omitempty"` // °C; missing on errors and air quality results
+	Humidity    *float64 `json:"humidity,omitempty"`    // %
+	Condition   string   `json:"condition,omitempty"`   // as reported, before normalization
+	Error       string   `json:"error,omitempty"`       // set when the source failed or was rejected
+	DurationMs  float64  `json:"duration_ms"`
+}
+
+// newRunLogEntry converts the results for city into a log line.
+func newRunLogEntry(city string, data []weather.WeatherData, now time.Time) runLogEntry {
+	entry := runLogEntry{Time: now.UTC().Format(time.RFC3339), City: city, Sources: make([]runLogSource, 0, len(data))}
+	for _, d := range data {
+		s := runLogSource{Source: d.Source, DurationMs: float64(d.Duration.Microseconds()) / 1000}
+		switch {
+		case d.Error != nil:
+			s.Error = d.Error.Error()
+		case !d.AirQuality:
+			temp := d.Temperature
+			s.Temperature, s.Humidity, s.Condition = &temp, d.Humidity, d.Condition
+		}
+		entry.Sources = append(entry.Sources, s)
+	}
+	return entry
+}
+
+// appendRunLog appends one JSON line for city to the file at path, creating it if needed.
+func appendRunLog(path, city string, data []weather.WeatherData, now time.Time) error {
+	line, err := json.Marshal(newRunLogEntry(city, data, now))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	// a single write keeps lines whole even if two runs append at the same time
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// logRun writes the results to the --log-runs file, if set. Failures only print a warning:
+// the history is a side channel and must not change the outcome of the run.
+func logRun(opts options, city string, data []weather.WeatherData) {
+	if opts.logRuns == "" {
+		return
+	}
+	if err := appendRunLog(opts.logRuns, city, data, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write run log: %v\n", err)
+	}
+}
+
+// sourceStats sums up the logged runs of one source for --stats.
+type sourceStats struct {
+	Source       string
+	Runs         int
+	Successes    int
+	AvgLatencyMs float64 // over all runs, failed ones included
+	AvgDeviation float64 // mean |temperature - run mean| in °C; 0 when Compared is 0
+	Compared     int     // successful runs with at least one other valid source to compare with
+}
+
+// SuccessRate is the share of successful runs, 0..1.
+func (s sourceStats) SuccessRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Successes) / float64(s.Runs)
+}
+
+// readRunStats aggregates a --log-runs file by source. The consensus of a run is the plain
+// mean of its valid temperatures. Lines that don't parse, e.g. one cut off by a crash, are
+// skipped and counted. Results are sorted by success rate, then latency, then name.
+func readRunStats(r io.Reader) (stats []sourceStats, skipped int, err error) {
+	bySource := make(map[string]*sourceStats)
+	latency, deviation := make(map[string]float64), make(map[string]float64)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var entry runLogEntry
+		if json.Unmarshal([]byte(line), &entry) != nil {
+			skipped++
+			continue
+		}
+		valid := 0
+		for _, s := range entry.Sources {
+			if s.Error == "" && s.Temperature != nil {
+				valid++
+			}
+		}
+		mean, _ := runMean(entry.Sources)
+		for _, s := range entry.Sources {
+			st := bySource[s.Source]
+			if st == nil {
+				st = &sourceStats{Source: s.Source}
+				bySource[s.Source] = st
+			}
+			st.Runs++
+			latency[s.Source] += s.DurationMs
+			if s.Error != "" {
+				continue
+			}
+			st.Successes++
+			if s.Temperature != nil && valid > 1 {
+				st.Compared++
+				deviation[s.Source] += math.Abs(*s.Temperature - mean)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, skipped, err
+	}
+	for name, st := range bySource {
+		st.AvgLatencyMs = latency[name] / float64(st.Runs)
+		if st.Compared > 0 {
+			st.AvgDeviation = deviation[name] / float64(st.Compared)
+		}
+		stats = append(stats, *st)
+	}
+	slices.SortFunc(stats, func(a, b sourceStats) int {
+		if c := cmp.Compare(b.SuccessRate(), a.SuccessRate()); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.AvgLatencyMs, b.AvgLatencyMs); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Source, b.Source)
+	})
+	return stats, skipped, nil
+}
+
+// printStats renders the --stats scoreboard. Deviations are converted to units.
+func printStats(w io.Writer, stats []sourceStats, units string) {
+	_, symbol := convertTemp(0, units)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Source\tRuns\tSuccess\tAvg latency\tAvg |Δ|")
+	for _, s := range stats {
+		dev := "-"
+		if s.Compared > 0 {
+			dev = fmt.Sprintf("%.2f%s", convertTempDelta(s.AvgDeviation, units), symbol)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%.0fms\t%s\n", s.Source, s.Runs, s.SuccessRate()*100, s.AvgLatencyMs, dev)
+	}
+	tw.Flush()
+}
+
+// runStats prints the scoreboard of the --stats log file and returns the exit code.
+func runStats(path string, opts options) int {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	defer f.Close()
+	stats, skipped, err := readRunStats(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return exitUsage
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d malformed line(s) in %s\n", skipped, path)
+	}
+	if len(stats) == 0 {
+		fmt.Fprintf(os.Stderr, "No runs logged in %s\n", path)
+		return exitFailure
+	}
+	printStats(os.Stdout, stats, opts.units)
+	return exitOK
+}
+
+// lastRun returns the most recent entry for city in a --log-runs file, matching the name
+// case-insensitively; nil if there is none. Malformed lines are skipped like in readRunStats.
+func lastRun(r io.Reader, city string) (*runLogEntry, error) {
+	var last *runLogEntry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var entry runLogEntry
+		if json.Unmarshal(sc.Bytes(), &entry) == nil && strings.EqualFold(strings.TrimSpace(entry.City), strings.TrimSpace(city)) {
+			last = &entry
+		}
+	}
+	return last, sc.Err()
+}
+
+// runMean is the plain mean of the valid temperatures of a logged run, the consensus
+// --stats and --diff-against-last use; false without any.
+func runMean(sources []runLogSource) (float64, bool) {
+	var sum float64
+	n := 0
+	for _, s := range sources {
+		if s.Error == "" && s.Temperature != nil {
+			sum += *s.Temperature
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// agoText formats the age of a logged run, e.g. "just now", "25m ago", "3h ago" or "2d ago".
+func agoText(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+}
+
+// printLastRunDiff prints the temperature change of each valid source and of the consensus
+// since the last run of city in the --log-runs file, for --diff-against-last. It has to run
+// before logRun appends the current run. A missing file or city only prints a note.
+func printLastRunDiff(w io.Writer, opts options, city string, data []weather.WeatherData, now time.Time) {
+	prev, err := func() (*runLogEntry, error) {
+		f, err := os.Open(opts.logRuns)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return lastRun(f, city)
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not read run log: %v\n", err)
+		return
+	}
+	if prev == nil {
+		fmt.Fprintf(w, "\nNo earlier run of %s in %s to compare with.\n", city, opts.logRuns)
+		return
+	}
+
+	since := "since the last run"
+	if t, err := time.Parse(time.RFC3339, prev.Time); err == nil {
+		since += " (" + agoText(now.Sub(t)) + ")"
+	}
+	_, symbol := convertTemp(0, opts.units)
+	delta := func(d float64) string { return fmt.Sprintf("%+.1f%s", convertTempDelta(d, opts.units), symbol) }
+	before := make(map[string]float64)
+	for _, s := range prev.Sources {
+		if s.Error == "" && s.Temperature != nil {
+			before[s.Source] = *s.Temperature
+		}
+	}
+	fmt.Fprintf(w, "\n%sChange %s:\n", opts.decor("📈 ", ""), since)
+	for _, d := range data {
+		if d.Error != nil || d.AirQuality {
+			continue
+		}
+		if t, ok := before[d.Source]; ok {
+			fmt.Fprintf(w, "   %-18s %s\n", d.Source+":", delta(d.Temperature-t))
+		} else {
+			fmt.Fprintf(w, "   %-18s no earlier reading\n", d.Source+":")
+		}
+	}
+	cur, okCur := runMean(newRunLogEntry(city, data, now).Sources)
+	old, okOld := runMean(prev.Sources)
+	if okCur && okOld {
+		fmt.Fprintf(w, "→  %-18s %s\n", "Consensus:", delta(cur-old))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"weather-aggregator/weather"
+)
+
+func TestRunLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	existing := `{"time":"2026-10-13T08:00:00Z","city":"Paris","sources":[]}` + "\n"
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	aqi := 42
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 14.2, Humidity: floatPtr(71), Condition: "Rainy", Duration: 120 * time.Millisecond},
+		{Source: "Tomorrow.io", Temperature: 0, Condition: "Clear", Duration: 80 * time.Millisecond},
+		{Source: "Meteosource", Error: errors.New("HTTP 401"), Duration: 30 * time.Millisecond},
+		{Source: "Air Quality", AirQuality: true, AQI: &aqi, Duration: 60 * time.Millisecond},
+	}
+	// --units must not leak into the log
+	logRun(options{logRuns: path, units: "imperial"}, "Berlin", data)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(content, []byte("\n")), []byte("\n"))
+	if len(lines) != 2 || string(lines[0])+"\n" != existing {
+		t.Fatalf("log has %d lines, want the existing one plus exactly one:\n%s", len(lines), content)
+	}
+	var entry runLogEntry
+	dec := json.NewDecoder(bytes.NewReader(lines[1]))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&entry); err != nil {
+		t.Fatalf("malformed line %s: %v", lines[1], err)
+	}
+	if entry.City != "Berlin" || len(entry.Sources) != len(data) {
+		t.Fatalf("entry = %+v, want Berlin with %d sources", entry, len(data))
+	}
+	if _, err := time.Parse(time.RFC3339, entry.Time); err != nil {
+		t.Errorf("time %q: %v", entry.Time, err)
+	}
+	om, tio, ms, aq := entry.Sources[0], entry.Sources[1], entry.Sources[2], entry.Sources[3]
+	if om.Temperature == nil || *om.Temperature != 14.2 || *om.Humidity != 71 || om.Condition != "Rainy" || om.DurationMs != 120 {
+		t.Errorf("Open-Meteo = %+v", om)
+	}
+	if tio.Temperature == nil || *tio.Temperature != 0 || tio.Humidity != nil {
+		t.Errorf("Tomorrow.io = %+v, want 0°C kept and humidity omitted", tio)
+	}
+	if ms.Error != "HTTP 401" || ms.Temperature != nil {
+		t.Errorf("Meteosource = %+v, want only the error", ms)
+	}
+	if aq.Temperature != nil || aq.Error != "" {
+		t.Errorf("air quality = %+v, want no temperature", aq)
+	}
+}
+
+func TestRunLogFailureIsNotFatal(t *testing.T) {
+	// a directory can't be opened for appending
+	logRun(options{logRuns: t.TempDir()}, "Berlin", []weather.WeatherData{{Source: "A", Temperature: 1}})
+	if err := appendRunLog(t.TempDir(), "Berlin", nil, time.Now()); err == nil {
+		t.Error("appending to a directory succeeded")
+	}
+}
+
+func TestLastRunDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	log := `{"time":"2026-10-14T08:00:00Z","city":"Berlin","sources":[{"source":"Open-Meteo","temperature":9,"duration_ms":100}]}
+{"time":"2026-10-14T09:00:00Z","city":"berlin","sources":[{"source":"Open-Meteo","temperature":10,"duration_ms":100},{"source":"Tomorrow.io","temperature":12,"duration_ms":90},{"source":"Meteosource","error":"HTTP 401","duration_ms":30}]}
+{"time":"2026-10-14T09:30:00Z","city":"Paris","sources":[{"source":"Open-Meteo","temperature":15,"duration_ms":100}]}
+{"time":"2026-10-14T09:45:00Z","city":"Berl
+`
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data := []weather.WeatherData{
+		{Source: "Open-Meteo", Temperature: 12.5},
+		{Source: "Tomorrow.io", Temperature: 13.7},
+		{Source: "Meteosource", Temperature: 14}, // failed last time
+		{Source: "WeatherAPI.com", Error: errors.New("timeout")},
+	}
+	now := time.Date(2026, 10, 14, 10, 5, 0, 0, time.UTC)
+	opts := options{logRuns: path, units: "metric", plain: true}
+
+	var buf bytes.Buffer
+	printLastRunDiff(&buf, opts, "Berlin", data, now)
+	// consensus: (12.5+13.7+14)/3 = 13.4 against (10+12)/2 = 11
+	want := `
+Change since the last run (1h ago):
+   Open-Meteo:        +2.5°C
+   Tomorrow.io:       +1.7°C
+   Meteosource:       no earlier reading
+→  Consensus:         +2.4°C
+`
+	if got := buf.String(); got != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	opts.units = "imperial"
+	printLastRunDiff(&buf, opts, "Berlin", data[:1], now)
+	if !strings.Contains(buf.String(), "Open-Meteo:        +4.5°F") || !strings.Contains(buf.String(), "Consensus:         +2.7°F") {
+		t.Errorf("imperial diff:\n%s", buf.String())
+	}
+
+	for _, tt := range []struct{ path, city string }{{path, "Tokyo"}, {filepath.Join(t.TempDir(), "none.jsonl"), "Berlin"}} {
+		buf.Reset()
+		printLastRunDiff(&buf, options{logRuns: tt.path, units: "metric"}, tt.city, data, now)
+		if !strings.Contains(buf.String(), "No earlier run of "+tt.city) {
+			t.Errorf("%s in %s: %q, want a note about the missing history", tt.city, tt.path, buf.String())
+		}
+	}
+}
+
+func TestAgoText(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		20 * time.Second: "just now",
+		25 * time.Minute: "25m ago",
+		65 * time.Minute: "1h ago",
+		47 * time.Hour:   "47h ago",
+		72 * time.Hour:   "3d ago",
+	} {
+		if got := agoText(d); got != want {
+			t.Errorf("agoText(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestReadRunStats(t *testing.T) {
+	log := `{"time":"2026-10-14T08:00:00Z","city":"Berlin","sources":[{"source":"A","temperature":10,"duration_ms":100},{"source":"B","temperature":12,"duration_ms":300},{"source":"C","error":"HTTP 500","duration_ms":50}]}
+{"time":"2026-10-14T09:00:00Z","city":"Berlin","sources":[{"source":"A","temperature":11,"duration_ms":200},{"source":"B","error":"timeout","duration_ms":1000},{"source":"C","temperature":14,"duration_ms":70}]}
+
+{"time":"2026-10-14T10:00:00Z","city":"Paris","sources":[{"source":"A","temperature":15,"duration_ms":300}]}
+{"time":"2026-10-14T11:00:00Z","city":"Paris","sour
+`
+	stats, skipped, err := readRunStats(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want the truncated last line", skipped)
+	}
+	// A first (100%), then C and B at 50% with C being faster
+	want := []sourceStats{
+		{Source: "A", Runs: 3, Successes: 3, AvgLatencyMs: 200, AvgDeviation: 1.25, Compared: 2},
+		{Source: "C", Runs: 2, Successes: 1, AvgLatencyMs: 60, AvgDeviation: 1.5, Compared: 1},
+		{Source: "B", Runs: 2, Successes: 1, AvgLatencyMs: 650, AvgDeviation: 1, Compared: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("stats = %+v, want %d sources", stats, len(want))
+	}
+	for i, w := range want {
+		if stats[i] != w {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], w)
+		}
+	}
+	if r := stats[1].SuccessRate(); r != 0.5 {
+		t.Errorf("success rate = %v, want 0.5", r)
+	}
+
+	var buf bytes.Buffer
+	printStats(&buf, stats, "metric")
+	wantTable := `Source  Runs  Success  Avg latency  Avg |Δ|
+A       3     100.0%   200ms        1.25°C
+C       2     50.0%    60ms         1.50°C
+B       2     50.0%    650ms        1.00°C
+`
+	if got := buf.String(); got != wantTable {
+		t.Errorf("table:\n%s\nwant:\n%s", got, wantTable)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+	"weather-aggregator/weather"
+)
+
+// newServer returns the handler for --serve mode. All requests share agg, so the
+// HTTP client, the coordinate cache and an optional response cache are reused.
+//
+//	GET /weather?city=<name>[&units=imperial][&aggregate=median]  → resultsJSON
+//	GET /healthz                                                  → 200 ok
+//	GET /metrics                                                  → Prometheus text format, if enabled
+func newServer(agg *weather.Aggregator, opts options) http.Handler {
+	mux := http.NewServeMux()
+	if m := agg.Options.Metrics; m != nil {
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			_, _ = m.WriteTo(w)
+		})
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/weather", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		reqOpts, city, err := requestOptions(r, opts)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		// The request context ends when the client goes away, which cancels all source fetches
+		ctx, cancel := context.WithTimeout(r.Context(), opts.timeout)
+		defer cancel()
+		id := requestID(r)
+		ctx = weather.WithRequestID(ctx, id)
+		w.Header().Set(weather.RequestIDHeader, id)
+		start := time.Now()
+		data, coords, err := agg.FetchCoords(ctx, city)
+		duration := time.Since(start)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		data = rejectReadings(data, reqOpts)
+
+		out := buildResultsJSON(city, data, reqOpts)
+		out.Meta = newMetaJSON(coords, start, duration, reqOpts)
+		status := http.StatusOK
+		if out.Aggregated.Valid == 0 {
+			status = http.StatusBadGateway
+		}
+		writeJSON(w, status, out)
+	})
+	return mux
+}
+
+// requestOptions applies the per-request query parameters to the server's options.
+func requestOptions(r *http.Request, opts options) (options, string, error) {
+	q := r.URL.Query()
+	city, err := validateCityName(q.Get("city"))
+	if err != nil {
+		return opts, "", err
+	}
+	if units := q.Get("units"); units != "" {
+		opts.units = units
+	}
+	if aggregate := q.Get("aggregate"); aggregate != "" {
+		opts.aggregate = aggregate
+	}
+	// The rest of opts was validated once at startup
+	if err := validateQueryOptions(opts); err != nil {
+		return opts, "", err
+	}
+	return opts, city, nil
+}
+
+// requestIDPattern is what an incoming X-Request-ID must look like to be passed on,
+// so clients can't inject arbitrary text into logs and upstream headers.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID returns the client's X-Request-ID, so a proxy's ID can be followed through,
+// or a new one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(weather.RequestIDHeader); requestIDPattern.MatchString(id) {
+		return id
+	}
+	return weather.NewRequestID()
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+	}
+}
+
+// writeJSONError writes {"error": "..."} with the given status.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// serve runs the HTTP server on addr until SIGINT/SIGTERM, then shuts it down gracefully.
+func serve(addr string, agg *weather.Aggregator, opts options) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newServer(agg, opts),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	fmt.Printf("%sServing weather on http://%s (GET /weather?city=<name>, /healthz, /metrics)\n", opts.decor("🌍 ", ""), addr)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultRunTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"weather-aggregator/weather"
+)
+
+// stubSource returns a fixed reading without network access.
+type stubSource struct {
+	name string
+	temp float64
+	cond string
+}
+
+func (s *stubSource) Name() string { return s.name }
+func (s *stubSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) weather.WeatherData {
+	if err := ctx.Err(); err != nil {
+		return weather.WeatherData{Source: s.name, Error: err}
+	}
+	return weather.WeatherData{Source: s.name, Temperature: s.temp, Condition: s.cond}
+}
+
+func TestServer(t *testing.T) {
+	sources := []weather.WeatherSource{
+		&stubSource{name: "A", temp: 10, cond: "Clear"},
+		&stubSource{name: "B", temp: 20, cond: "Sunny"},
+	}
+	agg := weather.NewAggregator(sources, weather.Options{Location: &[2]float64{0, 0}, Metrics: weather.NewMetrics()})
+	srv := httptest.NewServer(newServer(agg, options{units: "metric", format: "json", aggregate: "mean", timeout: defaultRunTimeout}))
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, resultsJSON) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out resultsJSON
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	resp, out := get("/weather?city=Berlin")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if out.City != "Berlin" || len(out.Sources) != 2 || out.Aggregated.Valid != 2 ||
+		out.Aggregated.AvgTemperature == nil || *out.Aggregated.AvgTemperature != 15 || out.Aggregated.Consensus != "Clear" {
+		t.Errorf("got %+v", out)
+	}
+
+	_, out = get("/weather?city=Berlin&units=imperial&aggregate=median")
+	if out.Unit != "°F" || out.Aggregated.Method != "median" || *out.Aggregated.AvgTemperature != 59 {
+		t.Errorf("overrides not applied: unit %q, method %q, temp %v", out.Unit, out.Aggregated.Method, *out.Aggregated.AvgTemperature)
+	}
+
+	for _, path := range []string{"/weather", "/weather?city=%40%40", "/weather?city=Berlin&units=kelvin"} {
+		if resp, _ := get(path); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", path, resp.StatusCode)
+		}
+	}
+	// Startup-only options such as --fixtures aren't re-checked per request
+	startup := options{units: "metric", format: "json", aggregate: "mean", timeout: defaultRunTimeout, fixtures: filepath.Join(t.TempDir(), "gone")}
+	req := httptest.NewRequest(http.MethodGet, "/weather?city=Berlin&units=imperial", nil)
+	if reqOpts, city, err := requestOptions(req, startup); err != nil || city != "Berlin" || reqOpts.units != "imperial" {
+		t.Errorf("requestOptions = %q, %q, %v; want imperial, Berlin, nil", reqOpts.units, city, err)
+	}
+	if resp, _ := get("/healthz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz: status %d", resp.StatusCode)
+	}
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// Two successful /weather requests so far
+	if !strings.Contains(string(body), `weather_source_requests_total{source="A",outcome="ok"} 2`) {
+		t.Errorf("/metrics missing request count:\n%s", body)
+	}
+	resp, err = http.Post(srv.URL+"/weather?city=Berlin", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", resp.StatusCode)
+	}
+}
+
+// idSource records the request ID of the context it is fetched with.
+type idSource struct{ got chan string }
+
+func (s *idSource) Name() string { return "ID" }
+func (s *idSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) weather.WeatherData {
+	s.got <- weather.RequestIDFrom(ctx)
+	return weather.WeatherData{Source: s.Name(), Temperature: 10, Condition: "Clear"}
+}
+
+func TestServerRequestID(t *testing.T) {
+	src := &idSource{got: make(chan string, 1)}
+	agg := weather.NewAggregator([]weather.WeatherSource{src}, weather.Options{Location: &[2]float64{52.5, 13.4}})
+	srv := httptest.NewServer(newServer(agg, options{units: "metric", format: "json", aggregate: "mean", timeout: defaultRunTimeout}))
+	defer srv.Close()
+
+	for _, incoming := range []string{"", "edge-7f3a.1", "bad id; with spaces", strings.Repeat("x", 65)} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/weather?city=Berlin", nil)
+		if incoming != "" {
+			req.Header[weather.RequestIDHeader] = []string{incoming}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%q: %v", incoming, err)
+		}
+		resp.Body.Close()
+		id, fetched := resp.Header.Get(weather.RequestIDHeader), <-src.got
+		if id == "" || id != fetched {
+			t.Errorf("%q: response ID %q, fetch ID %q; want the same non-empty ID", incoming, id, fetched)
+		}
+		if keep := incoming == "edge-7f3a.1"; keep != (id == incoming) {
+			t.Errorf("%q: got ID %q; want valid incoming IDs kept and others replaced", incoming, id)
+		}
+	}
+}
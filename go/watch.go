@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"weather-aggregator/weather"
+)
+
+// minWatchInterval keeps --watch from burning through the free API quotas.
+const minWatchInterval = 10 * time.Second
+
+// clearScreen moves the cursor home and clears the terminal (ANSI).
+const clearScreen = "\033[H\033[2J"
+
+// watchLoop calls iterate right away and then every interval until ctx is done, and
+// returns how often it ran. A run that takes longer than interval delays the next one
+// instead of overlapping it.
+func watchLoop(ctx context.Context, interval time.Duration, iterate func(ctx context.Context)) int {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	runs := 0
+	for ctx.Err() == nil {
+		iterate(ctx)
+		runs++
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	return runs
+}
+
+// runWatch redraws the weather for city every --watch interval until SIGINT/SIGTERM,
+// which also cancels a fetch in flight. All runs share agg, so its HTTP client, coordinate
+// cache and --cache-ttl response cache carry over. The exit code is that of the last
+// complete run.
+func runWatch(agg *weather.Aggregator, city string, opts options) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var last []weather.WeatherData
+	watchLoop(ctx, opts.watch, func(ctx context.Context) {
+		runCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+		// a pipe gets each run appended instead of escape codes
+		if opts.format != "json" && !opts.plain {
+			fmt.Print(clearScreen)
+		}
+		data := runOnce(runCtx, agg, city, opts)
+		if ctx.Err() != nil {
+			return // interrupted: the results are incomplete
+		}
+		last = data
+		if opts.format != "json" {
+			fmt.Printf("\nUpdated %s, next in %v (Ctrl+C to stop)\n", time.Now().Format("15:04:05"), opts.watch)
+		}
+	})
+	return runExitCode(os.Stderr, last, opts)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchLoop(t *testing.T) {
+	// runs at 0, 30, 60, 90 and 120ms, then the deadline ends the loop
+	ctx, cancel := context.WithTimeout(context.Background(), 135*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	runs := watchLoop(ctx, 30*time.Millisecond, func(context.Context) {})
+	if runs < 4 || runs > 6 {
+		t.Errorf("runs = %d, want about 5", runs)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("loop ended after %v, want right at the deadline", elapsed)
+	}
+
+	// a slow run delays the next instead of overlapping, and cancellation reaches it
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	inFlight, canceled := 0, false
+	done := make(chan int)
+	go func() {
+		done <- watchLoop(ctx, 5*time.Millisecond, func(ctx context.Context) {
+			inFlight++
+			if inFlight > 1 {
+				t.Error("runs overlap")
+			}
+			defer func() { inFlight-- }()
+			select {
+			case <-ctx.Done():
+				canceled = true
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case runs := <-done:
+		if runs < 2 || !canceled {
+			t.Errorf("runs = %d, canceled = %v; want a few runs and the last one canceled", runs, canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("loop did not stop after cancel")
+	}
+
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, watch: time.Second}); err == nil {
+		t.Error("watch interval below the minimum accepted")
+	}
+	if err := validateOptions(options{units: "metric", format: "text", aggregate: "mean", timeout: time.Second, watch: time.Minute, cities: "A,B"}); err == nil {
+		t.Error("--watch with --cities accepted")
+	}
+}
@@ -1,497 +0,0 @@
-package main
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"net/url"
-	"os"
-	"path/filepath"
-	"strings"
-	"sync"
-	"time"
-)
-
-// WeatherCodeRange represents a range of weather codes mapped to a condition.
-type WeatherCodeRange struct {
-	Min       int    `json:"min"`
-	Max       int    `json:"max"`
-	Condition string `json:"condition"`
-}
-
-// WeatherCodeConfig represents the structure of weather_codes.json.
-type WeatherCodeConfig struct {
-	WMO struct {
-		Ranges []WeatherCodeRange `json:"ranges"`
-	} `json:"wmo"`
-	TomorrowIO map[string]string `json:"tomorrow_io"`
-	Conditions map[string]struct {
-		Keywords []string `json:"keywords"`
-		Emoji    string   `json:"emoji"`
-	} `json:"conditions"`
-}
-
-// WeatherCodes holds the unified weather code mappings loaded from JSON.
-var WeatherCodes WeatherCodeConfig
-var weatherCodesOnce sync.Once
-var weatherCodesErr error
-
-// client is a shared HTTP client with 10s timeout.
-var client = &http.Client{
-	Timeout: 10 * time.Second,
-}
-
-// WeatherData represents weather from a single source.
-// Temperature in Celsius, Humidity as percentage (0-100).
-type WeatherData struct {
-	Source      string
-	Temperature float64
-	Humidity    *float64 // Pointer to distinguish between 0% and missing data
-	Condition   string
-	Error       error
-	Duration    time.Duration
-}
-
-type WeatherSource interface {
-	Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData
-	Name() string
-}
-
-// loadWeatherCodes loads weather code mappings from shared JSON file.
-func loadWeatherCodes() error {
-	weatherCodesOnce.Do(func() {
-		path := filepath.Join("..", "weather_codes.json")
-		data, err := os.ReadFile(path)
-		if err != nil {
-			weatherCodesErr = fmt.Errorf("failed to read weather_codes.json: %w", err)
-			return
-		}
-		if err := json.Unmarshal(data, &WeatherCodes); err != nil {
-			weatherCodesErr = fmt.Errorf("failed to parse weather_codes.json: %w", err)
-			return
-		}
-	})
-	return weatherCodesErr
-}
-
-// initSources creates all available weather sources.
-func initSources() []WeatherSource {
-	sources := []WeatherSource{&OpenMeteoSource{}}
-
-	addSource := func(envKey string, create func(string) WeatherSource) {
-		if val := os.Getenv(envKey); val != "" {
-			sources = append(sources, create(val))
-		}
-	}
-
-	addSource("TOMORROW_API_KEY", func(k string) WeatherSource { return &TomorrowIOSource{apiKey: k} })
-	addSource("WEATHER_API_COM_KEY", func(k string) WeatherSource { return &WeatherAPISource{k} })
-	addSource("METEOSOURCE_API_KEY", func(k string) WeatherSource { return &MeteosourceSource{k} })
-	addSource("PIRATE_WEATHER_API_KEY", func(k string) WeatherSource { return &PirateWeatherSource{k} })
-
-	return sources
-}
-
-// normalizeSourceName lowercases and removes spaces/dashes/dots for comparison
-func normalizeSourceName(name string) string {
-	replacer := strings.NewReplacer(" ", "", "-", "", ".", "")
-	return replacer.Replace(strings.ToLower(name))
-}
-
-// doGet creates request with context and returns response.
-func doGet(ctx context.Context, url string) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("User-Agent", "weather-aggregator/1.0")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-	}
-	return resp, nil
-}
-
-// geocodeCity resolves a city name to coordinates using Open-Meteo geocoding.
-func geocodeCity(ctx context.Context, city string) (float64, float64, error) {
-	geoURL := fmt.Sprintf("https://geocoding-api.open-meteo.com/v1/search?name=%s&count=1", url.QueryEscape(city))
-	resp, err := doGet(ctx, geoURL)
-	if err != nil {
-		return 0, 0, fmt.Errorf("geocoding request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var geo struct {
-		Results []struct {
-			Lat float64 `json:"latitude"`
-			Lon float64 `json:"longitude"`
-		} `json:"results"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&geo); err != nil {
-		return 0, 0, fmt.Errorf("failed to decode geocoding response: %w", err)
-	}
-	if len(geo.Results) == 0 {
-		return 0, 0, fmt.Errorf("city %q not found", city)
-	}
-	return geo.Results[0].Lat, geo.Results[0].Lon, nil
-}
-
-// getCoordinates gets coordinates from cache or performs geocoding.
-func getCoordinates(ctx context.Context, city string, coordsCache map[string][2]float64) (float64, float64, error) {
-	if coordsCache != nil {
-		if coords, ok := coordsCache[city]; ok {
-			return coords[0], coords[1], nil
-		}
-	}
-	return geocodeCity(ctx, city)
-}
-
-// --- Weather API Implementations ---
-// Each API source implements the WeatherSource interface.
-// Free sources without API key: Open-Meteo
-// API key required: WeatherAPI.com, Meteosource, Pirate Weather, Tomorrow.io
-
-// OpenMeteoSource - no key required.
-type OpenMeteoSource struct{}
-
-func (o *OpenMeteoSource) Name() string { return "Open-Meteo" }
-func (o *OpenMeteoSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
-	res := WeatherData{Source: o.Name()}
-
-	lat, lon, err := getCoordinates(ctx, city, coordsCache)
-	if err != nil {
-		res.Error = err
-		return res
-	}
-
-	weatherURL := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,relative_humidity_2m,weather_code", lat, lon)
-	resp, err := doGet(ctx, weatherURL)
-	if err != nil {
-		res.Error = fmt.Errorf("weather request failed: %w", err)
-		return res
-	}
-	defer resp.Body.Close()
-
-	var data struct {
-		Current struct {
-			Temp float64 `json:"temperature_2m"`
-			Hum  float64 `json:"relative_humidity_2m"`
-			Code int     `json:"weather_code"`
-		}
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		res.Error = fmt.Errorf("failed to decode weather response: %w", err)
-		return res
-	}
-	res.Temperature = data.Current.Temp
-	hum := data.Current.Hum
-	res.Humidity = &hum
-	res.Condition = mapWMOCode(data.Current.Code)
-	return res
-}
-
-// TomorrowIOSource - requires API key, coordinate-based.
-type TomorrowIOSource struct {apiKey string}
-
-func (t *TomorrowIOSource) Name() string { return "Tomorrow.io" }
-func (t *TomorrowIOSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
-	res := WeatherData{Source: t.Name()}
-
-	if t.apiKey == "" {
-		res.Error = fmt.Errorf("API key required")
-		return res
-	}
-
-	lat, lon, err := getCoordinates(ctx, city, coordsCache)
-	if err != nil {
-		res.Error = err
-		return res
-	}
-
-	url := fmt.Sprintf("https://api.tomorrow.io/v4/weather/realtime?location=%.4f,%.4f&apikey=%s", lat, lon, t.apiKey)
-	resp, err := doGet(ctx, url)
-	if err != nil {
-		res.Error = fmt.Errorf("weather request failed: %w", err)
-		return res
-	}
-	defer resp.Body.Close()
-
-	var data struct {
-		Data struct {
-			Values struct {
-				Temp      float64 `json:"temperature"`
-				Hum       float64 `json:"humidity"`
-				WeatherCd int     `json:"weatherCode"`
-			} `json:"values"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		res.Error = fmt.Errorf("failed to decode response: %w", err)
-		return res
-	}
-
-	res.Temperature = data.Data.Values.Temp
-	hum := data.Data.Values.Hum
-	res.Humidity = &hum
-	res.Condition = mapTomorrowCode(data.Data.Values.WeatherCd)
-	return res
-}
-
-// WeatherAPISource - requires API key.
-type WeatherAPISource struct{ key string }
-
-func (w *WeatherAPISource) Name() string { return "WeatherAPI.com" }
-func (w *WeatherAPISource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
-	res := WeatherData{Source: w.Name()}
-	if w.key == "" {
-		res.Error = fmt.Errorf("API key required")
-		return res
-	}
-	resp, err := doGet(ctx, fmt.Sprintf("https://api.weatherapi.com/v1/current.json?key=%s&q=%s", w.key, url.QueryEscape(city)))
-	if err != nil {
-		res.Error = fmt.Errorf("weather request failed: %w", err)
-		return res
-	}
-	defer resp.Body.Close()
-	var data struct {
-		Current struct {
-			TempC float64 `json:"temp_c"`
-			Hum   float64 `json:"humidity"`
-			Cond  struct {
-				Text string `json:"text"`
-			} `json:"condition"`
-		} `json:"current"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		res.Error = fmt.Errorf("failed to decode response: %w", err)
-		return res
-	}
-	res.Temperature = data.Current.TempC
-	hum := data.Current.Hum
-	res.Humidity = &hum
-	res.Condition = data.Current.Cond.Text
-	return res
-}
-
-// MeteosourceSource - requires API key, coordinate-based, no available humidity on free tier.
-type MeteosourceSource struct{ key string }
-
-func (m *MeteosourceSource) Name() string { return "Meteosource" }
-func (m *MeteosourceSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
-	res := WeatherData{Source: m.Name()}
-	if m.key == "" {
-		res.Error = fmt.Errorf("API key required")
-		return res
-	}
-	lat, lon, err := getCoordinates(ctx, city, coordsCache)
-	if err != nil {
-		res.Error = err
-		return res
-	}
-	resp, err := doGet(ctx, fmt.Sprintf("https://www.meteosource.com/api/v1/free/point?lat=%.4f&lon=%.4f&sections=current&language=en&units=metric&key=%s", lat, lon, m.key))
-	if err != nil {
-		res.Error = fmt.Errorf("weather request failed: %w", err)
-		return res
-	}
-	defer resp.Body.Close()
-	var data struct {
-		Current struct {
-			Temp    float64     `json:"temperature"`
-			Hum     interface{} `json:"humidity"`
-			Summary string      `json:"summary"`
-		} `json:"current"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		res.Error = fmt.Errorf("failed to decode response: %w", err)
-		return res
-	}
-	res.Temperature, res.Condition = data.Current.Temp, data.Current.Summary
-	if h, ok := data.Current.Hum.(float64); ok {
-		res.Humidity = &h
-	}
-	return res
-}
-
-// PirateWeatherSource - requires API key, coordinate-based.
-type PirateWeatherSource struct{ key string }
-
-func (p *PirateWeatherSource) Name() string { return "Pirate-Weather" }
-func (p *PirateWeatherSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
-	res := WeatherData{Source: p.Name()}
-	if p.key == "" {
-		res.Error = fmt.Errorf("API key required")
-		return res
-	}
-	lat, lon, err := getCoordinates(ctx, city, coordsCache)
-	if err != nil {
-		res.Error = err
-		return res
-	}
-	resp, err := doGet(ctx, fmt.Sprintf("https://api.pirateweather.net/forecast/%s/%.4f,%.4f?units=si", p.key, lat, lon))
-	if err != nil {
-		res.Error = fmt.Errorf("weather request failed: %w", err)
-		return res
-	}
-	defer resp.Body.Close()
-	var data struct {
-		Currently struct {
-			Temp float64 `json:"temperature"`
-			Hum  float64 `json:"humidity"`
-			Sum  string  `json:"summary"`
-		} `json:"currently"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		res.Error = fmt.Errorf("failed to decode response: %w", err)
-		return res
-	}
-	res.Temperature = data.Currently.Temp
-	if data.Currently.Hum > 0 {
-		hum := data.Currently.Hum * 100
-		res.Humidity = &hum
-	}
-	res.Condition = data.Currently.Sum
-	return res
-}
-
-
-func fetchWithTiming(ctx context.Context, source WeatherSource, city string, coordsCache map[string][2]float64) WeatherData {
-	start := time.Now()
-	result := source.Fetch(ctx, city, coordsCache)
-	result.Duration = time.Since(start)
-	return result
-}
-
-// fetchWeatherConcurrently fetches from all sources in parallel using goroutines.
-// Pre-geocodes the city to reduce redundant API calls.
-func fetchWeatherConcurrently(ctx context.Context, city string, sources []WeatherSource) []WeatherData {
-	// Pre-geocode city once to avoid redundant calls from each source
-	coordsCache := make(map[string][2]float64)
-	if lat, lon, err := geocodeCity(ctx, city); err == nil {
-		coordsCache[city] = [2]float64{lat, lon}
-	}
-
-	ch := make(chan WeatherData, len(sources))
-	for _, s := range sources {
-		go func(src WeatherSource) { ch <- fetchWithTiming(ctx, src, city, coordsCache) }(s)
-	}
-	results := make([]WeatherData, 0, len(sources))
-	for i := 0; i < len(sources); i++ {
-		results = append(results, <-ch)
-	}
-	return results
-}
-
-// fetchSequential fetches weather data sequentially for performance comparison.
-func fetchSequential(ctx context.Context, city string, sources []WeatherSource) []WeatherData {
-	// Pre-geocode city once to avoid redundant calls
-	coordsCache := make(map[string][2]float64)
-	if lat, lon, err := geocodeCity(ctx, city); err == nil {
-		coordsCache[city] = [2]float64{lat, lon}
-	}
-
-	results := make([]WeatherData, 0, len(sources))
-	for _, s := range sources {
-		results = append(results, fetchWithTiming(ctx, s, city, coordsCache))
-	}
-	return results
-}
-
-// AggregateWeather calculates avg temp/humidity and consensus condition from valid data.
-func AggregateWeather(data []WeatherData) (avgTemp, avgHum float64, cond string, valid int) {
-	if len(data) == 0 {
-		return 0, 0, "No data", 0
-	}
-
-	var tempSum, humSum float64
-	var humCount int
-	condCount := make(map[string]int)
-
-	for _, d := range data {
-		if d.Error == nil {
-			tempSum += d.Temperature
-			if d.Humidity != nil {
-				humSum += *d.Humidity
-				humCount++
-			}
-			condCount[normalizeCondition(d.Condition)]++
-			valid++
-		}
-	}
-
-	if valid == 0 {
-		return 0, 0, "No valid data", 0
-	}
-
-	avgTemp = tempSum / float64(valid)
-	if humCount > 0 {
-		avgHum = humSum / float64(humCount)
-	}
-
-	maxCount := 0
-	for c, count := range condCount {
-		if count > maxCount {
-			maxCount, cond = count, c
-		}
-	}
-	if maxCount == 0 {
-		cond = "Unknown"
-	}
-	return
-}
-
-// mapWMOCode converts WMO codes to readable conditions.
-func mapWMOCode(code int) string {
-	for _, r := range WeatherCodes.WMO.Ranges {
-		if code >= r.Min && code <= r.Max {
-			return r.Condition
-		}
-	}
-	return "Unknown"
-}
-
-// mapTomorrowCode converts Tomorrow.io codes to readable conditions.
-func mapTomorrowCode(code int) string {
-	if condition := WeatherCodes.TomorrowIO[fmt.Sprintf("%d", code)]; condition != "" {
-		return condition
-	}
-	return "Unknown"
-}
-
-// normalizeCondition converts conditions to standard categories.
-// Checks more specific patterns first (e.g., "Partly Cloudy" before "Cloudy").
-func normalizeCondition(c string) string {
-	lower := strings.ToLower(c)
-
-	// Check in priority order (most specific first)
-	conditionOrder := []string{"Partly Cloudy", "Clear", "Cloudy", "Rainy", "Snowy", "Foggy", "Stormy"}
-
-	for _, normalized := range conditionOrder {
-		if info, exists := WeatherCodes.Conditions[normalized]; exists {
-			for _, keyword := range info.Keywords {
-				if strings.Contains(lower, keyword) {
-					return normalized
-				}
-			}
-		}
-	}
-	return c
-}
-
-// GetConditionEmoji maps conditions to emoji. Returns thermometer if no match.
-func GetConditionEmoji(c string) string {
-	lower := strings.ToLower(c)
-	for _, info := range WeatherCodes.Conditions {
-		for _, keyword := range info.Keywords {
-			if strings.Contains(lower, keyword) {
-				return info.Emoji
-			}
-		}
-	}
-	return "🌡️"
-}
@@ -0,0 +1,207 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultRetries is how often a transient HTTP failure is retried unless configured otherwise.
+const DefaultRetries = 2
+
+// ErrNoSources is returned by Aggregator.Fetch when no sources are configured.
+var ErrNoSources = errors.New("no weather sources configured")
+
+// Options tunes how an Aggregator queries its sources.
+type Options struct {
+	Sequential     bool                // fetch one source after another (for performance comparison)
+	SourceTimeout  time.Duration       // per-source deadline derived from ctx; 0 = none
+	MaxConcurrency int                 // max in-flight fetches in concurrent mode; 0 = unlimited
+	Retries        int                 // retries per request for network errors, 429, 5xx and (once) truncated bodies
+	CoordCache     *CoordCache         // persistent coordinate cache; nil disables it
+	Location       *[2]float64         // fixed lat/lon that bypasses geocoding; nil geocodes the city name
+	Country        string              // ISO country code that geocoding matches must have; empty = any
+	Admin          string              // state/region (admin1) that geocoding matches must have; empty = any
+	Metrics        *Metrics            // records request counts and latency per source; nil disables it
+	Logger         *slog.Logger        // diagnostics about fetches and geocoding; nil discards them
+	Forecast       ForecastSpec        // optional forecast; sources without one set ForecastError
+	Trend          bool                // fill WeatherData.Trend from a short hourly forecast where available
+	Trace          bool                // log DNS/connect/TLS/TTFB per request at info level and fill WeatherData.TTFB
+	RateLimiter    *RateLimiter        // spaces out requests per host, shared across runs; nil = unlimited
+	Strategy       AggregationStrategy // used by Aggregator.Aggregate; nil = MeanAggregator
+	UserAgent      string              // sent with every request, see UserAgent; empty = this package's default
+}
+
+// DefaultOptions returns the options the CLI uses without flags.
+func DefaultOptions() Options {
+	return Options{Retries: DefaultRetries}
+}
+
+// Aggregator fetches weather for a city from a set of sources and aggregates the results.
+// It can be embedded in other Go programs; the CLI in package main is a thin wrapper around it.
+type Aggregator struct {
+	Sources    []WeatherSource
+	AirQuality []AirQualitySource // fetched alongside Sources; optional
+	Client     *http.Client       // nil uses DefaultClient
+	Options    Options
+}
+
+// NewAggregator creates an Aggregator using DefaultClient.
+func NewAggregator(sources []WeatherSource, opts Options) *Aggregator {
+	return &Aggregator{Sources: sources, Client: DefaultClient, Options: opts}
+}
+
+// Fetch queries all sources for city. Per-source failures are reported in WeatherData.Error;
+// the returned error is only set if nothing could be fetched at all.
+func (a *Aggregator) Fetch(ctx context.Context, city string) ([]WeatherData, error) {
+	data, _, err := a.FetchCoords(ctx, city)
+	return data, err
+}
+
+// FetchCoords is Fetch that also returns the coordinates the sources were given for city:
+// the fixed Location or the city geocoded once for this call. They are nil if geocoding failed.
+func (a *Aggregator) FetchCoords(ctx context.Context, city string) ([]WeatherData, *[2]float64, error) {
+	if len(a.Sources) == 0 {
+		return nil, nil, ErrNoSources
+	}
+	ctx = a.withConfig(ctx)
+	sources := a.allSources()
+	coordsCache := seedCoordinates(ctx, city, a.Options)
+	var ch <-chan WeatherData
+	if a.Options.Sequential {
+		ch = streamSequential(ctx, city, coordsCache, sources, a.Options)
+	} else {
+		ch = streamConcurrently(ctx, city, coordsCache, sources, a.Options)
+	}
+	data := collect(ch, len(sources))
+	if coords, ok := coordsCache[city]; ok {
+		return data, &coords, nil
+	}
+	return data, nil, nil
+}
+
+// allSources returns the weather sources followed by the adapted air quality sources.
+func (a *Aggregator) allSources() []WeatherSource {
+	if len(a.AirQuality) == 0 {
+		return a.Sources
+	}
+	all := append([]WeatherSource(nil), a.Sources...)
+	for _, s := range a.AirQuality {
+		all = append(all, airQualityAdapter{s})
+	}
+	return all
+}
+
+// Stream is like Fetch but delivers each source's result as soon as it arrives.
+// The channel is closed once all sources are done; results arrive in completion order.
+func (a *Aggregator) Stream(ctx context.Context, city string) (<-chan WeatherData, error) {
+	if len(a.Sources) == 0 {
+		return nil, ErrNoSources
+	}
+	ctx = a.withConfig(ctx)
+	coordsCache := seedCoordinates(ctx, city, a.Options)
+	if a.Options.Sequential {
+		return streamSequential(ctx, city, coordsCache, a.allSources(), a.Options), nil
+	}
+	return streamConcurrently(ctx, city, coordsCache, a.allSources(), a.Options), nil
+}
+
+// Aggregate calculates the aggregation result for data fetched by Fetch with Options.Strategy.
+func (a *Aggregator) Aggregate(data []WeatherData) AggregationResult {
+	if a.Options.Strategy != nil {
+		return a.Options.Strategy.Aggregate(data)
+	}
+	return Aggregate(data)
+}
+
+// Locate returns the place Fetch queries for city, honoring Location, Country and Admin.
+// Places served from the coordinate cache or a fixed Location only carry the city name.
+func (a *Aggregator) Locate(ctx context.Context, city string) (Place, error) {
+	ctx = a.withConfig(ctx)
+	if loc := a.Options.Location; loc != nil {
+		return Place{Name: city, Lat: loc[0], Lon: loc[1]}, nil
+	}
+	return resolvePlace(ctx, city)
+}
+
+// requestConfig carries the Aggregator's HTTP settings through the context to doGet,
+// so the WeatherSource interface doesn't need to know about clients or caches.
+type requestConfig struct {
+	client  *http.Client
+	retries int
+	coords  *CoordCache
+	// location is the fixed lat/lon from Options.Location, used by name-based sources as query
+	location *[2]float64
+	// country and admin narrow geocoding matches
+	country, admin string
+	// geocodes memoizes geocoding for one Fetch/Stream/Locate call; nil disables it
+	geocodes *geocodeOnce
+	// locationKeys remembers AccuWeather location keys for one run; nil disables it
+	locationKeys *locationKeyCache
+	logger       *slog.Logger
+	forecast     ForecastSpec
+	trend        bool
+	trace        bool
+	limiter      *RateLimiter
+	userAgent    string
+	// noRateLimitRetry makes doGet give up on a 429 right away, see keyRing
+	noRateLimitRetry bool
+}
+
+type requestConfigKey struct{}
+
+func (a *Aggregator) withConfig(ctx context.Context) context.Context {
+	cfg := requestConfig{
+		client:       a.Client,
+		retries:      a.Options.Retries,
+		coords:       a.Options.CoordCache,
+		location:     a.Options.Location,
+		country:      a.Options.Country,
+		admin:        a.Options.Admin,
+		logger:       a.Options.Logger,
+		forecast:     a.Options.Forecast,
+		trend:        a.Options.Trend,
+		trace:        a.Options.Trace,
+		limiter:      a.Options.RateLimiter,
+		geocodes:     &geocodeOnce{},
+		locationKeys: &locationKeyCache{},
+		userAgent:    a.Options.UserAgent,
+	}
+	if cfg.client == nil {
+		cfg.client = DefaultClient
+	}
+	if cfg.userAgent == "" {
+		cfg.userAgent = defaultUserAgent
+	}
+	if cfg.logger == nil {
+		cfg.logger = discardLogger
+	}
+	if id := RequestIDFrom(ctx); id != "" {
+		cfg.logger = cfg.logger.With("request_id", id)
+	}
+	return context.WithValue(ctx, requestConfigKey{}, cfg)
+}
+
+// configFrom returns the request config stored in ctx, or the package defaults.
+func configFrom(ctx context.Context) requestConfig {
+	if cfg, ok := ctx.Value(requestConfigKey{}).(requestConfig); ok {
+		return cfg
+	}
+	return requestConfig{client: DefaultClient, retries: DefaultRetries, logger: discardLogger, userAgent: defaultUserAgent}
+}
+
+// discardLogger is used when no Logger is configured.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// locationQuery returns the fixed location from ctx as "lat,lon" for sources that query by name.
+// Without a fixed location the city name is returned unchanged.
+func locationQuery(ctx context.Context, city string) string {
+	if loc := configFrom(ctx).location; loc != nil {
+		return fmt.Sprintf("%g,%g", loc[0], loc[1])
+	}
+	return city
+}
@@ -0,0 +1,83 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// AirQualitySource fetches air pollution readings. It is separate from WeatherSource since
+// the data set is different; its results are WeatherData with AirQuality set and only
+// AQI/PM25 filled, so they run through the same fetch pipeline but are not aggregated as weather.
+type AirQualitySource interface {
+	FetchAirQuality(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData
+	Name() string
+}
+
+// OpenMeteoAirQualitySource - no key required, coordinate-based.
+type OpenMeteoAirQualitySource struct{ baseURL string }
+
+func (o *OpenMeteoAirQualitySource) Name() string { return "Open-Meteo AQ" }
+func (o *OpenMeteoAirQualitySource) FetchAirQuality(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	res := WeatherData{Source: o.Name(), AirQuality: true}
+	lat, lon, err := getCoordinates(ctx, city, coordsCache)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	base := baseURLOr(o.baseURL, "https://air-quality-api.open-meteo.com")
+	resp, err := doGet(ctx, fmt.Sprintf("%s/v1/air-quality?latitude=%.4f&longitude=%.4f&current=us_aqi,pm2_5", base, lat, lon))
+	if err != nil {
+		res.Error = fmt.Errorf("air quality request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Current struct {
+			AQI  *float64 `json:"us_aqi"`
+			PM25 *float64 `json:"pm2_5"`
+		} `json:"current"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode air quality response: %w", err)
+		return res
+	}
+	if data.Current.AQI == nil && data.Current.PM25 == nil {
+		res.Error = fmt.Errorf("no air quality data for this location")
+		return res
+	}
+	if data.Current.AQI != nil {
+		aqi := int(*data.Current.AQI + 0.5)
+		res.AQI = &aqi
+	}
+	res.PM25 = data.Current.PM25
+	return res
+}
+
+// airQualityAdapter runs an AirQualitySource as WeatherSource, so timeouts, caching,
+// metrics and logging apply to it as well.
+type airQualityAdapter struct{ AirQualitySource }
+
+func (a airQualityAdapter) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	d := a.FetchAirQuality(ctx, city, coordsCache)
+	d.AirQuality = true
+	return d
+}
+
+// AQICategory names the US EPA category of an AQI value.
+func AQICategory(aqi int) string {
+	switch {
+	case aqi <= 50:
+		return "Good"
+	case aqi <= 100:
+		return "Moderate"
+	case aqi <= 150:
+		return "Unhealthy for Sensitive Groups"
+	case aqi <= 200:
+		return "Unhealthy"
+	case aqi <= 300:
+		return "Very Unhealthy"
+	default:
+		return "Hazardous"
+	}
+}
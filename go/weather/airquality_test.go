@@ -0,0 +1,63 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenMeteoAirQuality(t *testing.T) {
+	var gotPath, gotQuery string
+	body := `{"latitude":52.52,"longitude":13.42,"current_units":{"us_aqi":"USAQI","pm2_5":"μg/m³"},
+		"current":{"time":"2026-10-14T12:00","interval":3600,"us_aqi":42,"pm2_5":8.1}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	agg := NewAggregator([]WeatherSource{&mockSource{name: "W", temp: 10, cond: "Clear"}}, Options{Location: &[2]float64{52.52, 13.41}})
+	agg.AirQuality = []AirQualitySource{&OpenMeteoAirQualitySource{baseURL: srv.URL}}
+	data, err := agg.Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/v1/air-quality" || gotQuery != "latitude=52.5200&longitude=13.4100&current=us_aqi,pm2_5" {
+		t.Errorf("request = %s?%s", gotPath, gotQuery)
+	}
+
+	var aq *WeatherData
+	for i := range data {
+		if data[i].AirQuality {
+			aq = &data[i]
+		}
+	}
+	if aq == nil || aq.Error != nil || aq.AQI == nil || *aq.AQI != 42 || aq.PM25 == nil || *aq.PM25 != 8.1 {
+		t.Fatalf("air quality result = %+v", aq)
+	}
+
+	// Air quality results don't count as weather readings
+	res := Aggregate(data)
+	if res.Valid != 1 || res.Total != 1 || res.AvgTemp != 10 || res.AQI == nil || *res.AQI != 42 || *res.PM25 != 8.1 {
+		t.Errorf("aggregate = %+v", res)
+	}
+	withAQ := append(data, WeatherData{Source: "X", Temperature: 11}, WeatherData{Source: "Y", Temperature: 9})
+	if _, rejected := RejectOutliers(withAQ, 2); rejected != 0 {
+		t.Errorf("rejected %d, want the air quality result ignored", rejected)
+	}
+
+	body = `{"current":{"time":"2026-10-14T12:00","us_aqi":null,"pm2_5":null}}`
+	if d := (&OpenMeteoAirQualitySource{baseURL: srv.URL}).FetchAirQuality(context.Background(), "Berlin", map[string][2]float64{"Berlin": {1, 2}}); d.Error == nil {
+		t.Error("expected error for a payload without readings")
+	}
+}
+
+func TestAQICategory(t *testing.T) {
+	for aqi, want := range map[int]string{0: "Good", 50: "Good", 51: "Moderate", 150: "Unhealthy for Sensitive Groups", 200: "Unhealthy", 300: "Very Unhealthy", 301: "Hazardous"} {
+		if got := AQICategory(aqi); got != want {
+			t.Errorf("AQICategory(%d) = %q, want %q", aqi, got, want)
+		}
+	}
+}
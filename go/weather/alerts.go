@@ -0,0 +1,43 @@
+package weather
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Alert is an active severe weather warning reported by a source.
+type Alert struct {
+	Title    string
+	Severity string     // provider wording, e.g. "Warning" or "Moderate"; empty if not given
+	Expires  *time.Time // nil if the alert has no end time
+	// Sources lists who reported the alert; MergeAlerts collects all of them
+	Sources []string
+}
+
+// MergeAlerts returns the alerts of all valid results, deduplicated by title (case-insensitive).
+// The first report of an alert wins; later duplicates only add their source.
+func MergeAlerts(data []WeatherData) []Alert {
+	var merged []Alert
+	index := make(map[string]int)
+	for _, d := range data {
+		if d.Error != nil {
+			continue
+		}
+		for _, a := range d.Alerts {
+			key := strings.ToLower(strings.TrimSpace(a.Title))
+			if i, ok := index[key]; ok {
+				for _, s := range a.Sources {
+					if !slices.Contains(merged[i].Sources, s) {
+						merged[i].Sources = append(merged[i].Sources, s)
+					}
+				}
+				continue
+			}
+			index[key] = len(merged)
+			a.Sources = slices.Clone(a.Sources)
+			merged = append(merged, a)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,99 @@
+package weather
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSourceAlerts(t *testing.T) {
+	const expires = 1791997200 // 2026-10-14 17:00 UTC
+	tests := []struct {
+		name string
+		src  WeatherSource
+		body string
+		want []Alert
+	}{
+		{
+			name: "Pirate Weather with alerts",
+			src:  &PirateWeatherSource{key: "k"},
+			body: fmt.Sprintf(`{"offset":2,"currently":{"temperature":9,"humidity":0.8,"summary":"Windy"},
+				"alerts":[{"title":"Wind Advisory","severity":"Advisory","expires":%d,"description":"Gusts up to 80 km/h"},
+				          {"title":"Flood Watch","severity":"Watch"}]}`, expires),
+			want: []Alert{
+				{Title: "Wind Advisory", Severity: "Advisory", Expires: unixTimeIn(expires, time.UTC)},
+				{Title: "Flood Watch", Severity: "Watch"},
+			},
+		},
+		{
+			name: "Pirate Weather without alerts",
+			src:  &PirateWeatherSource{key: "k"},
+			body: `{"offset":2,"currently":{"temperature":9,"humidity":0.8,"summary":"Clear"}}`,
+		},
+		{
+			name: "WeatherAPI with alerts",
+			src:  &WeatherAPISource{key: "k"},
+			body: `{"current":{"temp_c":9,"humidity":80,"condition":{"text":"Windy"}},
+				"alerts":{"alert":[{"headline":"Wind Advisory","event":"Wind","severity":"Moderate","expires":"2026-10-14T19:00:00+02:00"},
+				                   {"headline":"","event":"Coastal Flood Warning","severity":"Severe","expires":""}]}}`,
+			want: []Alert{
+				{Title: "Wind Advisory", Severity: "Moderate", Expires: unixTimeIn(expires, time.UTC)},
+				{Title: "Coastal Flood Warning", Severity: "Severe"},
+			},
+		},
+		{
+			name: "WeatherAPI without alerts",
+			src:  &WeatherAPISource{key: "k"},
+			body: `{"current":{"temp_c":9,"humidity":80,"condition":{"text":"Clear"}},"alerts":{}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, q := fetchRecorded(t, tt.src, ForecastSpec{}, tt.body)
+			if _, ok := tt.src.(*WeatherAPISource); ok && q.Get("alerts") != "yes" {
+				t.Errorf("query = %v, want alerts=yes", q)
+			}
+			if len(got.Alerts) != len(tt.want) {
+				t.Fatalf("got %d alerts, want %d: %+v", len(got.Alerts), len(tt.want), got.Alerts)
+			}
+			for i, w := range tt.want {
+				g := got.Alerts[i]
+				expOK := (g.Expires == nil) == (w.Expires == nil) && (g.Expires == nil || g.Expires.Equal(*w.Expires))
+				if g.Title != w.Title || g.Severity != w.Severity || !expOK {
+					t.Errorf("alert %d = %q %q %v, want %q %q %v", i, g.Title, g.Severity, g.Expires, w.Title, w.Severity, w.Expires)
+				}
+				if len(g.Sources) != 1 || g.Sources[0] != tt.src.Name() {
+					t.Errorf("alert %d sources = %v, want [%s]", i, g.Sources, tt.src.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestMergeAlerts(t *testing.T) {
+	data := []WeatherData{
+		{Source: "A", Alerts: []Alert{{Title: "Wind Advisory", Severity: "Advisory", Sources: []string{"A"}}}},
+		{Source: "B", Error: &testError{}, Alerts: []Alert{{Title: "Ignored", Sources: []string{"B"}}}},
+		{Source: "C", Alerts: []Alert{
+			{Title: " wind advisory", Severity: "Moderate", Sources: []string{"C"}},
+			{Title: "Flood Watch", Sources: []string{"C"}},
+		}},
+	}
+	got := MergeAlerts(data)
+	if len(got) != 2 {
+		t.Fatalf("got %d alerts, want 2: %+v", len(got), got)
+	}
+	if got[0].Title != "Wind Advisory" || got[0].Severity != "Advisory" || fmt.Sprint(got[0].Sources) != "[A C]" {
+		t.Errorf("merged alert = %+v, want the first report with sources [A C]", got[0])
+	}
+	if got[1].Title != "Flood Watch" {
+		t.Errorf("second alert = %q, want Flood Watch", got[1].Title)
+	}
+	// Merging must not modify the sources' own alerts
+	if len(data[0].Alerts[0].Sources) != 1 {
+		t.Errorf("source alert modified: %v", data[0].Alerts[0].Sources)
+	}
+	if res := Aggregate(data); len(res.Alerts) != 2 {
+		t.Errorf("Aggregate has %d alerts, want 2", len(res.Alerts))
+	}
+}
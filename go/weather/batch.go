@@ -0,0 +1,44 @@
+package weather
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CityResult holds the fetched data for one city of a batch run.
+type CityResult struct {
+	City     string
+	Data     []WeatherData
+	Start    time.Time // when this city's fetch began, not the whole batch
+	Duration time.Duration
+}
+
+// FetchCities runs fetch for every city using a pool of workers, so ten cities
+// don't open ten times the connections at once. Results keep the order of cities.
+func FetchCities(ctx context.Context, cities []string, workers int, fetch func(context.Context, string) []WeatherData) []CityResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]CityResult, len(cities))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(cities); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				data := fetch(ctx, cities[i])
+				results[i] = CityResult{City: cities[i], Data: data, Start: start, Duration: time.Since(start)}
+			}
+		}()
+	}
+	for i := range cities {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// cityMockSource reports a temperature that depends on the requested city.
+type cityMockSource struct {
+	name  string
+	temps map[string]float64
+}
+
+func (c *cityMockSource) Name() string { return c.name }
+
+func (c *cityMockSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return WeatherData{Source: c.name, Temperature: c.temps[city], Humidity: floatPtr(50), Condition: "Clear"}
+}
+
+func TestFetchCities(t *testing.T) {
+	sources := []WeatherSource{
+		&cityMockSource{name: "S1", temps: map[string]float64{"Berlin": 10, "Rome": 20}},
+		&cityMockSource{name: "S2", temps: map[string]float64{"Berlin": 12, "Rome": 24}},
+	}
+	fetch := func(ctx context.Context, city string) []WeatherData {
+		results := make([]WeatherData, 0, len(sources))
+		for _, s := range sources {
+			results = append(results, s.Fetch(ctx, city, nil))
+		}
+		return results
+	}
+
+	for _, workers := range []int{1, 2, 5} {
+		results := FetchCities(context.Background(), []string{"Berlin", "Rome"}, workers, fetch)
+		if len(results) != 2 {
+			t.Fatalf("workers=%d: got %d results, want 2", workers, len(results))
+		}
+		if results[0].City != "Berlin" || results[1].City != "Rome" {
+			t.Errorf("workers=%d: order = %q, %q", workers, results[0].City, results[1].City)
+		}
+		berlin, rome := Aggregate(results[0].Data), Aggregate(results[1].Data)
+		if berlin.AvgTemp != 11 || rome.AvgTemp != 22 {
+			t.Errorf("workers=%d: avg temps = %.1f, %.1f; want 11, 22", workers, berlin.AvgTemp, rome.AvgTemp)
+		}
+		if berlin.Valid != 2 || rome.Valid != 2 {
+			t.Errorf("workers=%d: valid = %d, %d; want 2, 2", workers, berlin.Valid, rome.Valid)
+		}
+	}
+
+	// With one worker Rome starts after Berlin finished, so its start is its own
+	slow := func(ctx context.Context, city string) []WeatherData {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	results := FetchCities(context.Background(), []string{"Berlin", "Rome"}, 1, slow)
+	if end := results[0].Start.Add(results[0].Duration); results[1].Start.Before(end) {
+		t.Errorf("Rome start %v is before Berlin finished at %v", results[1].Start, end)
+	}
+}
@@ -0,0 +1,180 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config selects and tunes the weather sources, as an alternative to InitSources.
+// It is loaded from a JSON file like:
+//
+//	{"sources": [
+//	  {"name": "Open-Meteo"},
+//	  {"name": "WeatherAPI.com", "key_env": "MY_WEATHERAPI_KEY", "weight": 2},
+//	  {"name": "Pirate-Weather", "key": "…", "timeout": "3s"},
+//	  {"name": "OpenWeatherMap", "base_url": "http://owm-cache.internal:8080"},
+//	  {"name": "My Station", "generic": {"url": "http://station.local/now.json", "temperature": "outdoor.temp"}}
+//	]}
+type Config struct {
+	Sources []SourceConfig `json:"sources"`
+}
+
+// SourceConfig enables one source.
+type SourceConfig struct {
+	Name    string  `json:"name"`               // source name, e.g. "WeatherAPI.com"; case, spaces, dots and dashes are ignored
+	Key     string  `json:"key,omitempty"`      // API key; takes precedence over KeyEnv
+	KeyEnv  string  `json:"key_env,omitempty"`  // environment variable holding the key; defaults to the source's usual one
+	Weight  float64 `json:"weight,omitempty"`   // relative weight in the mean temperature and humidity; 0 = 1
+	Timeout string  `json:"timeout,omitempty"`  // per-source timeout, e.g. "3s"; empty = none
+	BaseURL string  `json:"base_url,omitempty"` // mirror or caching proxy, e.g. "http://localhost:8081"; empty = public endpoint
+	// Generic defines a source without a dedicated type (see GenericSpec); Name is then free
+	// to choose, and Key or KeyEnv fill the URL's {key}
+	Generic *GenericSpec `json:"generic,omitempty"`
+}
+
+// LoadConfig reads and validates a JSON config file.
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+	defer f.Close()
+	var cfg Config
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if _, err := cfg.NewSources(); err != nil {
+		return Config{}, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// NewSources creates the configured sources in config order.
+// Unknown or duplicate names, missing API keys and invalid weights or timeouts are errors.
+func (c Config) NewSources() ([]WeatherSource, error) {
+	if len(c.Sources) == 0 {
+		return nil, fmt.Errorf("no sources configured")
+	}
+	seen := make(map[string]bool)
+	sources := make([]WeatherSource, 0, len(c.Sources))
+	for _, sc := range c.Sources {
+		var src WeatherSource
+		var err error
+		if sc.Generic != nil {
+			src, err = sc.newGenericSource()
+		} else {
+			src, err = sc.newSource()
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := NormalizeSourceName(src.Name())
+		if seen[name] {
+			return nil, fmt.Errorf("source %q is configured twice", src.Name())
+		}
+		seen[name] = true
+
+		if sc.Weight < 0 {
+			return nil, fmt.Errorf("source %q: weight must not be negative", src.Name())
+		}
+		var timeout time.Duration
+		if sc.Timeout != "" {
+			d, err := time.ParseDuration(sc.Timeout)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("source %q: invalid timeout %q", src.Name(), sc.Timeout)
+			}
+			timeout = d
+		}
+		if sc.Weight > 0 || timeout > 0 {
+			src = &configuredSource{WeatherSource: src, weight: sc.Weight, timeout: timeout}
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// newSource creates one of the built-in sources.
+func (sc SourceConfig) newSource() (WeatherSource, error) {
+	f, ok := findSourceFactory(sc.Name)
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (known: %s)", sc.Name, knownSourceNames())
+	}
+	key := sc.Key
+	if key == "" && f.envKey != "" {
+		env := sc.KeyEnv
+		if env == "" {
+			env = f.envKey
+		}
+		var err error
+		if key, err = apiKey(env); err != nil {
+			return nil, fmt.Errorf("source %q: %w", f.name, err)
+		} else if key == "" {
+			return nil, fmt.Errorf("source %q needs an API key: set key or the %s environment variable", f.name, env)
+		}
+	}
+	if f.envKey != "" && len(splitKeys(key)) == 0 {
+		return nil, fmt.Errorf("source %q: key %q contains no API key", f.name, key)
+	}
+	if sc.BaseURL != "" {
+		if u, err := url.Parse(sc.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("source %q: invalid base_url %q", f.name, sc.BaseURL)
+		}
+	}
+	return f.create(key, sc.BaseURL), nil
+}
+
+// newGenericSource creates a source from sc.Generic. Its name must not shadow a built-in source.
+func (sc SourceConfig) newGenericSource() (WeatherSource, error) {
+	if f, ok := findSourceFactory(sc.Name); ok {
+		return nil, fmt.Errorf("generic source %q clashes with the built-in %s", sc.Name, f.name)
+	}
+	if sc.BaseURL != "" {
+		return nil, fmt.Errorf("source %q: base_url has no effect on generic sources, put it into generic.url", sc.Name)
+	}
+	key := sc.Key
+	if key == "" && sc.KeyEnv != "" {
+		var err error
+		if key, err = apiKey(sc.KeyEnv); err != nil {
+			return nil, fmt.Errorf("source %q: %w", sc.Name, err)
+		}
+	}
+	return NewGenericSource(sc.Name, *sc.Generic, key)
+}
+
+func findSourceFactory(name string) (sourceFactory, bool) {
+	for _, f := range sourceFactories {
+		if NormalizeSourceName(f.name) == NormalizeSourceName(name) {
+			return f, true
+		}
+	}
+	return sourceFactory{}, false
+}
+
+func knownSourceNames() string {
+	return strings.Join(SourceNames(), ", ")
+}
+
+// configuredSource applies a source's configured timeout and weight.
+type configuredSource struct {
+	WeatherSource
+	weight  float64
+	timeout time.Duration
+}
+
+func (c *configuredSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	data := c.WeatherSource.Fetch(ctx, city, coordsCache)
+	data.Weight = c.weight
+	return data
+}
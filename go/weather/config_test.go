@@ -0,0 +1,174 @@
+package weather
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sources.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("PIRATE_WEATHER_API_KEY", "from-env")
+	t.Setenv("MY_OWM_KEY", "custom-env")
+	path := writeConfig(t, `{"sources": [
+		{"name": "pirate weather", "weight": 2},
+		{"name": "OpenWeatherMap", "key_env": "MY_OWM_KEY", "timeout": "3s"},
+		{"name": "WeatherAPI.com", "key": "inline", "base_url": "http://mirror.local/"}
+	]}`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources, err := cfg.NewSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range sources {
+		names = append(names, s.Name())
+	}
+	if got := strings.Join(names, ","); got != "Pirate-Weather,OpenWeatherMap,WeatherAPI.com" {
+		t.Fatalf("sources = %s, want the configured subset in config order", got)
+	}
+
+	pirate := sources[0].(*configuredSource)
+	if pirate.weight != 2 || pirate.WeatherSource.(*PirateWeatherSource).key != "from-env" {
+		t.Errorf("Pirate-Weather = %+v, want weight 2 and the default env key", pirate)
+	}
+	owm := sources[1].(*configuredSource)
+	if owm.timeout != 3*time.Second || owm.WeatherSource.(*OpenWeatherSource).key != "custom-env" {
+		t.Errorf("OpenWeatherMap = %+v, want 3s timeout and the key from MY_OWM_KEY", owm)
+	}
+	if w, ok := sources[2].(*WeatherAPISource); !ok || w.key != "inline" || w.baseURL != "http://mirror.local/" {
+		t.Errorf("WeatherAPI.com = %#v, want an unwrapped source with the inline key and mirror", sources[2])
+	}
+}
+
+func TestLoadConfigGeneric(t *testing.T) {
+	t.Setenv("STATION_TOKEN", "tok")
+	cfg, err := LoadConfig(writeConfig(t, `{"sources": [
+		{"name": "Open-Meteo"},
+		{"name": "Station", "key_env": "STATION_TOKEN", "weight": 0.5,
+		 "generic": {"url": "http://station.local/now?token={key}", "temperature": "outdoor.temp", "humidity": "outdoor.hum"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources, err := cfg.NewSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	station, ok := sources[1].(*configuredSource)
+	if !ok || station.weight != 0.5 || station.Name() != "Station" {
+		t.Fatalf("sources[1] = %#v, want the weighted generic source", sources[1])
+	}
+	if g := station.WeatherSource.(*GenericSource); g.key != "tok" || g.spec.Humidity != "outdoor.hum" {
+		t.Errorf("generic source = %+v, want the key from STATION_TOKEN and the configured paths", g)
+	}
+}
+
+func TestAPIKeyFile(t *testing.T) {
+	for _, f := range sourceFactories {
+		if f.envKey != "" {
+			t.Setenv(f.envKey, "")
+			t.Setenv(f.envKey+"_FILE", "")
+		}
+	}
+	secret := filepath.Join(t.TempDir(), "weatherapi_key")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEATHER_API_COM_KEY_FILE", secret)
+	t.Setenv("PIRATE_WEATHER_API_KEY", "from-env")
+	t.Setenv("PIRATE_WEATHER_API_KEY_FILE", secret)
+	t.Setenv("METEOSOURCE_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	sources := InitSources()
+	var names []string
+	for _, s := range sources {
+		names = append(names, s.Name())
+	}
+	if got := strings.Join(names, ","); got != "Open-Meteo,WeatherAPI.com,Pirate-Weather" {
+		t.Fatalf("sources = %s, want the key file and env sources but not the missing file", got)
+	}
+	if key := sources[1].(*WeatherAPISource).key; key != "from-file" {
+		t.Errorf("WeatherAPI.com key = %q, want the trimmed file contents", key)
+	}
+	if key := sources[2].(*PirateWeatherSource).key; key != "from-env" {
+		t.Errorf("Pirate-Weather key = %q, want the variable to take precedence over the file", key)
+	}
+
+	for _, info := range ListSources() {
+		switch info.Name {
+		case "WeatherAPI.com":
+			if !info.KeyPresent || info.KeyError != nil {
+				t.Errorf("%s = %+v, want the key present", info.Name, info)
+			}
+		case "Meteosource":
+			if info.KeyPresent || info.KeyError == nil || !strings.Contains(info.KeyError.Error(), "METEOSOURCE_API_KEY_FILE") {
+				t.Errorf("%s = %+v, want an error naming METEOSOURCE_API_KEY_FILE", info.Name, info)
+			}
+		}
+	}
+	cfg := &Config{Sources: []SourceConfig{{Name: "WeatherAPI.com"}, {Name: "Meteosource"}}}
+	if _, err := cfg.NewSources(); err == nil || !strings.Contains(err.Error(), "METEOSOURCE_API_KEY_FILE") {
+		t.Errorf("NewSources error = %v, want the unreadable key file", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	t.Setenv("METEOSOURCE_API_KEY", "")
+	tests := []struct {
+		name, content, wantErr string
+	}{
+		{"unknown source", `{"sources":[{"name":"wttr.in"}]}`, `unknown source "wttr.in"`},
+		{"duplicate", `{"sources":[{"name":"Open-Meteo"},{"name":"open meteo"}]}`, "configured twice"},
+		{"missing key", `{"sources":[{"name":"Meteosource"}]}`, "METEOSOURCE_API_KEY"},
+		{"bad timeout", `{"sources":[{"name":"Open-Meteo","timeout":"soon"}]}`, "invalid timeout"},
+		{"negative weight", `{"sources":[{"name":"Open-Meteo","weight":-1}]}`, "weight"},
+		{"unknown field", `{"sources":[{"name":"Open-Meteo","wieght":2}]}`, "wieght"},
+		{"empty", `{"sources":[]}`, "no sources"},
+		{"bad base URL", `{"sources":[{"name":"Open-Meteo","base_url":"localhost:8080"}]}`, "invalid base_url"},
+		{"generic shadowing built-in", `{"sources":[{"name":"Open Meteo","generic":{"url":"https://x","temperature":"t"}}]}`, "clashes with the built-in Open-Meteo"},
+		{"generic without temperature", `{"sources":[{"name":"Station","generic":{"url":"https://x"}}]}`, "temperature path"},
+		{"generic duplicate", `{"sources":[{"name":"Station","generic":{"url":"https://x","temperature":"t"}},{"name":"station","generic":{"url":"https://y","temperature":"t"}}]}`, "configured twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfiguredSource(t *testing.T) {
+	slow := &configuredSource{WeatherSource: &mockSlowSource{name: "Slow", delay: time.Second}, timeout: 20 * time.Millisecond}
+	weighted := &configuredSource{WeatherSource: &mockSource{name: "Heavy", temp: 20, hum: 40}, weight: 3}
+	data, err := NewAggregator([]WeatherSource{slow, weighted, &mockSource{name: "Light", temp: 10, hum: 80}},
+		Options{Location: &[2]float64{0, 0}}).Fetch(context.Background(), "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range data {
+		if (d.Source == "Slow") != (d.Error != nil) {
+			t.Errorf("%s error = %v, want a timeout error only for the slow source", d.Source, d.Error)
+		}
+	}
+	res := Aggregate(data)
+	if res.AvgTemp != 17.5 || res.AvgHumidity != 50 || res.MedianTemp != 15 {
+		t.Errorf("avg temp/hum = %.2f/%.2f, median %.2f; want weighted 17.5/50 and unweighted median 15", res.AvgTemp, res.AvgHumidity, res.MedianTemp)
+	}
+}
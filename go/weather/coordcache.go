@@ -0,0 +1,178 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CoordCacheTTL is how long a geocoded city stays valid in the on-disk cache.
+const CoordCacheTTL = 30 * 24 * time.Hour
+
+// NotFoundCacheTTL is how long a city that no geocoder knows is remembered as missing,
+// so repeated requests for a misspelled name fail fast. Short, because geocoders add places.
+const NotFoundCacheTTL = 10 * time.Minute
+
+// coordEntry is one cached geocoding result.
+type coordEntry struct {
+	Lat     float64   `json:"lat"`
+	Lon     float64   `json:"lon"`
+	Fetched time.Time `json:"fetched"`
+	// NotFound marks a negative entry: no geocoder found the city; Lat/Lon are unused
+	NotFound bool `json:"not_found,omitempty"`
+}
+
+// CoordCache maps normalized city names to coordinates and persists them as JSON.
+// Safe for concurrent use by the fetch goroutines.
+type CoordCache struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	entries map[string]coordEntry
+}
+
+// DefaultCoordCachePath returns the cache file location under the user cache dir.
+func DefaultCoordCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "weather-aggregator", "coords.json")
+}
+
+// LoadCoordCache reads the cache file at path. A missing or corrupt file yields an empty cache.
+func LoadCoordCache(path string, ttl time.Duration) *CoordCache {
+	c := &CoordCache{path: path, ttl: ttl, entries: make(map[string]coordEntry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil || c.entries == nil {
+		c.entries = make(map[string]coordEntry)
+	}
+	return c
+}
+
+// coordCacheKey normalizes a city name so "berlin " and "Berlin" share an entry.
+func coordCacheKey(city string) string {
+	return strings.ToLower(strings.TrimSpace(city))
+}
+
+// get returns cached coordinates for city if present and not expired.
+func (c *CoordCache) get(city string, now time.Time) (float64, float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[coordCacheKey(city)]
+	if !ok || e.NotFound || now.Sub(e.Fetched) > c.ttl {
+		return 0, 0, false
+	}
+	return e.Lat, e.Lon, true
+}
+
+// knownMissing reports whether city was recently cached as not found, see NotFoundCacheTTL.
+func (c *CoordCache) knownMissing(city string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[coordCacheKey(city)]
+	return ok && e.NotFound && now.Sub(e.Fetched) <= min(c.ttl, NotFoundCacheTTL)
+}
+
+// putMissing stores a negative entry for city and writes the cache file.
+func (c *CoordCache) putMissing(city string, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[coordCacheKey(city)] = coordEntry{Fetched: now, NotFound: true}
+	return c.save()
+}
+
+// put stores coordinates for city and writes the cache file.
+func (c *CoordCache) put(city string, lat, lon float64, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[coordCacheKey(city)] = coordEntry{Lat: lat, Lon: lon, Fetched: now}
+	return c.save()
+}
+
+// save writes the cache atomically via a temp file so concurrent runs never see a partial file.
+// Callers must hold c.mu.
+func (c *CoordCache) save() error {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode coordinate cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".coords-*.json")
+	if err != nil {
+		return fmt.Errorf("write coordinate cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write coordinate cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write coordinate cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// placeKey is the cache key for city under the active Country/Admin filter,
+// so "Springfield" in Illinois and in Missouri don't overwrite each other.
+func placeKey(city string, cfg requestConfig) string {
+	if cfg.country == "" && cfg.admin == "" {
+		return city
+	}
+	return city + "|" + cfg.admin + "|" + cfg.country
+}
+
+// resolveCoordinates geocodes city, consulting the Aggregator's persistent cache first.
+func resolveCoordinates(ctx context.Context, city string) (float64, float64, error) {
+	p, err := resolvePlace(ctx, city)
+	return p.Lat, p.Lon, err
+}
+
+// resolvePlace is resolveCoordinates returning the matched place. Cache hits only carry the city name.
+// Failing to write the cache is not an error; the place is still returned.
+// Within one run each city is resolved at most once, see geocodeOnce.
+func resolvePlace(ctx context.Context, city string) (Place, error) {
+	cfg := configFrom(ctx)
+	key := placeKey(city, cfg)
+	if cfg.geocodes == nil {
+		return lookupPlace(ctx, city, key, cfg)
+	}
+	return cfg.geocodes.do(key, func() (Place, error) { return lookupPlace(ctx, city, key, cfg) })
+}
+
+// lookupPlace resolves city from the persistent cache or, on a miss, by geocoding it.
+// Cities no geocoder knows are cached as missing too; network failures are not cached.
+func lookupPlace(ctx context.Context, city, key string, cfg requestConfig) (Place, error) {
+	if cfg.coords != nil {
+		now := time.Now()
+		if lat, lon, ok := cfg.coords.get(key, now); ok {
+			cfg.logger.Debug("coordinates from cache", "city", city, "lat", lat, "lon", lon)
+			return Place{Name: city, Lat: lat, Lon: lon}, nil
+		}
+		if cfg.coords.knownMissing(key, now) {
+			cfg.logger.Debug("city not found (cached)", "city", city)
+			return Place{}, fmt.Errorf("%w (cached)", notFound(cfg, city))
+		}
+	}
+	p, err := geocodePlace(ctx, city)
+	if err != nil {
+		if cfg.coords != nil && allNotFound(err) {
+			_ = cfg.coords.putMissing(key, time.Now())
+		}
+		return Place{}, err
+	}
+	if cfg.coords != nil {
+		_ = cfg.coords.put(key, p.Lat, p.Lon, time.Now())
+	}
+	return p, nil
+}
@@ -0,0 +1,112 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCoordCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "coords.json")
+	now := time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	c := LoadCoordCache(path, time.Hour)
+	if _, _, ok := c.get("Berlin", now); ok {
+		t.Fatal("empty cache reported a hit")
+	}
+	if err := c.put("Berlin", 52.52, 13.41, now); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	t.Run("hit after reload", func(t *testing.T) {
+		reloaded := LoadCoordCache(path, time.Hour)
+		lat, lon, ok := reloaded.get(" berlin", now.Add(30*time.Minute))
+		if !ok || lat != 52.52 || lon != 13.41 {
+			t.Errorf("get = %.2f, %.2f, %v; want 52.52, 13.41, true", lat, lon, ok)
+		}
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		if _, _, ok := c.get("Munich", now); ok {
+			t.Error("unexpected hit for uncached city")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if _, _, ok := c.get("Berlin", now.Add(2*time.Hour)); ok {
+			t.Error("expired entry reported a hit")
+		}
+	})
+
+	t.Run("corrupt file", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "coords.json")
+		if err := os.WriteFile(bad, []byte("{not json"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		c := LoadCoordCache(bad, time.Hour)
+		if len(c.entries) != 0 {
+			t.Errorf("entries = %v, want empty", c.entries)
+		}
+		if err := c.put("Paris", 48.85, 2.35, now); err != nil {
+			t.Errorf("put after corrupt load failed: %v", err)
+		}
+	})
+}
+
+func TestResolveCoordinatesUsesPersistentCache(t *testing.T) {
+	c := LoadCoordCache(filepath.Join(t.TempDir(), "coords.json"), time.Hour)
+	if err := c.put("Atlantis", 1.5, -2.5, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cache hit must not touch the network; the canceled context would fail any request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx = (&Aggregator{Options: Options{CoordCache: c}}).withConfig(ctx)
+	lat, lon, err := getCoordinates(ctx, "Atlantis", nil)
+	if err != nil || lat != 1.5 || lon != -2.5 {
+		t.Errorf("getCoordinates = %.1f, %.1f, %v; want 1.5, -2.5, nil", lat, lon, err)
+	}
+}
+
+func TestCoordCacheNotFound(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		err       error
+		wantCalls int32
+	}{
+		{"not found is cached", notFound(requestConfig{}, "Atlantis"), 1},
+		{"network error is not cached", errors.New("connection refused"), 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			geo := &countingGeocoder{err: tt.err}
+			withGeocoders(t, geo)
+			c := LoadCoordCache(filepath.Join(t.TempDir(), "coords.json"), time.Hour)
+			// separate runs, so only the persistent cache can save the second lookup
+			for i := 0; i < 2; i++ {
+				ctx := (&Aggregator{Options: Options{CoordCache: c}}).withConfig(context.Background())
+				if _, _, err := getCoordinates(ctx, "Atlantis", nil); err == nil {
+					t.Fatal("lookup succeeded, want an error")
+				}
+			}
+			if n := geo.calls.Load(); n != tt.wantCalls {
+				t.Errorf("%d geocode calls, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+
+	c := LoadCoordCache(filepath.Join(t.TempDir(), "coords.json"), time.Hour)
+	now := time.Now()
+	if err := c.putMissing("Atlantis", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.get("Atlantis", now); ok {
+		t.Error("negative entry reported as coordinates")
+	}
+	if c.knownMissing("Atlantis", now.Add(NotFoundCacheTTL+time.Minute)) {
+		t.Error("negative entry outlived NotFoundCacheTTL")
+	}
+}
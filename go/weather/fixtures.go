@@ -0,0 +1,47 @@
+package weather
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// FixtureTransport is an http.RoundTripper that answers from canned JSON files instead of
+// the network, for demos and CI: a request to host h gets the contents of <Dir>/<h>.json,
+// e.g. api.open-meteo.com.json. Responses still go through the sources' real decoders.
+// Hosts without a fixture get a 404, so their source fails like an unreachable API.
+type FixtureTransport struct{ Dir string }
+
+func (f FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := http.StatusOK
+	body, err := os.ReadFile(filepath.Join(f.Dir, req.URL.Hostname()+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		status = http.StatusNotFound
+		body = []byte(fmt.Sprintf(`{"error":"no fixture for %s"}`, req.URL.Hostname()))
+	} else if err != nil {
+		return nil, fmt.Errorf("read fixture: %w", err)
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// FixtureSources creates every known source with a placeholder API key,
+// for use with FixtureTransport where no real keys are needed.
+func FixtureSources() []WeatherSource {
+	sources := make([]WeatherSource, len(sourceFactories))
+	for i, f := range sourceFactories {
+		sources[i] = f.create("fixture", "")
+	}
+	return sources
+}
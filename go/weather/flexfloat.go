@@ -0,0 +1,58 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// flexFloat is a float64 field that also decodes from a numeric string, as some providers
+// quote their readings ("12") or append a unit ("60%", "12.5 °C"). Use *flexFloat where a
+// missing or null value must stay distinguishable from 0.
+type flexFloat float64
+
+// UnmarshalJSON implements json.Unmarshaler. null leaves the value unchanged like it does
+// for a plain float64.
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(b, &n); err == nil {
+		*f = flexFloat(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("%s is neither a number nor a string", b)
+	}
+	n, err := parseFlexFloat(s)
+	if err != nil {
+		return err
+	}
+	*f = flexFloat(n)
+	return nil
+}
+
+// ptr returns the value as *float64; nil if f is nil.
+func (f *flexFloat) ptr() *float64 {
+	if f == nil {
+		return nil
+	}
+	v := float64(*f)
+	return &v
+}
+
+// parseFlexFloat parses a number with optional surrounding spaces and a trailing unit.
+func parseFlexFloat(s string) (float64, error) {
+	num := strings.TrimRightFunc(strings.TrimSpace(s), func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package weather
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexFloat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{`12`, 12},
+		{`12.5`, 12.5},
+		{`"12"`, 12},
+		{`"60%"`, 60},
+		{`" -3.5 °C "`, -3.5},
+		{`"1e2"`, 100},
+	}
+	for _, tt := range tests {
+		var f flexFloat
+		if err := json.Unmarshal([]byte(tt.in), &f); err != nil || float64(f) != tt.want {
+			t.Errorf("%s: got %v, %v; want %v", tt.in, float64(f), err, tt.want)
+		}
+	}
+	for _, in := range []string{`""`, `"n/a"`, `"%"`, `"NaN"`, `true`, `{}`} {
+		var f flexFloat
+		if err := json.Unmarshal([]byte(in), &f); err == nil {
+			t.Errorf("%s: accepted as %v", in, float64(f))
+		}
+	}
+
+	// null and a missing field stay nil behind a pointer
+	var v struct {
+		A *flexFloat `json:"a"`
+		B *flexFloat `json:"b"`
+		C *flexFloat `json:"c"`
+	}
+	if err := json.Unmarshal([]byte(`{"a":null,"c":"0"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A.ptr() != nil || v.B.ptr() != nil || v.C.ptr() == nil || *v.C.ptr() != 0 {
+		t.Errorf("a, b, c = %v, %v, %v; want nil, nil, 0", v.A.ptr(), v.B.ptr(), v.C.ptr())
+	}
+}
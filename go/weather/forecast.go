@@ -0,0 +1,136 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxForecastHours and MaxForecastDays bound ForecastSpec to what all forecast sources provide.
+const (
+	MaxForecastHours = 48
+	MaxForecastDays  = 7
+)
+
+// ForecastSpec selects an optional forecast. The zero value fetches current conditions only.
+type ForecastSpec struct {
+	Hours int // hourly points for the next Hours hours
+	Days  int // daily points for the next Days days; ignored if Hours is set
+}
+
+// enabled reports whether a forecast was requested.
+func (f ForecastSpec) enabled() bool { return f.Hours > 0 || f.Days > 0 }
+
+// ForecastPoint is one forecast step of a source.
+type ForecastPoint struct {
+	Time        time.Time // start of the hour or day, in the location's time zone where known
+	Temperature float64   // hourly temperature, or the daily maximum
+	Low         *float64  // daily minimum; nil for hourly points
+	Condition   string    // normalized like the aggregated consensus
+}
+
+// ErrForecastUnsupported is set as WeatherData.ForecastError by sources without forecast data.
+var ErrForecastUnsupported = errors.New("forecast not supported by this source")
+
+// errNoForecast is reported when a forecast source returned no points.
+var errNoForecast = errors.New("no forecast data in response")
+
+// forecastFrom returns the forecast requested for this run.
+func forecastFrom(ctx context.Context) ForecastSpec {
+	return configFrom(ctx).forecast
+}
+
+// limitForecast trims points to the requested number of steps.
+// An empty result is reported as errNoForecast.
+func limitForecast(points []ForecastPoint, spec ForecastSpec) ([]ForecastPoint, error) {
+	n := spec.Days
+	if spec.Hours > 0 {
+		n = spec.Hours
+	}
+	if len(points) > n {
+		points = points[:n]
+	}
+	if len(points) == 0 {
+		return nil, errNoForecast
+	}
+	return points, nil
+}
+
+// Trend arrows stored in WeatherData.Trend (see Options.Trend).
+const (
+	TrendRising  = "↑"
+	TrendFalling = "↓"
+	TrendSteady  = "→"
+)
+
+const (
+	// trendHorizon is how far ahead of the current reading the trend looks
+	trendHorizon = 3 * time.Hour
+	// trendForecastHours is the hourly forecast length needed to cover trendHorizon
+	trendForecastHours = 5
+	// trendSteadyBand is the temperature change (°C) still reported as steady
+	trendSteadyBand = 0.5
+)
+
+// temperatureTrend compares the current temperature with the hourly point closest to
+// trendHorizon after now. Returns "" without hourly data.
+func temperatureTrend(current float64, now time.Time, hourly []ForecastPoint) string {
+	target := now.Add(trendHorizon)
+	var best *ForecastPoint
+	for i := range hourly {
+		if best == nil || absDuration(hourly[i].Time.Sub(target)) < absDuration(best.Time.Sub(target)) {
+			best = &hourly[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	switch diff := best.Temperature - current; {
+	case diff > trendSteadyBand:
+		return TrendRising
+	case diff < -trendSteadyBand:
+		return TrendFalling
+	default:
+		return TrendSteady
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// openMeteoForecast converts Open-Meteo's column-oriented hourly/daily arrays into points.
+// Times are local wall-clock strings ("2006-01-02T15:04" or "2006-01-02") at utcOffset seconds.
+func openMeteoForecast(times []string, temps, lows []float64, codes []int, utcOffset int) ([]ForecastPoint, error) {
+	if len(temps) != len(times) || len(codes) != len(times) || (lows != nil && len(lows) != len(times)) {
+		return nil, fmt.Errorf("forecast arrays have different lengths")
+	}
+	zone := time.FixedZone("", utcOffset)
+	points := make([]ForecastPoint, 0, len(times))
+	for i, ts := range times {
+		t, err := parseOpenMeteoTime(ts, zone)
+		if err != nil {
+			return nil, fmt.Errorf("forecast time: %w", err)
+		}
+		p := ForecastPoint{Time: t, Temperature: temps[i], Condition: mapWMOCode(codes[i])}
+		if lows != nil {
+			low := lows[i]
+			p.Low = &low
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// parseOpenMeteoTime parses Open-Meteo's local "2006-01-02T15:04" or "2006-01-02" timestamps.
+func parseOpenMeteoTime(ts string, zone *time.Location) (time.Time, error) {
+	layout := "2006-01-02T15:04"
+	if len(ts) == len("2006-01-02") {
+		layout = "2006-01-02"
+	}
+	return time.ParseInLocation(layout, ts, zone)
+}
@@ -0,0 +1,246 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rewriteTransport sends every request to target, so sources with fixed API URLs can be tested.
+type rewriteTransport struct{ target *url.URL }
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// fetchRecorded runs src through an Aggregator whose requests are all answered with body.
+// The query of the last request is returned for assertions.
+func fetchRecorded(t *testing.T, src WeatherSource, spec ForecastSpec, body string) (WeatherData, url.Values) {
+	t.Helper()
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	agg := NewAggregator([]WeatherSource{src}, Options{Location: &[2]float64{52.52, 13.41}, Forecast: spec})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	data, err := agg.Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0].Error != nil {
+		t.Fatalf("unexpected error: %v", data[0].Error)
+	}
+	return data[0], query
+}
+
+func TestTemperatureTrend(t *testing.T) {
+	now := time.Date(2026, 10, 14, 9, 15, 0, 0, time.UTC)
+	hourly := func(temps ...float64) []ForecastPoint {
+		points := make([]ForecastPoint, len(temps))
+		for i, temp := range temps {
+			points[i] = ForecastPoint{Time: time.Date(2026, 10, 14, 9+i, 0, 0, 0, time.UTC), Temperature: temp}
+		}
+		return points
+	}
+	tests := []struct {
+		name   string
+		hourly []ForecastPoint
+		want   string
+	}{
+		// 12:00 is closest to 09:15+3h, so the last value is ignored
+		{"rising", hourly(10, 11, 12, 13, 5), TrendRising},
+		{"falling", hourly(10, 9, 8, 7, 20), TrendFalling},
+		{"steady within band", hourly(10, 10, 10, 10.4, 10), TrendSteady},
+		{"short forecast uses last point", hourly(10, 12), TrendRising},
+		{"no data", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := temperatureTrend(10, now, tt.hourly); got != tt.want {
+			t.Errorf("%s: trend = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// checkForecast compares time, temperature, low and condition of each point.
+func checkForecast(t *testing.T, got []ForecastPoint, want []ForecastPoint) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d points, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		lowOK := (g.Low == nil) == (w.Low == nil) && (g.Low == nil || *g.Low == *w.Low)
+		if !g.Time.Equal(w.Time) || g.Temperature != w.Temperature || !lowOK || g.Condition != w.Condition {
+			t.Errorf("point %d = %v %.1f %v %q, want %v %.1f %v %q", i, g.Time, g.Temperature, g.Low, g.Condition, w.Time, w.Temperature, w.Low, w.Condition)
+		}
+	}
+}
+
+func TestOpenMeteoForecast(t *testing.T) {
+	zone := time.FixedZone("", 7200)
+	current := `"current":{"temperature_2m":14.2,"relative_humidity_2m":70,"weather_code":3},"utc_offset_seconds":7200`
+
+	t.Run("hourly", func(t *testing.T) {
+		got, q := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{Hours: 2}, `{`+current+`,
+			"hourly":{"time":["2026-10-14T13:00","2026-10-14T14:00"],"temperature_2m":[14.5,15.1],"weather_code":[3,61]}}`)
+		if q.Get("forecast_hours") != "2" || q.Get("hourly") == "" {
+			t.Errorf("query = %v, want hourly forecast for 2 hours", q)
+		}
+		if got.Temperature != 14.2 || got.ForecastError != nil {
+			t.Errorf("current = %.1f, forecast error = %v", got.Temperature, got.ForecastError)
+		}
+		checkForecast(t, got.Forecast, []ForecastPoint{
+			{Time: time.Date(2026, 10, 14, 13, 0, 0, 0, zone), Temperature: 14.5, Condition: "Partly Cloudy"},
+			{Time: time.Date(2026, 10, 14, 14, 0, 0, 0, zone), Temperature: 15.1, Condition: "Rainy"},
+		})
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		got, q := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{Days: 2}, `{`+current+`,
+			"daily":{"time":["2026-10-14","2026-10-15"],"temperature_2m_max":[16,12.5],"temperature_2m_min":[8,6.5],"weather_code":[0,71]}}`)
+		if q.Get("forecast_days") != "2" {
+			t.Errorf("query = %v, want 2 forecast days", q)
+		}
+		checkForecast(t, got.Forecast, []ForecastPoint{
+			{Time: time.Date(2026, 10, 14, 0, 0, 0, 0, zone), Temperature: 16, Low: floatPtr(8), Condition: "Clear"},
+			{Time: time.Date(2026, 10, 15, 0, 0, 0, 0, zone), Temperature: 12.5, Low: floatPtr(6.5), Condition: "Snowy"},
+		})
+	})
+
+	t.Run("mismatched arrays", func(t *testing.T) {
+		got, _ := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{Hours: 2}, `{`+current+`,
+			"hourly":{"time":["2026-10-14T13:00"],"temperature_2m":[],"weather_code":[3]}}`)
+		if got.ForecastError == nil || got.Temperature != 14.2 {
+			t.Errorf("forecast error = %v, current = %.1f; want an error but current data kept", got.ForecastError, got.Temperature)
+		}
+	})
+}
+
+func TestWeatherAPIForecast(t *testing.T) {
+	// The current reading is from 10:15 UTC, so the 09:00 hour is skipped
+	const day = 1791936000 // 2026-10-14 00:00 UTC
+	body := fmt.Sprintf(`{"location":{"tz_id":"UTC"},
+		"current":{"last_updated_epoch":%d,"temp_c":11,"humidity":80,"condition":{"text":"Overcast","code":1009}},
+		"forecast":{"forecastday":[
+			{"date_epoch":%d,"day":{"maxtemp_c":13,"mintemp_c":7,"condition":{"text":"Patchy rain nearby"}},
+			 "hour":[{"time_epoch":%d,"temp_c":10,"condition":{"text":"Mist"}},
+			         {"time_epoch":%d,"temp_c":11.5,"condition":{"text":"Overcast"}},
+			         {"time_epoch":%d,"temp_c":12,"condition":{"text":"Sunny"}}]},
+			{"date_epoch":%d,"day":{"maxtemp_c":9,"mintemp_c":2,"condition":{"text":"Light snow"}},"hour":[]}]}}`,
+		day+10*3600+900, day, day+9*3600, day+10*3600, day+11*3600, day+86400)
+	base := time.Unix(day, 0).UTC()
+
+	got, q := fetchRecorded(t, &WeatherAPISource{key: "k"}, ForecastSpec{Hours: 2}, body)
+	if q.Get("days") == "" || q.Get("q") != "52.52,13.41" {
+		t.Errorf("query = %v, want forecast days for the fixed location", q)
+	}
+	checkForecast(t, got.Forecast, []ForecastPoint{
+		{Time: base.Add(10 * time.Hour), Temperature: 11.5, Condition: "Cloudy"},
+		{Time: base.Add(11 * time.Hour), Temperature: 12, Condition: "Clear"},
+	})
+
+	got, q = fetchRecorded(t, &WeatherAPISource{key: "k"}, ForecastSpec{Days: 2}, body)
+	if q.Get("days") != "2" {
+		t.Errorf("days = %q, want 2", q.Get("days"))
+	}
+	checkForecast(t, got.Forecast, []ForecastPoint{
+		{Time: base, Temperature: 13, Low: floatPtr(7), Condition: "Rainy"},
+		{Time: base.Add(24 * time.Hour), Temperature: 9, Low: floatPtr(2), Condition: "Snowy"},
+	})
+}
+
+func TestPirateWeatherForecast(t *testing.T) {
+	zone := time.FixedZone("", -5*3600)
+	body := `{"offset":-5,"currently":{"temperature":20,"humidity":0.5,"summary":"Clear"},
+		"hourly":{"data":[{"time":1791982800,"temperature":20.5,"summary":"Clear"},{"time":1791986400,"temperature":19,"summary":"Drizzle"},{"time":1791990000,"temperature":18,"summary":"Rain"}]},
+		"daily":{"data":[{"time":1791954000,"temperatureHigh":23,"temperatureLow":12,"summary":"Partly cloudy"}]}}`
+
+	got, _ := fetchRecorded(t, &PirateWeatherSource{key: "k"}, ForecastSpec{Hours: 2}, body)
+	checkForecast(t, got.Forecast, []ForecastPoint{
+		{Time: time.Unix(1791982800, 0).In(zone), Temperature: 20.5, Condition: "Clear"},
+		{Time: time.Unix(1791986400, 0).In(zone), Temperature: 19, Condition: "Rainy"},
+	})
+
+	// Fewer days than requested is fine
+	got, _ = fetchRecorded(t, &PirateWeatherSource{key: "k"}, ForecastSpec{Days: 3}, body)
+	checkForecast(t, got.Forecast, []ForecastPoint{
+		{Time: time.Unix(1791954000, 0).In(zone), Temperature: 23, Low: floatPtr(12), Condition: "Partly Cloudy"},
+	})
+
+	got, _ = fetchRecorded(t, &PirateWeatherSource{key: "k"}, ForecastSpec{Days: 3}, `{"currently":{"temperature":20}}`)
+	if !errors.Is(got.ForecastError, errNoForecast) {
+		t.Errorf("forecast error = %v, want errNoForecast", got.ForecastError)
+	}
+}
+
+func TestForecastUnsupported(t *testing.T) {
+	sources := []WeatherSource{&mockSource{name: "Plain", temp: 10}, &mockSource{name: "Broken", hasErr: true}}
+	data, _ := NewAggregator(sources, Options{Location: &[2]float64{0, 0}, Forecast: ForecastSpec{Days: 1}}).Fetch(context.Background(), "X")
+	for _, d := range data {
+		switch d.Source {
+		case "Plain":
+			if !errors.Is(d.ForecastError, ErrForecastUnsupported) || d.Temperature != 10 {
+				t.Errorf("Plain: forecast error = %v, temp = %.1f", d.ForecastError, d.Temperature)
+			}
+		case "Broken":
+			if d.ForecastError != nil {
+				t.Errorf("Broken: forecast error = %v, want nil since the fetch itself failed", d.ForecastError)
+			}
+		}
+	}
+
+	data, _ = NewAggregator(sources[:1], Options{Location: &[2]float64{0, 0}}).Fetch(context.Background(), "X")
+	if data[0].ForecastError != nil {
+		t.Errorf("forecast error without a forecast request = %v", data[0].ForecastError)
+	}
+}
+
+func TestSunriseSunset(t *testing.T) {
+	t.Run("Open-Meteo", func(t *testing.T) {
+		got, q := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{}, `{"timezone":"America/New_York","utc_offset_seconds":-14400,
+			"current":{"temperature_2m":14.2,"relative_humidity_2m":70,"weather_code":1},
+			"daily":{"time":["2026-10-14"],"sunrise":["2026-10-14T07:12"],"sunset":["2026-10-14T18:24"]}}`)
+		if q.Get("timezone") != "auto" || q.Get("daily") != "sunrise,sunset" {
+			t.Errorf("query = %v, want daily sunrise/sunset with timezone=auto", q)
+		}
+		zone := time.FixedZone("", -4*3600)
+		if got.Sunrise == nil || !got.Sunrise.Equal(time.Date(2026, 10, 14, 7, 12, 0, 0, zone)) || got.Sunrise.Format("15:04 -07:00") != "07:12 -04:00" {
+			t.Errorf("sunrise = %v, want 07:12 at -04:00", got.Sunrise)
+		}
+		if got.Sunset == nil || got.Sunset.Format("15:04") != "18:24" {
+			t.Errorf("sunset = %v, want 18:24", got.Sunset)
+		}
+		if got.Forecast != nil || got.ForecastError != nil {
+			t.Errorf("forecast without request = %v / %v", got.Forecast, got.ForecastError)
+		}
+	})
+
+	t.Run("OpenWeatherMap", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"main":{"temp":20},"sys":{"sunrise":1791954000,"sunset":1791993600},"timezone":3600}`)
+		}))
+		defer srv.Close()
+		got := (&OpenWeatherSource{key: "k", baseURL: srv.URL}).Fetch(context.Background(), "X", nil)
+		if got.Sunrise == nil || got.Sunrise.Format("15:04") != "06:00" || got.Sunset.Format("15:04") != "17:00" {
+			t.Errorf("sunrise/sunset = %v / %v, want 06:00 / 17:00 local", got.Sunrise, got.Sunset)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		got, _ := fetchRecorded(t, &PirateWeatherSource{key: "k"}, ForecastSpec{}, `{"currently":{"temperature":20}}`)
+		if got.Sunrise != nil || got.Sunset != nil {
+			t.Errorf("sunrise/sunset = %v / %v, want nil", got.Sunrise, got.Sunset)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GenericSpec describes a JSON weather API well enough to query it without a dedicated
+// source type. Paths are dotted keys into the response; numeric parts index arrays,
+// e.g. "weather.0.description". The API counts as coordinate-based if URL uses {lat}/{lon}.
+type GenericSpec struct {
+	URL           string `json:"url"`                      // request URL with {lat}, {lon}, {city} and {key} placeholders
+	Temperature   string `json:"temperature"`              // path to the temperature in °C; required
+	Humidity      string `json:"humidity,omitempty"`       // path to the relative humidity in %
+	Condition     string `json:"condition,omitempty"`      // path to the condition text
+	ConditionCode string `json:"condition_code,omitempty"` // path to a numeric condition code
+	Codes         string `json:"codes,omitempty"`          // maps ConditionCode to a condition: "wmo" or "tomorrow"
+}
+
+// OpenMeteoGenericSpec queries Open-Meteo through GenericSource; it shows what a spec looks like.
+var OpenMeteoGenericSpec = GenericSpec{
+	URL:           "https://api.open-meteo.com/v1/forecast?latitude={lat}&longitude={lon}&current=temperature_2m,relative_humidity_2m,weather_code",
+	Temperature:   "current.temperature_2m",
+	Humidity:      "current.relative_humidity_2m",
+	ConditionCode: "current.weather_code",
+	Codes:         "wmo",
+}
+
+// needsCoordinates reports whether the URL template asks for lat/lon.
+func (s GenericSpec) needsCoordinates() bool {
+	return strings.Contains(s.URL, "{lat}") || strings.Contains(s.URL, "{lon}")
+}
+
+// needsKey reports whether the URL template asks for an API key.
+func (s GenericSpec) needsKey() bool { return strings.Contains(s.URL, "{key}") }
+
+func (s GenericSpec) validate() error {
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", s.URL)
+	}
+	if s.Temperature == "" {
+		return fmt.Errorf("temperature path is required")
+	}
+	switch s.Codes {
+	case "":
+	case "wmo", "tomorrow":
+		if s.ConditionCode == "" {
+			return fmt.Errorf("codes %q needs a condition_code path", s.Codes)
+		}
+	default:
+		return fmt.Errorf("invalid codes %q (allowed: wmo, tomorrow)", s.Codes)
+	}
+	return nil
+}
+
+// GenericSource is a WeatherSource described by a GenericSpec.
+type GenericSource struct {
+	name string
+	spec GenericSpec
+	key  string
+}
+
+// NewGenericSource validates spec and returns a source with the given name.
+// key fills the {key} placeholder and is required if the URL has one.
+func NewGenericSource(name string, spec GenericSpec, key string) (*GenericSource, error) {
+	if name == "" {
+		return nil, fmt.Errorf("generic source needs a name")
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("source %q: %w", name, err)
+	}
+	if spec.needsKey() && key == "" {
+		return nil, fmt.Errorf("source %q: url has {key} but no API key is set", name)
+	}
+	return &GenericSource{name: name, spec: spec, key: key}, nil
+}
+
+func (g *GenericSource) Name() string { return g.name }
+func (g *GenericSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	res := WeatherData{Source: g.Name()}
+	if g.key != "" {
+		ctx = withSecret(ctx, g.key)
+	}
+	lat, lon := "", ""
+	if g.spec.needsCoordinates() {
+		la, lo, err := getCoordinates(ctx, city, coordsCache)
+		if err != nil {
+			res.Error = err
+			return res
+		}
+		lat, lon = fmt.Sprintf("%.4f", la), fmt.Sprintf("%.4f", lo)
+	}
+	requestURL := strings.NewReplacer(
+		"{lat}", lat, "{lon}", lon,
+		"{city}", url.QueryEscape(locationQuery(ctx, city)),
+		"{key}", url.QueryEscape(g.key),
+	).Replace(g.spec.URL)
+	resp, err := doGet(ctx, requestURL)
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+
+	temp, ok := jsonNumber(doc, g.spec.Temperature)
+	if !ok {
+		res.Error = fmt.Errorf("no temperature at %q", g.spec.Temperature)
+		return res
+	}
+	res.Temperature = temp
+	if g.spec.Humidity != "" {
+		if hum, ok := jsonNumber(doc, g.spec.Humidity); ok {
+			res.Humidity = &hum
+		}
+	}
+	if g.spec.Condition != "" {
+		if text, ok := jsonPath(doc, g.spec.Condition); ok {
+			res.Condition, _ = text.(string)
+			res.RawCondition = res.Condition
+		}
+	}
+	if g.spec.ConditionCode != "" {
+		if n, ok := jsonNumber(doc, g.spec.ConditionCode); ok {
+			code := int(n)
+			res.RawCode = &code
+			switch g.spec.Codes {
+			case "wmo":
+				res.Condition = mapWMOCode(code)
+			case "tomorrow":
+				res.Condition = mapTomorrowCode(code)
+			}
+		}
+	}
+	return res
+}
+
+// jsonPath follows a dotted path through a decoded JSON document.
+// Object keys are matched exactly; numeric parts index arrays.
+func jsonPath(doc any, path string) (any, bool) {
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// jsonNumber returns the number at path; numeric strings like "12.5" are accepted too.
+func jsonNumber(doc any, path string) (float64, bool) {
+	v, ok := jsonPath(doc, path)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := parseFlexFloat(n)
+		return f, err == nil
+	}
+	return 0, false
+}
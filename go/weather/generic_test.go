@@ -0,0 +1,106 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"main":{"temp":15.1,"text":"12.5"},"weather":[{"description":"clouds"}],"flag":true}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want any
+		ok   bool
+	}{
+		{"main.temp", 15.1, true},
+		{"weather.0.description", "clouds", true},
+		{"flag", true, true},
+		{"main.missing", nil, false},
+		{"weather.1.description", nil, false},
+		{"weather.x", nil, false},
+		{"main.temp.deeper", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonPath(doc, tt.path)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("jsonPath(%q) = %v, %v; want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+	if n, ok := jsonNumber(doc, "main.text"); !ok || n != 12.5 {
+		t.Errorf("jsonNumber(numeric string) = %v, %v; want 12.5", n, ok)
+	}
+	if _, ok := jsonNumber(doc, "weather.0.description"); ok {
+		t.Error("jsonNumber accepted a non-numeric string")
+	}
+}
+
+func TestGenericOpenMeteo(t *testing.T) {
+	body := `{"current":{"temperature_2m":14.2,"relative_humidity_2m":71,"weather_code":61}}`
+	src, err := NewGenericSource("Open-Meteo (generic)", OpenMeteoGenericSpec, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, q := fetchRecorded(t, src, ForecastSpec{}, body)
+	want, _ := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{}, body)
+	if q.Get("latitude") != "52.5200" || q.Get("longitude") != "13.4100" {
+		t.Errorf("query = %v, want the fixed coordinates", q)
+	}
+	if got.Temperature != want.Temperature || *got.Humidity != *want.Humidity || got.Condition != want.Condition || *got.RawCode != *want.RawCode {
+		t.Errorf("generic = %+v, want the same reading as OpenMeteoSource %+v", got, want)
+	}
+}
+
+func TestGenericSourceByName(t *testing.T) {
+	spec := GenericSpec{URL: "https://example.com/now?q={city}&token={key}", Temperature: "obs.0.temp", Condition: "obs.0.text"}
+	src, err := NewGenericSource("Station", spec, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, q := fetchRecorded(t, src, ForecastSpec{}, `{"obs":[{"temp":"7.5","text":"Light rain"}]}`)
+	// fetchRecorded sets a fixed location, which name-based sources get as "lat,lon"
+	if q.Get("q") != "52.52,13.41" || q.Get("token") != "secret" {
+		t.Errorf("query = %v", q)
+	}
+	if got.Temperature != 7.5 || got.Humidity != nil || got.Condition != "Light rain" {
+		t.Errorf("reading = %+v", got)
+	}
+}
+
+func TestGenericSourceHidesKey(t *testing.T) {
+	spec := GenericSpec{URL: "http://127.0.0.1:1/now?token={key}", Temperature: "t"}
+	src, err := NewGenericSource("Station", spec, "s3cr3t+key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewAggregator([]WeatherSource{src}, Options{Location: &[2]float64{1, 2}}).Fetch(context.Background(), "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := data[0].Error.Error(); strings.Contains(msg, "s3cr3t") || !strings.Contains(msg, "token="+redacted) {
+		t.Errorf("error = %q, want the key redacted", msg)
+	}
+}
+
+func TestGenericSpecValidation(t *testing.T) {
+	tests := []struct {
+		spec    GenericSpec
+		key     string
+		wantErr string
+	}{
+		{GenericSpec{URL: "ftp://x", Temperature: "t"}, "", "invalid url"},
+		{GenericSpec{URL: "https://x/{key}"}, "k", "temperature path is required"},
+		{GenericSpec{URL: "https://x/{key}", Temperature: "t"}, "", "no API key"},
+		{GenericSpec{URL: "https://x", Temperature: "t", Codes: "wmo"}, "", "needs a condition_code"},
+		{GenericSpec{URL: "https://x", Temperature: "t", ConditionCode: "c", Codes: "metar"}, "", "invalid codes"},
+	}
+	for _, tt := range tests {
+		if _, err := NewGenericSource("X", tt.spec, tt.key); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: error = %v, want %q", tt.spec, err, tt.wantErr)
+		}
+	}
+}
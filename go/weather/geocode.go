@@ -0,0 +1,289 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// geocodeCandidates is how many matches are requested so they can be disambiguated.
+const geocodeCandidates = 10
+
+// Place is a geocoded location.
+type Place struct {
+	Name        string
+	Admin1      string // state or region, may be empty
+	CountryCode string // ISO 3166-1 alpha-2
+	Lat, Lon    float64
+	Provider    string // geocoder that resolved the place; empty for cache hits and fixed locations
+}
+
+// String formats the place as "Name, Admin1, CC (lat, lon) via Provider".
+func (p Place) String() string {
+	parts := []string{p.Name}
+	if p.Admin1 != "" {
+		parts = append(parts, p.Admin1)
+	}
+	if p.CountryCode != "" {
+		parts = append(parts, p.CountryCode)
+	}
+	s := fmt.Sprintf("%s (%.4f, %.4f)", strings.Join(parts, ", "), p.Lat, p.Lon)
+	if p.Provider != "" {
+		s += " via " + p.Provider
+	}
+	return s
+}
+
+// geocoder resolves a city name to a place, honoring the Country/Admin filter in ctx.
+type geocoder interface {
+	Name() string
+	Geocode(ctx context.Context, city string) (Place, error)
+}
+
+// geocoders are tried in order until one finds the city; tests replace them with local servers.
+var geocoders = []geocoder{
+	&openMeteoGeocoder{baseURL: "https://geocoding-api.open-meteo.com/v1/search"},
+	&nominatimGeocoder{baseURL: "https://nominatim.openstreetmap.org/search", interval: time.Second},
+}
+
+// geocodeOnce memoizes the places (and failures) resolved during one run, keyed by
+// placeKey, so concurrent and sequential fetches geocode each city at most once.
+// Concurrent callers for the same key wait for the first lookup instead of starting their own.
+type geocodeOnce struct {
+	mu      sync.Mutex
+	entries map[string]*geocodeEntry
+}
+
+type geocodeEntry struct {
+	once  sync.Once
+	place Place
+	err   error
+}
+
+// do returns the memoized result for key, calling resolve on first use.
+func (g *geocodeOnce) do(key string, resolve func() (Place, error)) (Place, error) {
+	g.mu.Lock()
+	if g.entries == nil {
+		g.entries = make(map[string]*geocodeEntry)
+	}
+	e, ok := g.entries[key]
+	if !ok {
+		e = &geocodeEntry{}
+		g.entries[key] = e
+	}
+	g.mu.Unlock()
+	e.once.Do(func() { e.place, e.err = resolve() })
+	return e.place, e.err
+}
+
+// geocodeCity resolves a city name to coordinates.
+func geocodeCity(ctx context.Context, city string) (float64, float64, error) {
+	p, err := geocodePlace(ctx, city)
+	return p.Lat, p.Lon, err
+}
+
+// geocodePlace asks each geocoder in turn and returns the first match.
+// A geocoder that errors or finds nothing falls through to the next one.
+func geocodePlace(ctx context.Context, city string) (Place, error) {
+	log := configFrom(ctx).logger
+	var errs []error
+	for _, g := range geocoders {
+		p, err := g.Geocode(ctx, city)
+		if err == nil && !plausibleCoords(p.Lat, p.Lon) {
+			err = fmt.Errorf("%w (implausible coordinates %g, %g)", notFound(configFrom(ctx), city), p.Lat, p.Lon)
+		}
+		if err == nil {
+			p.Provider = g.Name()
+			log.Debug("geocoded", "city", city, "place", p.String())
+			return p, nil
+		}
+		log.Info("geocoder failed", "geocoder", g.Name(), "city", city, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", g.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return Place{}, errors.Join(errs...)
+}
+
+// plausibleCoords rejects what geocoders return for garbage queries instead of an empty
+// result: NaN, out-of-range values and exactly 0,0 ("Null Island" in the Gulf of Guinea).
+// Weather for 0,0 itself is still available with a fixed Options.Location.
+func plausibleCoords(lat, lon float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(lon) || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return false
+	}
+	return lat != 0 || lon != 0
+}
+
+// matchesFilter reports whether a candidate passes the Country/Admin filter.
+func matchesFilter(cfg requestConfig, countryCode, admin1 string) bool {
+	if cfg.country != "" && !strings.EqualFold(countryCode, cfg.country) {
+		return false
+	}
+	return cfg.admin == "" || strings.EqualFold(admin1, cfg.admin)
+}
+
+// ErrCityNotFound is matched (with errors.Is) by geocoding errors for a city without results.
+var ErrCityNotFound = errors.New("city not found")
+
+// notFoundError carries the user-facing message of a failed lookup and matches ErrCityNotFound.
+type notFoundError struct{ msg string }
+
+func (e *notFoundError) Error() string        { return e.msg }
+func (e *notFoundError) Is(target error) bool { return target == ErrCityNotFound }
+
+// notFound is the error for a city without (matching) results.
+func notFound(cfg requestConfig, city string) error {
+	switch {
+	case cfg.admin != "" && cfg.country != "":
+		return &notFoundError{fmt.Sprintf("city %q not found in %s, %s", city, cfg.admin, strings.ToUpper(cfg.country))}
+	case cfg.admin != "":
+		return &notFoundError{fmt.Sprintf("city %q not found in %s", city, cfg.admin)}
+	case cfg.country != "":
+		return &notFoundError{fmt.Sprintf("city %q not found in %s", city, strings.ToUpper(cfg.country))}
+	default:
+		return &notFoundError{fmt.Sprintf("city %q not found", city)}
+	}
+}
+
+// allNotFound reports whether err (possibly joined from several geocoders) says "not found"
+// throughout. A single network failure means another attempt might still succeed.
+func allNotFound(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, e := range errs {
+			if !errors.Is(e, ErrCityNotFound) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	return errors.Is(err, ErrCityNotFound)
+}
+
+// openMeteoGeocoder uses the Open-Meteo geocoding API.
+// Of the matching candidates the most populous one wins, so "Springfield" is deterministic.
+type openMeteoGeocoder struct{ baseURL string }
+
+func (g *openMeteoGeocoder) Name() string { return "Open-Meteo" }
+func (g *openMeteoGeocoder) Geocode(ctx context.Context, city string) (Place, error) {
+	cfg := configFrom(ctx)
+	geoURL := fmt.Sprintf("%s?name=%s&count=%d", g.baseURL, url.QueryEscape(city), geocodeCandidates)
+	if cfg.country != "" {
+		geoURL += "&countryCode=" + url.QueryEscape(strings.ToUpper(cfg.country))
+	}
+	resp, err := doGet(ctx, geoURL)
+	if err != nil {
+		return Place{}, fmt.Errorf("geocoding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var geo struct {
+		Results []struct {
+			Name        string  `json:"name"`
+			Lat         float64 `json:"latitude"`
+			Lon         float64 `json:"longitude"`
+			CountryCode string  `json:"country_code"`
+			Admin1      string  `json:"admin1"`
+			Population  int     `json:"population"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&geo); err != nil {
+		return Place{}, fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+
+	best := -1
+	for i, r := range geo.Results {
+		if !matchesFilter(cfg, r.CountryCode, r.Admin1) {
+			continue
+		}
+		if best < 0 || r.Population > geo.Results[best].Population {
+			best = i
+		}
+	}
+	if best < 0 {
+		return Place{}, notFound(cfg, city)
+	}
+	r := geo.Results[best]
+	return Place{Name: r.Name, Admin1: r.Admin1, CountryCode: r.CountryCode, Lat: r.Lat, Lon: r.Lon}, nil
+}
+
+// nominatimGeocoder uses OpenStreetMap's Nominatim as fallback.
+// Its usage policy allows at most one request per second, enforced by interval.
+// Results come ranked by importance, so the first matching candidate wins.
+type nominatimGeocoder struct {
+	baseURL  string
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (g *nominatimGeocoder) Name() string { return "Nominatim" }
+func (g *nominatimGeocoder) Geocode(ctx context.Context, city string) (Place, error) {
+	if err := g.wait(ctx); err != nil {
+		return Place{}, err
+	}
+	cfg := configFrom(ctx)
+	geoURL := fmt.Sprintf("%s?q=%s&format=jsonv2&addressdetails=1&limit=%d", g.baseURL, url.QueryEscape(city), geocodeCandidates)
+	if cfg.country != "" {
+		geoURL += "&countrycodes=" + url.QueryEscape(strings.ToLower(cfg.country))
+	}
+	resp, err := doGet(ctx, geoURL)
+	if err != nil {
+		return Place{}, fmt.Errorf("geocoding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var results []struct {
+		Name    string `json:"name"`
+		Lat     string `json:"lat"`
+		Lon     string `json:"lon"`
+		Address struct {
+			State       string `json:"state"`
+			CountryCode string `json:"country_code"`
+		} `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return Place{}, fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+	for _, r := range results {
+		if !matchesFilter(cfg, r.Address.CountryCode, r.Address.State) {
+			continue
+		}
+		lat, errLat := strconv.ParseFloat(r.Lat, 64)
+		lon, errLon := strconv.ParseFloat(r.Lon, 64)
+		if errLat != nil || errLon != nil {
+			continue
+		}
+		return Place{
+			Name:        r.Name,
+			Admin1:      r.Address.State,
+			CountryCode: strings.ToUpper(r.Address.CountryCode),
+			Lat:         lat,
+			Lon:         lon,
+		}, nil
+	}
+	return Place{}, notFound(cfg, city)
+}
+
+// wait blocks until the next request is allowed by the rate limit.
+func (g *nominatimGeocoder) wait(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if d := time.Until(g.last.Add(g.interval)); d > 0 {
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+	g.last = time.Now()
+	return nil
+}
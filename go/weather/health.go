@@ -0,0 +1,66 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Health is the state of a source as seen by a health check, see ClassifyHealth.
+type Health int
+
+const (
+	HealthUp          Health = iota // answered with a reading
+	HealthAuth                      // rejected the API key (HTTP 401 or 403)
+	HealthNotFound                  // doesn't know the location (HTTP 404 or no geocoding result)
+	HealthRateLimited               // too many requests (HTTP 429)
+	HealthDown                      // network error, timeout, server error or unusable response
+)
+
+var healthMessages = [...]string{"up", "invalid API key", "location not found", "rate limited", "unavailable"}
+
+// String returns a message for the state, e.g. "invalid API key".
+func (h Health) String() string {
+	if h < 0 || int(h) >= len(healthMessages) {
+		return "unknown"
+	}
+	return healthMessages[h]
+}
+
+// ClassifyHealth maps the Error of a WeatherData to a Health; nil is HealthUp.
+func ClassifyHealth(err error) Health {
+	switch {
+	case err == nil:
+		return HealthUp
+	case errors.Is(err, ErrAuth):
+		return HealthAuth
+	case errors.Is(err, ErrCityNotFound) || hasStatus(err, http.StatusNotFound):
+		return HealthNotFound
+	case errors.Is(err, ErrRateLimited):
+		return HealthRateLimited
+	}
+	return HealthDown
+}
+
+// CheckResult is the outcome of probing one source, see Aggregator.Check.
+type CheckResult struct {
+	Source  string
+	Health  Health
+	Latency time.Duration
+	Error   error // the underlying error; nil if the source is up
+}
+
+// Check probes every source with one Fetch for city and classifies the outcome of each,
+// without aggregating. Useful to verify API keys after setup.
+func (a *Aggregator) Check(ctx context.Context, city string) ([]CheckResult, error) {
+	data, err := a.Fetch(ctx, city)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CheckResult, len(data))
+	for i, d := range data {
+		results[i] = CheckResult{Source: d.Source, Health: ClassifyHealth(d.Error), Latency: d.Duration, Error: d.Error}
+	}
+	return results, nil
+}
@@ -0,0 +1,64 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			http.Error(w, `{"cod":401,"message":"Invalid API key"}`, status)
+			return
+		}
+		fmt.Fprint(w, `{"main":{"temp":9,"humidity":70},"weather":[{"id":800,"description":"clear sky"}]}`)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		status int
+		want   Health
+	}{
+		{http.StatusOK, HealthUp},
+		{http.StatusUnauthorized, HealthAuth},
+		{http.StatusForbidden, HealthAuth},
+		{http.StatusNotFound, HealthNotFound},
+		{http.StatusTooManyRequests, HealthRateLimited},
+		{http.StatusInternalServerError, HealthDown},
+		{http.StatusServiceUnavailable, HealthDown},
+	}
+	agg := NewAggregator([]WeatherSource{&OpenWeatherSource{key: "k"}}, Options{Location: &[2]float64{52.52, 13.41}})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	for _, tt := range tests {
+		status = tt.status
+		results, err := agg.Check(context.Background(), "Berlin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Source != "OpenWeatherMap" || results[0].Health != tt.want {
+			t.Errorf("HTTP %d: results = %+v, want %s", tt.status, results, tt.want)
+		}
+		if r := results[0]; (r.Health == HealthUp) != (r.Error == nil) || r.Latency <= 0 {
+			t.Errorf("HTTP %d: error %v, latency %v; want an error unless up and a latency", tt.status, r.Error, r.Latency)
+		}
+	}
+
+	// unreachable hosts and unknown cities
+	srv.Close()
+	results, _ := agg.Check(context.Background(), "Berlin")
+	if results[0].Health != HealthDown {
+		t.Errorf("closed server: %s, want %s", results[0].Health, HealthDown)
+	}
+	if h := ClassifyHealth(fmt.Errorf("geocoding: %w", ErrCityNotFound)); h != HealthNotFound {
+		t.Errorf("city not found: %s, want %s", h, HealthNotFound)
+	}
+	if HealthAuth.String() != "invalid API key" || Health(99).String() != "unknown" {
+		t.Errorf("messages = %q, %q", HealthAuth, Health(99))
+	}
+}
@@ -0,0 +1,47 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ipLocateURL is ip-api.com's endpoint for the caller's own address; tests point it at a
+// local server. The free tier is HTTP only and allows 45 requests per minute.
+var ipLocateURL = "http://ip-api.com/json/?fields=status,message,city,regionName,countryCode,lat,lon"
+
+// LocateIP guesses the caller's place from their public IP address, for "weather here"
+// without a city name. The result is only as precise as the provider's database, usually
+// the nearest larger city, and a VPN or proxy moves it to the exit node.
+func (a *Aggregator) LocateIP(ctx context.Context) (Place, error) {
+	ctx = a.withConfig(ctx)
+	resp, err := doGet(ctx, ipLocateURL)
+	if err != nil {
+		return Place{}, fmt.Errorf("IP geolocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var loc struct {
+		Status      string  `json:"status"`
+		Message     string  `json:"message"`
+		City        string  `json:"city"`
+		Region      string  `json:"regionName"`
+		CountryCode string  `json:"countryCode"`
+		Lat         float64 `json:"lat"`
+		Lon         float64 `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loc); err != nil {
+		return Place{}, fmt.Errorf("failed to decode IP geolocation response: %w", err)
+	}
+	// private and reserved addresses come back with status "fail" and e.g. "private range"
+	if loc.Status != "success" {
+		return Place{}, fmt.Errorf("IP geolocation failed: %s", loc.Message)
+	}
+	if loc.City == "" || !plausibleCoords(loc.Lat, loc.Lon) {
+		return Place{}, errors.New("IP geolocation returned no usable location")
+	}
+	p := Place{Name: loc.City, Admin1: loc.Region, CountryCode: loc.CountryCode, Lat: loc.Lat, Lon: loc.Lon, Provider: "ip-api.com"}
+	configFrom(ctx).logger.Debug("located by IP", "place", p.String())
+	return p, nil
+}
@@ -0,0 +1,69 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// keyRing spreads a source over several API keys, given comma-separated in its key (e.g.
+// WEATHER_API_COM_KEY=key1,key2) to multiply a free tier's quota. The source sticks to one
+// key until the provider rate-limits it and then moves on to the next, for this and all later
+// requests. The zero value is ready to use; the keys are split on first use.
+type keyRing struct {
+	once sync.Once
+	keys []string
+	cur  atomic.Uint32 // index of the key in use
+}
+
+// splitKeys returns the comma-separated keys of raw without blanks; nil if there are none,
+// e.g. for "" or " , ".
+func splitKeys(raw string) []string {
+	var keys []string
+	for _, k := range strings.Split(raw, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// fetch calls fetch with the current key of raw. If the provider answers that the key's quota
+// is used up, the ring advances and fetch is retried with the next key, trying each key once.
+// While other keys are left, a 429 isn't retried with the same key (see doGet), so moving on
+// doesn't wait for the backoff. Without any key fetch gets "", which sources report as missing.
+func (r *keyRing) fetch(ctx context.Context, raw string, fetch func(ctx context.Context, key string) WeatherData) WeatherData {
+	r.once.Do(func() { r.keys = splitKeys(raw) })
+	n := uint32(len(r.keys))
+	if n == 0 {
+		return fetch(ctx, "")
+	}
+	var res WeatherData
+	for tries := uint32(0); tries < n; tries++ {
+		i := r.cur.Load() % n
+		keyCtx := ctx
+		if tries < n-1 {
+			cfg := configFrom(ctx)
+			cfg.noRateLimitRetry = true
+			keyCtx = context.WithValue(ctx, requestConfigKey{}, cfg)
+		}
+		res = fetch(keyCtx, r.keys[i])
+		if !quotaExceeded(res.Error) {
+			return res
+		}
+		// concurrent fetches that ran into the same key advance the ring only once
+		r.cur.CompareAndSwap(i, (i+1)%n)
+	}
+	if n > 1 {
+		res.Error = fmt.Errorf("all %d API keys rate limited: %w", n, res.Error)
+	}
+	return res
+}
+
+// quotaExceeded reports whether err means the key hit its rate limit or daily quota.
+func quotaExceeded(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, errAccuWeatherLimit)
+}
@@ -0,0 +1,100 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyRing(t *testing.T) {
+	withRetryDelay(t, time.Millisecond)
+	var mu sync.Mutex
+	var used []string
+	limited := map[string]bool{"A": true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		mu.Lock()
+		used = append(used, key)
+		hit := limited[key]
+		mu.Unlock()
+		if hit {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"current":{"temp_c":11,"humidity":70,"condition":{"text":"Cloudy","code":1006}}}`)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	src := &WeatherAPISource{key: "A, B,,C"}
+	agg := NewAggregator([]WeatherSource{src}, Options{Location: &[2]float64{52.52, 13.41}, Retries: DefaultRetries})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	fetch := func() WeatherData {
+		t.Helper()
+		data, err := agg.Fetch(context.Background(), "Berlin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data[0]
+	}
+	check := func(step string, want ...string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if !reflect.DeepEqual(used, want) {
+			t.Errorf("%s: keys used = %v, want %v", step, used, want)
+		}
+		used = nil
+	}
+
+	// the 429 on A moves the source on to B right away, for this and later requests
+	if d := fetch(); d.Error != nil || d.Temperature != 11 {
+		t.Fatalf("first fetch = %.1f, %v; want the reading via key B", d.Temperature, d.Error)
+	}
+	check("first fetch", "A", "B")
+	fetch()
+	check("second fetch", "B")
+
+	mu.Lock()
+	limited = map[string]bool{"A": true, "B": true, "C": true}
+	mu.Unlock()
+	d := fetch()
+	if !errors.Is(d.Error, ErrRateLimited) || !strings.Contains(d.Error.Error(), "all 3 API keys rate limited") {
+		t.Errorf("error = %v, want all keys rate limited", d.Error)
+	}
+	// only the last key left is retried
+	check("all limited", "B", "C", "A", "A", "A")
+}
+
+func TestSplitKeys(t *testing.T) {
+	tests := map[string][]string{
+		"abc":        {"abc"},
+		" a , b ,,c": {"a", "b", "c"},
+		",":          nil,
+		" , ":        nil,
+	}
+	for raw, want := range tests {
+		if got := splitKeys(raw); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitKeys(%q) = %q, want %q", raw, got, want)
+		}
+	}
+
+	// a variable without any key counts as missing, so the source isn't used
+	t.Setenv("WEATHER_API_COM_KEY", " , ")
+	for _, s := range ListSources() {
+		if s.EnvKey == "WEATHER_API_COM_KEY" && s.KeyPresent {
+			t.Error("WEATHER_API_COM_KEY=\" , \" counts as a key")
+		}
+	}
+	if d := (&WeatherAPISource{key: ","}).Fetch(context.Background(), "Berlin", nil); d.Error == nil || d.Error.Error() != "API key required" {
+		t.Errorf("source without keys: error = %v, want API key required", d.Error)
+	}
+}
@@ -0,0 +1,96 @@
+package weather
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// latencyBuckets are the upper bounds (seconds) of the source latency histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics counts source requests and their latency. Set Options.Metrics to record an
+// Aggregator's fetches; WriteTo exposes them in the Prometheus text format.
+// The zero value is not usable, create it with NewMetrics. A nil *Metrics records nothing.
+type Metrics struct {
+	mu      sync.Mutex
+	sources map[string]*sourceMetrics
+}
+
+type sourceMetrics struct {
+	ok, errors uint64
+	buckets    []uint64 // per latencyBuckets, not cumulative
+	sum        float64
+}
+
+// NewMetrics creates an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{sources: make(map[string]*sourceMetrics)}
+}
+
+// observe records one source result.
+func (m *Metrics) observe(d WeatherData) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sources[d.Source]
+	if s == nil {
+		s = &sourceMetrics{buckets: make([]uint64, len(latencyBuckets))}
+		m.sources[d.Source] = s
+	}
+	if d.Error != nil {
+		s.errors++
+	} else {
+		s.ok++
+	}
+	secs := d.Duration.Seconds()
+	s.sum += secs
+	if i := sort.SearchFloat64s(latencyBuckets, secs); i < len(latencyBuckets) {
+		s.buckets[i]++
+	}
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format, sorted by source.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.sources))
+	for name := range m.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# HELP weather_source_requests_total Source fetches by outcome.\n")
+	b.WriteString("# TYPE weather_source_requests_total counter\n")
+	for _, name := range names {
+		s, l := m.sources[name], labelValue(name)
+		fmt.Fprintf(&b, "weather_source_requests_total{source=\"%s\",outcome=\"ok\"} %d\n", l, s.ok)
+		fmt.Fprintf(&b, "weather_source_requests_total{source=\"%s\",outcome=\"error\"} %d\n", l, s.errors)
+	}
+	b.WriteString("# HELP weather_source_duration_seconds Source fetch latency.\n")
+	b.WriteString("# TYPE weather_source_duration_seconds histogram\n")
+	for _, name := range names {
+		s, l := m.sources[name], labelValue(name)
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(&b, "weather_source_duration_seconds_bucket{source=\"%s\",le=\"%g\"} %d\n", l, le, cumulative)
+		}
+		count := s.ok + s.errors
+		fmt.Fprintf(&b, "weather_source_duration_seconds_bucket{source=\"%s\",le=\"+Inf\"} %d\n", l, count)
+		fmt.Fprintf(&b, "weather_source_duration_seconds_sum{source=\"%s\"} %g\n", l, s.sum)
+		fmt.Fprintf(&b, "weather_source_duration_seconds_count{source=\"%s\"} %d\n", l, count)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// labelValue escapes a Prometheus label value.
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,53 @@
+package weather
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	sources := []WeatherSource{
+		&mockSource{name: "Good", temp: 10},
+		&mockSource{name: "Bad", hasErr: true},
+	}
+	for _, sequential := range []bool{false, true} {
+		agg := NewAggregator(sources, Options{Sequential: sequential, Location: &[2]float64{0, 0}, Metrics: m})
+		if _, err := agg.Fetch(context.Background(), "TestCity"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.observe(WeatherData{Source: "Good", Duration: 300 * time.Millisecond})
+	m.observe(WeatherData{Source: `Odd "name"`, Duration: time.Minute})
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`weather_source_requests_total{source="Good",outcome="ok"} 3`,
+		`weather_source_requests_total{source="Good",outcome="error"} 0`,
+		`weather_source_requests_total{source="Bad",outcome="error"} 2`,
+		`weather_source_duration_seconds_bucket{source="Good",le="0.25"} 2`,
+		`weather_source_duration_seconds_bucket{source="Good",le="0.5"} 3`,
+		`weather_source_duration_seconds_bucket{source="Good",le="+Inf"} 3`,
+		`weather_source_duration_seconds_count{source="Bad"} 2`,
+		`weather_source_duration_seconds_bucket{source="Odd \"name\"",le="10"} 0`,
+		`weather_source_duration_seconds_bucket{source="Odd \"name\"",le="+Inf"} 1`,
+		"# TYPE weather_source_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Index(out, `source="Bad"`) > strings.Index(out, `source="Good"`) {
+		t.Error("sources not sorted")
+	}
+
+	// A nil registry is a no-op
+	var none *Metrics
+	none.observe(WeatherData{Source: "Good"})
+}
@@ -0,0 +1,116 @@
+package weather
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out requests per host with a token bucket, shared by all runs of the
+// Aggregators using it. Only the hosts of a sharedSites entry share a bucket, so Open-Meteo's
+// geocoding, forecast and air quality APIs count against one limit. Waits get up to 10% random jitter,
+// so several processes started together don't stay in lockstep.
+type RateLimiter struct {
+	rate float64 // requests per second per host
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter allows perSecond requests per second and host, without bursts.
+// perSecond must be positive.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	return &RateLimiter{rate: perSecond, buckets: make(map[string]*tokenBucket)}
+}
+
+// Wait blocks until a request to host may be sent or ctx is done. A nil RateLimiter never waits.
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	if l == nil {
+		return nil
+	}
+	b := l.bucket(siteKey(host))
+	d := b.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	d += time.Duration(rand.Int63n(int64(d/10) + 1))
+	configFrom(ctx).logger.Debug("rate limited", "host", host, "wait", d)
+	if err := sleepContext(ctx, d); err != nil {
+		b.release()
+		return err
+	}
+	return nil
+}
+
+func (l *RateLimiter) bucket(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{rate: l.rate, burst: 1}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sharedSites are the domains whose subdomains share one rate limit bucket because
+// they belong to the same provider and quota.
+var sharedSites = []string{"open-meteo.com"}
+
+// siteKey maps a request host to its rate limit bucket: the lower-cased host itself, or the
+// sharedSites domain it belongs to ("geocoding-api.open-meteo.com" → "open-meteo.com").
+// Ports are kept, since they usually mean different servers.
+func siteKey(host string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, site := range sharedSites {
+		if strings.HasSuffix(name, "."+site) {
+			name = site
+			break
+		}
+	}
+	if port != "" {
+		return net.JoinHostPort(name, port)
+	}
+	return name
+}
+
+// tokenBucket refills rate tokens per second up to burst. reserve hands out tokens ahead of
+// time, so waiters sleep without holding the lock and are served in arrival order.
+type tokenBucket struct {
+	rate, burst float64
+
+	mu     sync.Mutex
+	tokens float64 // negative when tokens are reserved ahead
+	last   time.Time
+}
+
+// reserve takes a token and returns how long the caller has to wait until it is due.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = b.burst
+	} else {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// release returns the token of a reservation that was not used.
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		fmt.Fprint(w, "{}")
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	const n, rate = 4, 20.0 // one request per 50ms
+	interval := time.Duration(float64(time.Second) / rate)
+	agg := &Aggregator{Client: &http.Client{Transport: rewriteTransport{target}}, Options: Options{RateLimiter: NewRateLimiter(rate)}}
+	ctx := agg.withConfig(context.Background())
+	hosts := []string{"api.open-meteo.com", "geocoding-api.open-meteo.com", "air-quality-api.open-meteo.com", "api.open-meteo.com"}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			resp, err := doGet(ctx, "https://"+host+"/v1/forecast")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}(hosts[i])
+	}
+	wg.Wait()
+
+	if len(arrivals) != n {
+		t.Fatalf("server saw %d requests, want %d", len(arrivals), n)
+	}
+	// all Open-Meteo hosts share one bucket, so the i-th request is due i intervals after
+	// the first; jitter only ever delays it
+	for i := 1; i < n; i++ {
+		if d := arrivals[i].Sub(arrivals[0]); d < time.Duration(i)*interval-5*time.Millisecond {
+			t.Errorf("request %d came %v after the first, want ≥ %v", i+1, d, time.Duration(i)*interval)
+		}
+	}
+	if total := arrivals[n-1].Sub(arrivals[0]); total > time.Duration(n)*interval*2 {
+		t.Errorf("%d requests took %v, want ≈%v", n, total, time.Duration(n-1)*interval)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(1)
+	if err := l.Wait(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Wait(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want the context's error", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("canceled Wait returned after %v, want right at the deadline", d)
+	}
+	// other hosts aren't affected, and the canceled reservation was given back
+	if err := l.Wait(context.Background(), "other.example.org:8080"); err != nil {
+		t.Error(err)
+	}
+	if b := l.bucket("example.com"); b.tokens < -0.5 {
+		t.Errorf("tokens = %v, want the canceled reservation returned", b.tokens)
+	}
+	var none *RateLimiter
+	if err := none.Wait(ctx, "example.com"); err != nil {
+		t.Errorf("nil limiter: %v", err)
+	}
+}
+
+func TestSiteKey(t *testing.T) {
+	for host, want := range map[string]string{
+		"api.open-meteo.com":             "open-meteo.com",
+		"geocoding-api.open-meteo.com":   "open-meteo.com",
+		"open-meteo.com":                 "open-meteo.com",
+		"API.Tomorrow.io.":               "api.tomorrow.io",
+		"a.co.uk":                        "a.co.uk",
+		"b.co.uk":                        "b.co.uk",
+		"someone.github.io":              "someone.github.io",
+		"notopen-meteo.com":              "notopen-meteo.com",
+		"localhost":                      "localhost",
+		"127.0.0.1:8080":                 "127.0.0.1:8080",
+		"[::1]:443":                      "[::1]:443",
+		"weather.example.com:8443":       "weather.example.com:8443",
+		"air-quality-api.open-meteo.com": "open-meteo.com",
+	} {
+		if got := siteKey(host); got != want {
+			t.Errorf("siteKey(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
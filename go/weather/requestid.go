@@ -0,0 +1,32 @@
+package weather
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDHeader carries the correlation ID of a run on every outbound request.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID stamps ctx with a correlation ID. Fetch, Stream and Locate calls with this
+// context add it to their log lines as request_id and send it as RequestIDHeader, so one
+// aggregation can be followed across its goroutines and, where providers log it, their side.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the correlation ID of ctx; empty if none was set.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 16-character hex ID.
+func NewRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:]) // crypto/rand doesn't fail on supported platforms
+	return hex.EncodeToString(b[:])
+}
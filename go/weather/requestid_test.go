@@ -0,0 +1,75 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var mu sync.Mutex
+	ids := map[string][]string{} // path → X-Request-ID of each request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids[r.URL.Path] = append(ids[r.URL.Path], r.Header.Get(RequestIDHeader))
+		mu.Unlock()
+		if r.URL.Path == "/v1/search" {
+			fmt.Fprint(w, `{"results":[{"name":"Berlin","latitude":52.52,"longitude":13.41,"country_code":"DE"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"current":{"temperature_2m":9.5,"weather_code":0},"weather":[{"id":800}],"main":{"temp":9}}`)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	withGeocoders(t, &openMeteoGeocoder{baseURL: "https://geocoding-api.open-meteo.com/v1/search"})
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	agg := NewAggregator([]WeatherSource{&OpenMeteoSource{}, &OpenWeatherSource{key: "k"}}, Options{Logger: logger})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	id := NewRequestID()
+	if _, err := agg.Fetch(WithRequestID(context.Background(), id), "Berlin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 3 {
+		t.Errorf("requests = %v, want geocoding and both sources", ids)
+	}
+	for path, got := range ids {
+		for _, g := range got {
+			if g != id {
+				t.Errorf("%s: %s = %q, want %q", path, RequestIDHeader, g, id)
+			}
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id="+id) {
+			t.Errorf("log line without the request ID: %s", line)
+		}
+	}
+	if len(lines) < 3 {
+		t.Errorf("only %d log lines:\n%s", len(lines), logs.String())
+	}
+
+	// without an ID nothing is sent
+	ids = map[string][]string{}
+	if _, err := agg.Fetch(context.Background(), "Berlin"); err != nil {
+		t.Fatal(err)
+	}
+	for path, got := range ids {
+		if got[0] != "" {
+			t.Errorf("%s: unexpected %s %q", path, RequestIDHeader, got[0])
+		}
+	}
+	if a, b := NewRequestID(), NewRequestID(); len(a) != 16 || a == b {
+		t.Errorf("NewRequestID = %q, %q; want distinct 16-character IDs", a, b)
+	}
+}
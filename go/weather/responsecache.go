@@ -0,0 +1,82 @@
+package weather
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ResponseCache stores recent successful WeatherData per source and city.
+// Implementations decide about expiry; an in-memory one ships, others (e.g. Redis) can be added.
+type ResponseCache interface {
+	Get(source, city string) (WeatherData, bool)
+	Set(source, city string, data WeatherData)
+}
+
+type responseKey struct{ source, city string }
+
+type responseEntry struct {
+	data    WeatherData
+	expires time.Time
+}
+
+// MemoryCache is a ResponseCache held in process memory with a fixed TTL.
+type MemoryCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time // overridable in tests
+	entries map[responseKey]responseEntry
+}
+
+// NewMemoryCache creates an in-memory response cache whose entries expire after ttl.
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{ttl: ttl, now: time.Now, entries: make(map[responseKey]responseEntry)}
+}
+
+func (m *MemoryCache) Get(source, city string) (WeatherData, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := responseKey{source, coordCacheKey(city)}
+	e, ok := m.entries[key]
+	if !ok {
+		return WeatherData{}, false
+	}
+	if m.now().After(e.expires) {
+		delete(m.entries, key)
+		return WeatherData{}, false
+	}
+	return e.data, true
+}
+
+func (m *MemoryCache) Set(source, city string, data WeatherData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[responseKey{source, coordCacheKey(city)}] = responseEntry{data: data, expires: m.now().Add(m.ttl)}
+}
+
+// cachedSource wraps a WeatherSource and answers from cache when possible.
+// Only successful results are cached so a failing source is retried on the next fetch.
+type cachedSource struct {
+	WeatherSource
+	cache ResponseCache
+}
+
+func (c *cachedSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	if data, ok := c.cache.Get(c.Name(), city); ok {
+		return data
+	}
+	data := c.WeatherSource.Fetch(ctx, city, coordsCache)
+	if data.Error == nil {
+		c.cache.Set(c.Name(), city, data)
+	}
+	return data
+}
+
+// WithResponseCache wraps every source so it consults cache before fetching.
+func WithResponseCache(sources []WeatherSource, cache ResponseCache) []WeatherSource {
+	wrapped := make([]WeatherSource, len(sources))
+	for i, s := range sources {
+		wrapped[i] = &cachedSource{WeatherSource: s, cache: cache}
+	}
+	return wrapped
+}
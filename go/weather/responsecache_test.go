@@ -0,0 +1,68 @@
+package weather
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingSource counts Fetch calls and optionally fails.
+type countingSource struct {
+	mockSource
+	calls int
+}
+
+func (c *countingSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	c.calls++
+	return c.mockSource.Fetch(ctx, city, coordsCache)
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC)
+	cache := NewMemoryCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	src := &countingSource{mockSource: mockSource{name: "S1", temp: 12, hum: 50, cond: "Clear"}}
+	cached := WithResponseCache([]WeatherSource{src}, cache)[0]
+	ctx := context.Background()
+
+	if got := cached.Name(); got != "S1" {
+		t.Errorf("Name() = %q, want S1", got)
+	}
+
+	t.Run("miss then hit", func(t *testing.T) {
+		first := cached.Fetch(ctx, "Berlin", nil)
+		second := cached.Fetch(ctx, "berlin", nil)
+		if src.calls != 1 {
+			t.Errorf("calls = %d, want 1", src.calls)
+		}
+		if second.Temperature != first.Temperature || second.Source != "S1" {
+			t.Errorf("cached result = %+v, want %+v", second, first)
+		}
+	})
+
+	t.Run("other city misses", func(t *testing.T) {
+		cached.Fetch(ctx, "Paris", nil)
+		if src.calls != 2 {
+			t.Errorf("calls = %d, want 2", src.calls)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		cached.Fetch(ctx, "Berlin", nil)
+		if src.calls != 3 {
+			t.Errorf("calls = %d, want 3", src.calls)
+		}
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		failing := &countingSource{mockSource: mockSource{name: "S2", hasErr: true}}
+		s := WithResponseCache([]WeatherSource{failing}, cache)[0]
+		s.Fetch(ctx, "Berlin", nil)
+		s.Fetch(ctx, "Berlin", nil)
+		if failing.calls != 2 {
+			t.Errorf("calls = %d, want 2", failing.calls)
+		}
+	})
+}
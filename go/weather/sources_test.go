@@ -0,0 +1,410 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSourceParsing feeds recorded responses of each source through its Fetch,
+// so changes in the expected JSON shape show up without network access.
+func TestSourceParsing(t *testing.T) {
+	type want struct {
+		temp                   float64
+		feels, hum, wind, pres *float64
+		cond                   string
+		rawCode                *int
+	}
+	code := func(c int) *int { return &c }
+	tests := []struct {
+		name string
+		src  WeatherSource
+		body string
+		want want
+	}{
+		{
+			name: "Open-Meteo",
+			src:  &OpenMeteoSource{},
+			body: `{"current":{"temperature_2m":14.2,"apparent_temperature":12.9,"relative_humidity_2m":71,"weather_code":61,"wind_speed_10m":3.4,"pressure_msl":1012.5}}`,
+			want: want{temp: 14.2, feels: floatPtr(12.9), hum: floatPtr(71), wind: floatPtr(3.4), pres: floatPtr(1012.5), cond: "Rainy", rawCode: code(61)},
+		},
+		{
+			name: "Tomorrow.io",
+			src:  &TomorrowIOSource{apiKey: "k"},
+			body: `{"data":{"values":{"temperature":9.6,"humidity":83,"weatherCode":1001,"windSpeed":5.1,"pressureSeaLevel":1004}}}`,
+			want: want{temp: 9.6, hum: floatPtr(83), wind: floatPtr(5.1), pres: floatPtr(1004), cond: "Cloudy", rawCode: code(1001)},
+		},
+		{
+			name: "WeatherAPI.com",
+			src:  &WeatherAPISource{key: "k"},
+			body: `{"current":{"temp_c":11.0,"feelslike_c":9.4,"humidity":76,"wind_kph":18,"pressure_mb":1015,"condition":{"text":"Light rain","code":1183}}}`,
+			want: want{temp: 11, feels: floatPtr(9.4), hum: floatPtr(76), wind: floatPtr(5), pres: floatPtr(1015), cond: "Light rain", rawCode: code(1183)},
+		},
+		{
+			name: "Meteosource without humidity",
+			src:  &MeteosourceSource{key: "k"},
+			body: `{"current":{"temperature":12.5,"summary":"Overcast","wind":{"speed":2.2}}}`,
+			want: want{temp: 12.5, wind: floatPtr(2.2), cond: "Overcast"},
+		},
+		{
+			name: "Meteosource with humidity",
+			src:  &MeteosourceSource{key: "k"},
+			body: `{"current":{"temperature":12.5,"humidity":64,"summary":"Sunny"}}`,
+			want: want{temp: 12.5, hum: floatPtr(64), cond: "Sunny"},
+		},
+		{
+			name: "Meteosource with quoted values",
+			src:  &MeteosourceSource{key: "k"},
+			body: `{"current":{"temperature":"12.5","humidity":"64%","summary":"Sunny"}}`,
+			want: want{temp: 12.5, hum: floatPtr(64), cond: "Sunny"},
+		},
+		{
+			name: "Pirate-Weather",
+			src:  &PirateWeatherSource{key: "k"},
+			body: `{"currently":{"temperature":8.3,"apparentTemperature":6.1,"humidity":0.91,"summary":"Mostly Cloudy","windSpeed":4.0,"pressure":1009.8}}`,
+			want: want{temp: 8.3, feels: floatPtr(6.1), hum: floatPtr(91), wind: floatPtr(4), pres: floatPtr(1009.8), cond: "Mostly Cloudy"},
+		},
+		{
+			name: "OpenWeatherMap",
+			src:  &OpenWeatherSource{key: "k"},
+			body: `{"main":{"temp":15.1,"humidity":58,"pressure":1021},"wind":{"speed":1.5},"weather":[{"id":802,"description":"scattered clouds"}]}`,
+			want: want{temp: 15.1, hum: floatPtr(58), wind: floatPtr(1.5), pres: floatPtr(1021), cond: "scattered clouds", rawCode: code(802)},
+		},
+		{
+			name: "Visual Crossing",
+			src:  &VisualCrossingSource{key: "k"},
+			body: `{"resolvedAddress":"Berlin, Deutschland","tzoffset":2.0,"currentConditions":{"datetime":"09:00:00","temp":12.4,"humidity":81.3,"windspeed":10.8,"pressure":1016.0,"conditions":"Partially cloudy","icon":"partly-cloudy-day","sunriseEpoch":1791955500,"sunsetEpoch":1791994440}}`,
+			want: want{temp: 12.4, hum: floatPtr(81.3), wind: floatPtr(3), pres: floatPtr(1016), cond: "Partially cloudy"},
+		},
+		{
+			name: "Visual Crossing without humidity",
+			src:  &VisualCrossingSource{key: "k"},
+			body: `{"currentConditions":{"temp":-1.5,"conditions":"Snow"}}`,
+			want: want{temp: -1.5, cond: "Snow"},
+		},
+	}
+	optEqual := func(a, b *float64) bool {
+		return (a == nil) == (b == nil) && (a == nil || *a-*b < 1e-9 && *b-*a < 1e-9)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := fetchRecorded(t, tt.src, ForecastSpec{}, tt.body)
+			w := tt.want
+			if got.Temperature != w.temp || got.Condition != w.cond {
+				t.Errorf("temp/condition = %.1f %q, want %.1f %q", got.Temperature, got.Condition, w.temp, w.cond)
+			}
+			if !optEqual(got.Humidity, w.hum) || !optEqual(got.WindSpeed, w.wind) || !optEqual(got.Pressure, w.pres) {
+				t.Errorf("humidity/wind/pressure = %v/%v/%v, want %v/%v/%v", got.Humidity, got.WindSpeed, got.Pressure, w.hum, w.wind, w.pres)
+			}
+			if !optEqual(got.FeelsLike, w.feels) {
+				t.Errorf("feels like = %v, want %v", got.FeelsLike, w.feels)
+			}
+			if (got.RawCode == nil) != (w.rawCode == nil) || got.RawCode != nil && *got.RawCode != *w.rawCode {
+				t.Errorf("raw code = %v, want %v", got.RawCode, w.rawCode)
+			}
+		})
+	}
+}
+
+// TestObservedAt checks the observation time formats: local time plus UTC offset, RFC 3339
+// and Unix seconds in the location's zone.
+func TestObservedAt(t *testing.T) {
+	tests := []struct {
+		name string
+		src  WeatherSource
+		body string
+		want string // RFC 3339; empty if the source has no time
+	}{
+		{"Open-Meteo", &OpenMeteoSource{}, `{"utc_offset_seconds":7200,"current":{"time":"2026-10-14T12:15","temperature_2m":14}}`, "2026-10-14T12:15:00+02:00"},
+		{"Tomorrow.io", &TomorrowIOSource{apiKey: "k"}, `{"data":{"time":"2026-10-14T10:14:00Z","values":{"temperature":9.6}}}`, "2026-10-14T10:14:00Z"},
+		{"WeatherAPI.com", &WeatherAPISource{key: "k"}, `{"location":{"tz_id":"America/New_York"},"current":{"last_updated_epoch":1791972000,"temp_c":11}}`, "2026-10-14T06:00:00-04:00"},
+		{"WeatherAPI.com unknown zone", &WeatherAPISource{key: "k"}, `{"location":{"tz_id":"Mars/Olympus"},"current":{"last_updated_epoch":1791972000,"temp_c":11}}`, "2026-10-14T10:00:00Z"},
+		{"Pirate-Weather", &PirateWeatherSource{key: "k"}, `{"offset":-7,"currently":{"time":1791972000,"temperature":8.3}}`, "2026-10-14T03:00:00-07:00"},
+		{"OpenWeatherMap", &OpenWeatherSource{key: "k"}, `{"dt":1791972000,"timezone":19800,"main":{"temp":15.1}}`, "2026-10-14T15:30:00+05:30"},
+		{"Visual Crossing", &VisualCrossingSource{key: "k"}, `{"tzoffset":2.0,"currentConditions":{"datetimeEpoch":1791972000,"temp":12.4}}`, "2026-10-14T12:00:00+02:00"},
+		{"Meteosource", &MeteosourceSource{key: "k"}, `{"current":{"temperature":12.5}}`, ""},
+		{"Open-Meteo malformed", &OpenMeteoSource{}, `{"current":{"time":"yesterday","temperature_2m":14}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := fetchRecorded(t, tt.src, ForecastSpec{}, tt.body)
+			if got.Error != nil {
+				t.Fatal(got.Error)
+			}
+			if tt.want == "" {
+				if got.ObservedAt != nil {
+					t.Errorf("observed at %v, want none", got.ObservedAt)
+				}
+				return
+			}
+			if got.ObservedAt == nil || got.ObservedAt.Format(time.RFC3339) != tt.want {
+				t.Errorf("observed at %v, want %s", got.ObservedAt, tt.want)
+			}
+		})
+	}
+
+	observed := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	d := WeatherData{ObservedAt: &observed}
+	if d.Stale(observed.Add(StaleAfter)) || !d.Stale(observed.Add(StaleAfter+time.Minute)) || (WeatherData{}).Stale(observed) {
+		t.Errorf("Stale: want readings older than %v only", StaleAfter)
+	}
+}
+
+// TestSourceFailures checks that every source reports HTTP errors, malformed and truncated JSON.
+func TestSourceFailures(t *testing.T) {
+	sources := []WeatherSource{&OpenMeteoSource{}, &TomorrowIOSource{apiKey: "k"}, &WeatherAPISource{key: "k"},
+		&MeteosourceSource{key: "k"}, &PirateWeatherSource{key: "k"}, &OpenWeatherSource{key: "k"}, &VisualCrossingSource{key: "k"},
+		&AccuWeatherSource{key: "k"}}
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{"HTTP error", func(w http.ResponseWriter, r *http.Request) { http.Error(w, "nope", http.StatusUnauthorized) }, "HTTP 401"},
+		{"malformed JSON", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"current":]}`)) }, "decode"},
+		{"truncated JSON", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"current":`)) }, "truncated response"},
+	} {
+		srv := httptest.NewServer(tc.handler)
+		target, _ := url.Parse(srv.URL)
+		agg := NewAggregator(sources, Options{Location: &[2]float64{52.52, 13.41}})
+		agg.Client = &http.Client{Transport: rewriteTransport{target}}
+		data, err := agg.Fetch(context.Background(), "Berlin")
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range data {
+			if d.Error == nil || !strings.Contains(d.Error.Error(), tc.wantErr) {
+				t.Errorf("%s: %s error = %v, want %q", tc.name, d.Source, d.Error, tc.wantErr)
+			}
+		}
+	}
+}
+
+func TestAccuWeather(t *testing.T) {
+	var lookups []string
+	quotaUsed, quoted := false, false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if quotaUsed {
+			http.Error(w, `{"Code":"ServiceUnavailable","Message":"The allowed number of requests has been exceeded."}`, http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/locations/v1/cities/geoposition/search"):
+			lookups = append(lookups, r.URL.Path+"?q="+r.URL.Query().Get("q"))
+			w.Write([]byte(`{"Key":"178087","LocalizedName":"Berlin"}`))
+		case strings.HasPrefix(r.URL.Path, "/locations/v1/"):
+			lookups = append(lookups, r.URL.Path+"?q="+r.URL.Query().Get("q"))
+			if r.URL.Query().Get("q") == "Nowhere" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[{"Key":"178087","LocalizedName":"Berlin"}]`))
+		case r.URL.Path == "/currentconditions/v1/178087" && quoted:
+			w.Write([]byte(`[{"WeatherText":"Mostly cloudy","Temperature":{"Metric":{"Value":"13.3","Unit":"C"}},"RelativeHumidity":"77%"}]`))
+		case r.URL.Path == "/currentconditions/v1/178087" && r.URL.Query().Get("details") == "true":
+			w.Write([]byte(`[{"WeatherText":"Mostly cloudy","WeatherIcon":6,"Temperature":{"Metric":{"Value":13.3,"Unit":"C"}},
+				"RelativeHumidity":77,"Wind":{"Speed":{"Metric":{"Value":7.2,"Unit":"km/h"}}},"Pressure":{"Metric":{"Value":1017,"Unit":"mb"}}}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	src := &AccuWeatherSource{key: "k", baseURL: srv.URL}
+
+	t.Run("lookup once per run", func(t *testing.T) {
+		lookups = nil
+		ctx := NewAggregator(nil, Options{Country: "DE"}).withConfig(context.Background())
+		for i := 0; i < 2; i++ {
+			got := src.Fetch(ctx, "Berlin", nil)
+			if got.Error != nil {
+				t.Fatal(got.Error)
+			}
+			if got.Temperature != 13.3 || got.Humidity == nil || *got.Humidity != 77 || got.Condition != "Mostly cloudy" ||
+				got.WindSpeed == nil || *got.WindSpeed != 2 || got.Pressure == nil || *got.Pressure != 1017 || got.RawCode == nil || *got.RawCode != 6 {
+				t.Errorf("reading = %+v", got)
+			}
+		}
+		if len(lookups) != 1 || lookups[0] != "/locations/v1/cities/DE/search?q=Berlin" {
+			t.Errorf("location lookups = %v, want one country search", lookups)
+		}
+	})
+
+	t.Run("fixed location", func(t *testing.T) {
+		lookups = nil
+		ctx := NewAggregator(nil, Options{Location: &[2]float64{52.52, 13.41}}).withConfig(context.Background())
+		if got := src.Fetch(ctx, "Berlin", nil); got.Error != nil {
+			t.Fatal(got.Error)
+		}
+		if len(lookups) != 1 || lookups[0] != "/locations/v1/cities/geoposition/search?q=52.52,13.41" {
+			t.Errorf("location lookups = %v, want a geoposition search", lookups)
+		}
+	})
+
+	t.Run("unknown city", func(t *testing.T) {
+		got := src.Fetch(NewAggregator(nil, Options{}).withConfig(context.Background()), "Nowhere", nil)
+		if got.Error == nil || !strings.Contains(got.Error.Error(), `no AccuWeather location found for "Nowhere"`) {
+			t.Errorf("error = %v, want location not found", got.Error)
+		}
+	})
+
+	t.Run("quoted values", func(t *testing.T) {
+		quoted = true
+		defer func() { quoted = false }()
+		got := src.Fetch(NewAggregator(nil, Options{}).withConfig(context.Background()), "Berlin", nil)
+		if got.Error != nil || got.Temperature != 13.3 || got.Humidity == nil || *got.Humidity != 77 {
+			t.Errorf("reading = %+v, want 13.3°C and 77%%", got)
+		}
+	})
+
+	t.Run("quota exhausted", func(t *testing.T) {
+		quotaUsed = true
+		defer func() { quotaUsed = false }()
+		got := src.Fetch(NewAggregator(nil, Options{}).withConfig(context.Background()), "Berlin", nil)
+		if !errors.Is(got.Error, errAccuWeatherLimit) || !strings.Contains(got.Error.Error(), "HTTP 503") {
+			t.Errorf("error = %v, want the request limit explained", got.Error)
+		}
+	})
+}
+
+func TestBaseURLOverride(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{"current":{},"currentConditions":{}}`))
+	}))
+	defer srv.Close()
+	mirror := srv.URL + "/mirror/"
+
+	tests := []struct {
+		src      WeatherSource
+		wantPath string
+	}{
+		{&OpenMeteoSource{baseURL: mirror}, "/mirror/v1/forecast"},
+		{&TomorrowIOSource{apiKey: "k", baseURL: mirror}, "/mirror/v4/weather/realtime"},
+		{&WeatherAPISource{key: "k", baseURL: mirror}, "/mirror/v1/forecast.json"},
+		{&MeteosourceSource{key: "k", baseURL: mirror}, "/mirror/api/v1/free/point"},
+		{&PirateWeatherSource{key: "k", baseURL: mirror}, "/mirror/forecast/k/52.5200,13.4100"},
+		{&OpenWeatherSource{key: "k", baseURL: mirror}, "/mirror/data/2.5/weather"},
+		{&VisualCrossingSource{key: "k", baseURL: mirror}, "/mirror/VisualCrossingWebServices/rest/services/timeline/52.52,13.41/today"},
+	}
+	for _, tt := range tests {
+		gotPath = ""
+		// No custom transport: the request must reach the mirror on its own
+		data, err := NewAggregator([]WeatherSource{tt.src}, Options{Location: &[2]float64{52.52, 13.41}}).Fetch(context.Background(), "Berlin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0].Error != nil || gotPath != tt.wantPath {
+			t.Errorf("%s: path = %q, error = %v; want %q", tt.src.Name(), gotPath, data[0].Error, tt.wantPath)
+		}
+	}
+}
+
+func TestMeteosourceErrorEnvelope(t *testing.T) {
+	tests := []struct{ body, wantErr string }{
+		{`{"detail":"Invalid API key"}`, "API error: Invalid API key"},
+		{`{"error":{"code":429,"message":"Daily limit exceeded"}}`, "API error: Daily limit exceeded"},
+		{`{"detail":[{"loc":["query","lat"],"msg":"out of range"}]}`, `API error: [{"loc":["query","lat"],"msg":"out of range"}]`},
+		{`{"lat":"52.52N"}`, "no current weather"},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.body))
+		}))
+		src := &MeteosourceSource{key: "k", baseURL: srv.URL}
+		data, err := NewAggregator([]WeatherSource{src}, Options{Location: &[2]float64{52.52, 13.41}}).Fetch(context.Background(), "Berlin")
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := data[0]; d.Error == nil || !strings.Contains(d.Error.Error(), tt.wantErr) {
+			t.Errorf("body %s: error = %v, want %q", tt.body, d.Error, tt.wantErr)
+		}
+	}
+}
+
+func TestErrorEnvelopes(t *testing.T) {
+	tests := []struct {
+		name, body, wantErr string
+		src                 WeatherSource
+	}{
+		{"Open-Meteo", `{"error":true,"reason":"Latitude must be in range of -90 to 90°."}`, "Latitude must be in range", &OpenMeteoSource{}},
+		{"Tomorrow.io", `{"code":429001,"type":"Too Many Calls","message":"The request limit for this resource has been reached."}`, "Too Many Calls: The request limit", &TomorrowIOSource{apiKey: "k"}},
+		{"WeatherAPI.com", `{"error":{"code":1006,"message":"No matching location found."}}`, "No matching location found.", &WeatherAPISource{key: "k"}},
+		{"Pirate-Weather", `{"error":"Invalid or missing API key"}`, "Invalid or missing API key", &PirateWeatherSource{key: "k"}},
+		{"Weatherstack-style envelope", `{"success":false,"error":{"code":101,"type":"invalid_access_key","info":"You have not supplied a valid API Access Key."}}`, "You have not supplied a valid API Access Key.", &PirateWeatherSource{key: "k"}},
+		{"OpenWeatherMap", `{"cod":"404","message":"city not found"}`, "API error 404: city not found", &OpenWeatherSource{key: "k"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			target, _ := url.Parse(srv.URL)
+			agg := NewAggregator([]WeatherSource{tt.src}, Options{Location: &[2]float64{52.52, 13.41}})
+			agg.Client = &http.Client{Transport: rewriteTransport{target}}
+			data, err := agg.Fetch(context.Background(), "Berlin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := data[0]; d.Error == nil || !strings.Contains(d.Error.Error(), tt.wantErr) {
+				t.Errorf("error = %v (temp %.1f), want %q", d.Error, d.Temperature, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Meteosource's free tier has no humidity; it must not count as 0% in the aggregate.
+func TestMissingHumidityNotAveraged(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/point") {
+			w.Write([]byte(`{"current":{"temperature":10,"summary":"Cloudy"}}`))
+			return
+		}
+		w.Write([]byte(`{"current":{"temperature_2m":12,"relative_humidity_2m":80,"weather_code":3}}`))
+	}))
+	defer srv.Close()
+	sources := []WeatherSource{&MeteosourceSource{key: "k", baseURL: srv.URL}, &OpenMeteoSource{baseURL: srv.URL}}
+	data, err := NewAggregator(sources, Options{Location: &[2]float64{52.52, 13.41}}).Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := Aggregate(data)
+	if res.Valid != 2 || res.HumidityCount != 1 || res.AvgHumidity != 80 || res.AvgTemp != 11 {
+		t.Errorf("valid=%d humidity count=%d avg=%.1f temp=%.1f; want 2, 1, 80, 11", res.Valid, res.HumidityCount, res.AvgHumidity, res.AvgTemp)
+	}
+}
+
+func TestFixtureTransport(t *testing.T) {
+	agg := NewAggregator([]WeatherSource{&OpenMeteoSource{}, &TomorrowIOSource{apiKey: "k"}}, Options{Location: &[2]float64{52.52, 13.41}})
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "api.open-meteo.com.json"), []byte(`{"current":{"temperature_2m":9.5,"weather_code":0}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	agg.Client = &http.Client{Transport: FixtureTransport{Dir: dir}}
+	data, err := agg.Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range data {
+		switch d.Source {
+		case "Open-Meteo":
+			if d.Error != nil || d.Temperature != 9.5 {
+				t.Errorf("Open-Meteo = %.1f, %v; want the fixture", d.Temperature, d.Error)
+			}
+		case "Tomorrow.io":
+			if d.Error == nil || !strings.Contains(d.Error.Error(), "HTTP 404") {
+				t.Errorf("Tomorrow.io error = %v, want 404 for the missing fixture", d.Error)
+			}
+		}
+	}
+}
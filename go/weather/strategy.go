@@ -0,0 +1,87 @@
+package weather
+
+import (
+	"math"
+	"sort"
+)
+
+// AggregationStrategy turns the fetched readings into an AggregationResult. The strategies
+// differ in the central value they put into AvgTemp and AvgHumidity; everything else (spread,
+// consensus, averages of the optional fields) is computed as by Aggregate. Library users can
+// plug in their own via Options.Strategy.
+type AggregationStrategy interface {
+	Aggregate(data []WeatherData) AggregationResult
+}
+
+// MeanAggregator uses the mean weighted by WeatherData.Weight, see Aggregate.
+type MeanAggregator struct{}
+
+// MedianAggregator uses the median, which ignores a single far-off source entirely.
+type MedianAggregator struct{}
+
+// Aggregate implements AggregationStrategy with the median.
+func (MedianAggregator) Aggregate(data []WeatherData) AggregationResult {
+	res := Aggregate(data)
+	res.AvgTemp, res.AvgHumidity = res.MedianTemp, res.MedianHumidity
+	return res
+}
+
+// DefaultTrimPct is the share of readings TrimmedMeanAggregator drops at each end by default.
+const DefaultTrimPct = 20
+
+// TrimmedMeanAggregator drops the highest and lowest readings before taking the weighted
+// mean: more robust than the mean to one or two bad sources, while still averaging over
+// more than the middle value like the median.
+type TrimmedMeanAggregator struct {
+	// TrimPct is the percentage of readings dropped at each end; 0 uses DefaultTrimPct.
+	// The count per end is rounded down and at least one reading is kept; when that drops
+	// nothing (few readings or a small TrimPct) the result is the plain weighted mean.
+	TrimPct float64
+}
+
+// Aggregate implements AggregationStrategy with the trimmed mean.
+func (s TrimmedMeanAggregator) Aggregate(data []WeatherData) AggregationResult {
+	res := Aggregate(data)
+	pct := s.TrimPct
+	if pct <= 0 {
+		pct = DefaultTrimPct
+	}
+	var temps, tempWeights, hums, humWeights []float64
+	for _, d := range data {
+		if d.AirQuality || d.Error != nil {
+			continue
+		}
+		w := sourceWeight(d)
+		temps, tempWeights = append(temps, d.Temperature), append(tempWeights, w)
+		if d.Humidity != nil {
+			hums, humWeights = append(hums, *d.Humidity), append(humWeights, w)
+		}
+	}
+	if len(temps) > 0 {
+		res.AvgTemp = trimmedMean(temps, tempWeights, pct)
+	}
+	if len(hums) > 0 {
+		res.AvgHumidity = trimmedMean(hums, humWeights, pct)
+	}
+	return res
+}
+
+// trimmedMean drops pct percent of values (with their weights) at both ends, see
+// TrimmedMeanAggregator, and returns the weighted mean of the rest.
+func trimmedMean(values, weights []float64, pct float64) float64 {
+	n := len(values)
+	k := min(int(math.Floor(float64(n)*pct/100)), (n-1)/2)
+	if k <= 0 {
+		return weightedMean(values, weights)
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+	kept, keptWeights := make([]float64, 0, n-2*k), make([]float64, 0, n-2*k)
+	for _, i := range order[k : n-k] {
+		kept, keptWeights = append(kept, values[i]), append(keptWeights, weights[i])
+	}
+	return weightedMean(kept, keptWeights)
+}
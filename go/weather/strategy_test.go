@@ -0,0 +1,107 @@
+package weather
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// strategyData has one far-off source (30°C), one failure and an air quality entry.
+var strategyData = []WeatherData{
+	{Source: "A", Temperature: 9, Humidity: floatPtr(30), Condition: "Clear"},
+	{Source: "B", Temperature: 11, Humidity: floatPtr(60), Condition: "Clear"},
+	{Source: "C", Temperature: 12, Humidity: floatPtr(66), Condition: "Cloudy"},
+	{Source: "D", Temperature: 16, Humidity: floatPtr(81), Condition: "Clear"},
+	{Source: "E", Temperature: 30, Humidity: floatPtr(98), Condition: "Clear"},
+	{Source: "F", Error: errors.New("timeout")},
+	{Source: "Air", AirQuality: true},
+}
+
+func TestAggregationStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy AggregationStrategy
+		temp     float64
+		humidity float64
+	}{
+		{"mean", MeanAggregator{}, 15.6, 67},
+		{"median", MedianAggregator{}, 12, 66},
+		// 20% of 5 drops A and E: (11+12+16)/3 and (60+66+81)/3
+		{"trimmed", TrimmedMeanAggregator{}, 13, 69},
+	}
+	mean := Aggregate(strategyData)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.strategy.Aggregate(strategyData)
+			if math.Abs(res.AvgTemp-tt.temp) > 1e-9 || math.Abs(res.AvgHumidity-tt.humidity) > 1e-9 {
+				t.Errorf("central values = %.3f°C, %.3f%%; want %.3f°C, %.3f%%", res.AvgTemp, res.AvgHumidity, tt.temp, tt.humidity)
+			}
+			// only the central values depend on the strategy
+			if res.Valid != 5 || res.Total != 6 || res.Consensus != "Clear" || res.StdDevTemp != mean.StdDevTemp ||
+				res.MedianTemp != 12 || res.MinTemp != 9 || res.MaxTemp != 30 {
+				t.Errorf("result = %+v, want the common fields of Aggregate", res)
+			}
+		})
+	}
+
+	agg := NewAggregator(nil, Options{})
+	if got := agg.Aggregate(strategyData).AvgTemp; got != mean.AvgTemp {
+		t.Errorf("default strategy: %.2f, want the mean %.2f", got, mean.AvgTemp)
+	}
+	agg.Options.Strategy = maxStrategy{}
+	if got := agg.Aggregate(strategyData).AvgTemp; got != 30 {
+		t.Errorf("custom strategy: %.2f, want 30", got)
+	}
+}
+
+func TestCoolestWarmestSource(t *testing.T) {
+	data := []WeatherData{
+		{Source: "Failed", Temperature: -40, Error: errors.New("timeout")},
+		{Source: "Air", AirQuality: true},
+		{Source: "Open-Meteo", Temperature: 12.1},
+		{Source: "Tomorrow.io", Temperature: 16.8},
+		{Source: "WeatherAPI.com", Temperature: 12.1}, // tie: the first one is reported
+		{Source: "Rejected", Temperature: 35, Error: ErrOutlier},
+		{Source: "Meteosource", Temperature: 14},
+	}
+	for _, s := range []AggregationStrategy{MeanAggregator{}, MedianAggregator{}, TrimmedMeanAggregator{}} {
+		res := s.Aggregate(data)
+		if res.MinSource != "Open-Meteo" || res.MinTemp != 12.1 || res.MaxSource != "Tomorrow.io" || res.MaxTemp != 16.8 {
+			t.Errorf("%T: coolest %s %.1f, warmest %s %.1f; want Open-Meteo 12.1, Tomorrow.io 16.8", s, res.MinSource, res.MinTemp, res.MaxSource, res.MaxTemp)
+		}
+	}
+	if res := Aggregate(data[:2]); res.MinSource != "" || res.MaxSource != "" {
+		t.Errorf("no valid readings: coolest %q, warmest %q; want none", res.MinSource, res.MaxSource)
+	}
+}
+
+// maxStrategy is a user-supplied strategy reporting the warmest reading.
+type maxStrategy struct{}
+
+func (maxStrategy) Aggregate(data []WeatherData) AggregationResult {
+	res := Aggregate(data)
+	res.AvgTemp = res.MaxTemp
+	return res
+}
+
+func TestTrimmedMean(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []float64
+		weights []float64
+		pct     float64
+		want    float64
+	}{
+		{"two values are not trimmed", []float64{10, 20}, []float64{1, 1}, 20, 15},
+		{"small pct drops nothing", []float64{1, 10, 11, 12, 40}, []float64{1, 1, 1, 1, 1}, 1, 14.8},
+		{"20% of five", []float64{1, 10, 11, 12, 40}, []float64{1, 1, 1, 1, 1}, 20, 11},
+		{"at least one kept", []float64{1, 10, 40}, []float64{1, 1, 1}, 50, 10},
+		{"weights of the kept values", []float64{0, 10, 20, 100}, []float64{5, 3, 1, 5}, 25, 12.5},
+		{"40% of ten", []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 100}, []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, 40, 4.5},
+	}
+	for _, tt := range tests {
+		if got := trimmedMean(tt.values, tt.weights, tt.pct); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: trimmedMean = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
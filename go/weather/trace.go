@@ -0,0 +1,108 @@
+package weather
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// requestTiming holds the phases of one traced HTTP request attempt (see Options.Trace).
+// DNS, Connect and TLS stay 0 when the phase was skipped, e.g. on a reused connection.
+type requestTiming struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration // from asking for a connection until the first response byte
+	Reused  bool          // the connection came from the pool
+}
+
+// requestTracer fills a requestTiming from httptrace callbacks. The transport may call
+// them from several goroutines (e.g. parallel dials), hence the mutex.
+type requestTracer struct {
+	mu                                   sync.Mutex
+	start, dnsStart, connStart, tlsStart time.Time
+	timing                               requestTiming
+}
+
+// since records the time elapsed since from into d.
+func (t *requestTracer) since(from *time.Time, d *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !from.IsZero() {
+		*d = time.Since(*from)
+	}
+}
+
+func (t *requestTracer) mark(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*at = time.Now()
+}
+
+// clientTrace returns the httptrace hooks that feed t.
+func (t *requestTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) { t.mark(&t.start) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.timing.Reused = info.Reused
+			t.mu.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.since(&t.dnsStart, &t.timing.DNS) },
+		ConnectStart:         func(_, _ string) { t.mark(&t.connStart) },
+		ConnectDone:          func(_, _ string, _ error) { t.since(&t.connStart, &t.timing.Connect) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.since(&t.tlsStart, &t.timing.TLS) },
+		GotFirstResponseByte: func() { t.since(&t.start, &t.timing.TTFB) },
+	}
+}
+
+func (t *requestTracer) result() requestTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
+
+// traceCollector gathers the request timings of one source fetch, see fetchWithTiming.
+type traceCollector struct {
+	log  *slog.Logger
+	mu   sync.Mutex
+	ttfb time.Duration
+}
+
+type traceCollectorKey struct{}
+
+func withTraceCollector(ctx context.Context, c *traceCollector) context.Context {
+	return context.WithValue(ctx, traceCollectorKey{}, c)
+}
+
+// traceCollectorFrom returns the collector of the current fetch; nil when tracing is off.
+func traceCollectorFrom(ctx context.Context) *traceCollector {
+	c, _ := ctx.Value(traceCollectorKey{}).(*traceCollector)
+	return c
+}
+
+// trace attaches a tracer for one request attempt to ctx. Call done with the sanitized
+// URL once the response headers arrived or the attempt failed.
+func (c *traceCollector) trace(ctx context.Context) (traced context.Context, done func(url string)) {
+	t := &requestTracer{}
+	return httptrace.WithClientTrace(ctx, t.clientTrace()), func(url string) {
+		timing := t.result()
+		c.mu.Lock()
+		c.ttfb += timing.TTFB
+		c.mu.Unlock()
+		c.log.Info("http trace", "url", url, "dns", timing.DNS, "connect", timing.Connect,
+			"tls", timing.TLS, "ttfb", timing.TTFB, "reused", timing.Reused)
+	}
+}
+
+// TTFB is the summed time to first byte of all traced requests so far.
+func (c *traceCollector) TTFB() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttfb
+}
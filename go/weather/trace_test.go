@@ -0,0 +1,75 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTracer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, "{}")
+	}))
+	defer srv.Close()
+	tr := srv.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig.ServerName = "example.com" // the test certificate's name
+	client := &http.Client{Transport: tr}
+	defer tr.CloseIdleConnections()
+	// "localhost" instead of the IP makes the transport resolve a name
+	u, _ := url.Parse(srv.URL)
+	target := "https://localhost:" + u.Port()
+
+	rt := &requestTracer{}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), rt.clientTrace()), http.MethodGet, target, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := rt.result(); got.DNS <= 0 || got.Connect <= 0 || got.TLS <= 0 || got.TTFB < 10*time.Millisecond || got.Reused {
+		t.Errorf("timing = %+v, want all phases of a new connection and TTFB ≥ 10ms", got)
+	}
+}
+
+func TestTraceOption(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(15 * time.Millisecond)
+		fmt.Fprint(w, `{"current":{"temperature_2m":9.5,"weather_code":0}}`)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	for _, trace := range []bool{false, true} {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		agg := NewAggregator([]WeatherSource{&OpenMeteoSource{}}, Options{Location: &[2]float64{52.52, 13.41}, Trace: trace, Logger: logger})
+		agg.Client = &http.Client{Transport: rewriteTransport{target}}
+		data, err := agg.Fetch(context.Background(), "Berlin")
+		if err != nil || data[0].Error != nil {
+			t.Fatalf("fetch failed: %v %v", err, data[0].Error)
+		}
+		d := data[0]
+		logged := strings.Contains(buf.String(), "http trace") && strings.Contains(buf.String(), "source=Open-Meteo")
+		if !trace {
+			if d.TTFB != 0 || logged {
+				t.Errorf("without trace: TTFB = %v, log = %q; want neither", d.TTFB, buf.String())
+			}
+			continue
+		}
+		if d.TTFB < 15*time.Millisecond || d.TTFB > d.Duration {
+			t.Errorf("TTFB = %v, want ≥ 15ms and at most the duration %v", d.TTFB, d.Duration)
+		}
+		if !logged {
+			t.Errorf("log = %q, want an http trace line for Open-Meteo", buf.String())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WarmUp geocodes cities into Options.CoordCache ahead of the first requests, e.g. when a
+// server starts, with at most workers lookups at a time. Cities with a valid cache entry are
+// skipped. It returns how many cities were geocoded and how many were already cached; the
+// failures, including those cut short by ctx, are joined into err.
+func (a *Aggregator) WarmUp(ctx context.Context, cities []string, workers int) (geocoded, cached int, err error) {
+	if a.Options.CoordCache == nil {
+		return 0, 0, errors.New("warm-up needs a coordinate cache")
+	}
+	ctx = a.withConfig(ctx)
+	cfg := configFrom(ctx)
+	workers = max(workers, 1)
+
+	var mu sync.Mutex
+	var errs []error
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(cities); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for city := range jobs {
+				key := placeKey(city, cfg)
+				if _, _, ok := cfg.coords.get(key, time.Now()); ok {
+					mu.Lock()
+					cached++
+					mu.Unlock()
+					continue
+				}
+				err := ctx.Err()
+				if err == nil {
+					_, err = lookupPlace(ctx, city, key, cfg)
+				}
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", city, err))
+				} else {
+					geocoded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, city := range cities {
+		jobs <- city
+	}
+	close(jobs)
+	wg.Wait()
+	return geocoded, cached, errors.Join(errs...)
+}
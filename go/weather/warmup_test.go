@@ -0,0 +1,71 @@
+package weather
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// peakGeocoder records the highest number of concurrent Geocode calls.
+type peakGeocoder struct {
+	countingGeocoder
+	mu        sync.Mutex
+	cur, peak int
+}
+
+func (g *peakGeocoder) Geocode(ctx context.Context, city string) (Place, error) {
+	g.mu.Lock()
+	g.cur++
+	g.peak = max(g.peak, g.cur)
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.cur--
+		g.mu.Unlock()
+	}()
+	return g.countingGeocoder.Geocode(ctx, city)
+}
+
+func TestWarmUp(t *testing.T) {
+	geo := &peakGeocoder{}
+	withGeocoders(t, geo)
+	path := filepath.Join(t.TempDir(), "coords.json")
+	c := LoadCoordCache(path, time.Hour)
+	if err := c.put("Berlin", 52.52, 13.41, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	agg := NewAggregator(nil, Options{CoordCache: c})
+	cities := []string{"Berlin", "Paris", "Rome", "Oslo", "Lima", "Quito"}
+	geocoded, cached, err := agg.WarmUp(context.Background(), cities, 2)
+	if err != nil || geocoded != 5 || cached != 1 {
+		t.Fatalf("WarmUp = %d geocoded, %d cached, %v; want 5, 1, nil", geocoded, cached, err)
+	}
+	if n := geo.calls.Load(); n != 5 {
+		t.Errorf("%d geocode calls, want one per uncached city", n)
+	}
+	if geo.peak > 2 {
+		t.Errorf("%d concurrent lookups, want at most 2", geo.peak)
+	}
+	reloaded := LoadCoordCache(path, time.Hour)
+	for _, city := range cities {
+		if _, _, ok := reloaded.get(city, time.Now()); !ok {
+			t.Errorf("%s missing from the cache file", city)
+		}
+	}
+
+	// a second warm-up has nothing left to do
+	if geocoded, cached, err := agg.WarmUp(context.Background(), cities, 2); err != nil || geocoded != 0 || cached != len(cities) {
+		t.Errorf("second WarmUp = %d geocoded, %d cached, %v; want all cached", geocoded, cached, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := agg.WarmUp(ctx, []string{"Bern"}, 2); err == nil {
+		t.Error("canceled WarmUp succeeded")
+	}
+	if _, _, err := NewAggregator(nil, Options{}).WarmUp(context.Background(), cities, 2); err == nil {
+		t.Error("WarmUp without a coordinate cache succeeded")
+	}
+}
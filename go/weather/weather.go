@@ -0,0 +1,1920 @@
+// Package weather fetches current weather from several providers concurrently
+// and aggregates the readings into a single consensus.
+package weather
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// WeatherCodeRange represents a range of weather codes mapped to a condition.
+type WeatherCodeRange struct {
+	Min       int    `json:"min"`
+	Max       int    `json:"max"`
+	Condition string `json:"condition"`
+}
+
+// WeatherCodeConfig represents the structure of weather_codes.json.
+type WeatherCodeConfig struct {
+	WMO struct {
+		Ranges []WeatherCodeRange `json:"ranges"`
+	} `json:"wmo"`
+	TomorrowIO map[string]string `json:"tomorrow_io"`
+	Conditions map[string]struct {
+		Keywords []string `json:"keywords"`
+		Emoji    string   `json:"emoji"`
+	} `json:"conditions"`
+}
+
+// WeatherCodes holds the unified weather code mappings loaded from JSON.
+var WeatherCodes WeatherCodeConfig
+var weatherCodesOnce sync.Once
+var weatherCodesErr error
+
+// DefaultClient is the shared HTTP client used when an Aggregator has none. It has no
+// Timeout of its own: requests end with their context, see doGet and DefaultRequestTimeout.
+var DefaultClient = &http.Client{}
+
+// DefaultRequestTimeout bounds each request attempt when the context has no deadline,
+// so callers without one can't hang on a stalled server. A context deadline replaces it.
+const DefaultRequestTimeout = 10 * time.Second
+
+// WeatherData represents weather from a single source.
+// Temperature in Celsius, Humidity as percentage (0-100), WindSpeed in m/s, Pressure in hPa (sea level).
+type WeatherData struct {
+	Source      string
+	Temperature float64
+	FeelsLike   *float64 // apparent temperature in Celsius; nil if the source doesn't report it
+	// DewPoint in Celsius, as reported by the source or else computed from temperature and
+	// humidity (see dewPoint); nil without humidity
+	DewPoint  *float64
+	Humidity  *float64 // Pointer to distinguish between 0% and missing data
+	WindSpeed *float64 // nil if the source doesn't report wind
+	Pressure  *float64 // nil if the source doesn't report pressure
+	Condition string
+	// RawCondition and RawCode keep the provider's original condition text/code for debugging
+	RawCondition string
+	RawCode      *int
+	Error        error
+	Duration     time.Duration
+	// TTFB is the summed time to first byte of the source's requests, part of Duration;
+	// only set with Options.Trace
+	TTFB time.Duration
+	// Forecast holds the requested forecast (see Options.Forecast). ForecastError explains a
+	// missing forecast, e.g. ErrForecastUnsupported; current readings are still valid then.
+	Forecast      []ForecastPoint
+	ForecastError error
+	// Trend is TrendRising, TrendFalling or TrendSteady over the next hours; only set with
+	// Options.Trend and by sources with an hourly forecast
+	Trend string
+	// ObservedAt is when the provider measured the current reading, in the location's time
+	// zone where known; nil if not reported. See Stale.
+	ObservedAt *time.Time
+	// Sunrise and Sunset of the current day in the location's time zone; nil if not reported
+	Sunrise, Sunset *time.Time
+	// AirQuality marks results of an AirQualitySource; they only carry AQI and PM25
+	// and are left out of the weather aggregation.
+	AirQuality bool
+	AQI        *int     // US AQI
+	PM25       *float64 // PM2.5 in µg/m³
+	// Alerts are the active severe weather alerts; only some sources report them
+	Alerts []Alert
+	// Weight is the source's relative weight in the mean temperature and humidity
+	// (see SourceConfig.Weight); 0 counts as 1
+	Weight float64
+}
+
+// StaleAfter is the age from which a reading counts as stale, see WeatherData.Stale.
+// Providers update current conditions every 10–30 minutes.
+const StaleAfter = time.Hour
+
+// Stale reports whether the reading was observed more than StaleAfter before now;
+// false if the source doesn't report the observation time.
+func (d WeatherData) Stale(now time.Time) bool {
+	return d.ObservedAt != nil && now.Sub(*d.ObservedAt) > StaleAfter
+}
+
+type WeatherSource interface {
+	Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData
+	Name() string
+}
+
+// embeddedWeatherCodes is a copy of the shared weather_codes.json in the repo root, so the binary
+// works from any directory. Refresh it with `go generate` after editing the shared file.
+//
+//go:generate cp ../../weather_codes.json weather_codes.json
+//go:embed weather_codes.json
+var embeddedWeatherCodes []byte
+
+// LoadWeatherCodes loads weather code mappings once, from path if given, else from the embedded copy.
+// Only an explicitly provided path can fail to read. A failure is not fatal: WeatherCodes stays
+// empty, sources still report their readings and numeric codes map to a raw code string.
+func LoadWeatherCodes(path string) error {
+	weatherCodesOnce.Do(func() {
+		data, err := readWeatherCodes(path)
+		if err != nil {
+			weatherCodesErr = err
+			return
+		}
+		var codes WeatherCodeConfig
+		if err := json.Unmarshal(data, &codes); err != nil {
+			weatherCodesErr = fmt.Errorf("failed to parse weather_codes.json: %w", err)
+			return
+		}
+		WeatherCodes = codes
+	})
+	return weatherCodesErr
+}
+
+// readWeatherCodes returns the contents of path, or the embedded default when path is empty.
+func readWeatherCodes(path string) ([]byte, error) {
+	if path == "" {
+		return embeddedWeatherCodes, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read weather codes file: %w", err)
+	}
+	return data, nil
+}
+
+// sourceFactory describes a source that InitSources and config files can create.
+type sourceFactory struct {
+	name   string // as returned by the source's Name()
+	envKey string // environment variable with the API key; empty if none is needed
+	// create builds the source; an empty base uses the provider's public endpoint
+	create func(key, base string) WeatherSource
+}
+
+// sourceFactories lists all known sources in their default order.
+var sourceFactories = []sourceFactory{
+	{"Open-Meteo", "", func(_, b string) WeatherSource { return &OpenMeteoSource{baseURL: b} }},
+	{"Tomorrow.io", "TOMORROW_API_KEY", func(k, b string) WeatherSource { return &TomorrowIOSource{apiKey: k, baseURL: b} }},
+	{"WeatherAPI.com", "WEATHER_API_COM_KEY", func(k, b string) WeatherSource { return &WeatherAPISource{key: k, baseURL: b} }},
+	{"Meteosource", "METEOSOURCE_API_KEY", func(k, b string) WeatherSource { return &MeteosourceSource{key: k, baseURL: b} }},
+	{"Pirate-Weather", "PIRATE_WEATHER_API_KEY", func(k, b string) WeatherSource { return &PirateWeatherSource{key: k, baseURL: b} }},
+	{"OpenWeatherMap", "OPENWEATHER_API_KEY", func(k, b string) WeatherSource { return &OpenWeatherSource{key: k, baseURL: b} }},
+	{"Visual Crossing", "VISUALCROSSING_API_KEY", func(k, b string) WeatherSource { return &VisualCrossingSource{key: k, baseURL: b} }},
+	{"AccuWeather", "ACCUWEATHER_API_KEY", func(k, b string) WeatherSource { return &AccuWeatherSource{key: k, baseURL: b} }},
+}
+
+// InitSources creates all available weather sources: Open-Meteo plus every source whose
+// API key is set, see apiKey. A key file that cannot be read leaves its source out; ListSources
+// reports why. See Config for selecting sources explicitly.
+func InitSources() []WeatherSource {
+	var sources []WeatherSource
+	for _, f := range sourceFactories {
+		if f.envKey == "" {
+			sources = append(sources, f.create("", ""))
+		} else if val, err := apiKey(f.envKey); err == nil && val != "" {
+			sources = append(sources, f.create(val, ""))
+		}
+	}
+	return sources
+}
+
+// apiKey returns the environment variable env or, if that is empty, the contents of the file
+// named by env+"_FILE" with surrounding whitespace trimmed. The latter is how Docker and
+// Kubernetes mount secrets. Returns "" if neither is set; a value without any key, such as
+// ",", counts as unset (see splitKeys).
+func apiKey(env string) (string, error) {
+	if val := os.Getenv(env); len(splitKeys(val)) > 0 {
+		return val, nil
+	}
+	path := os.Getenv(env + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", env, err)
+	}
+	key := strings.TrimSpace(string(b))
+	if len(splitKeys(key)) == 0 {
+		return "", fmt.Errorf("%s_FILE: %s is empty", env, path)
+	}
+	return key, nil
+}
+
+// SourceNames returns the names of all known weather sources, whether configured or not.
+func SourceNames() []string {
+	names := make([]string, len(sourceFactories))
+	for i, f := range sourceFactories {
+		names[i] = f.name
+	}
+	return names
+}
+
+// SourceInfo describes a known source for listings such as --list-sources.
+type SourceInfo struct {
+	Name       string
+	EnvKey     string // environment variable with the API key; empty if no key is needed
+	KeyPresent bool   // whether EnvKey or the key file named by EnvKey_FILE provides a key
+	KeyError   error  // why the key file named by EnvKey_FILE cannot be used; nil if fine
+}
+
+// ListSources describes every known source in InitSources order.
+// A source is used by InitSources if it needs no key or its key is present.
+func ListSources() []SourceInfo {
+	infos := make([]SourceInfo, len(sourceFactories))
+	for i, f := range sourceFactories {
+		infos[i] = SourceInfo{Name: f.name, EnvKey: f.envKey}
+		if f.envKey != "" {
+			key, err := apiKey(f.envKey)
+			infos[i].KeyPresent, infos[i].KeyError = key != "", err
+		}
+	}
+	return infos
+}
+
+// baseURLOr returns base without a trailing slash, or def if base is empty.
+func baseURLOr(base, def string) string {
+	if base == "" {
+		return def
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// NormalizeSourceName lowercases and removes everything but letters and digits for comparison,
+// so "OPEN-METEO", "open meteo" and "Open-Meteo" all match.
+func NormalizeSourceName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// projectURL is named in the User-Agent so providers know where requests come from.
+const projectURL = "https://github.com/dustin2023/concepts-of-programming-languages-compared-with-go"
+
+// defaultUserAgent is sent unless Options.UserAgent is set.
+var defaultUserAgent = UserAgent("1.0", "")
+
+// UserAgent returns a descriptive User-Agent for this tool in the given version, e.g.
+// "weather-aggregator/1.2.0 (+https://github.com/...; ops@example.com)". Nominatim's usage
+// policy requires one, and contact, typically an email address, is optional.
+func UserAgent(version, contact string) string {
+	info := "+" + projectURL
+	if contact != "" {
+		info += "; " + contact
+	}
+	return fmt.Sprintf("weather-aggregator/%s (%s)", version, info)
+}
+
+// retryBaseDelay is the first backoff delay; it doubles with every further retry.
+var retryBaseDelay = 200 * time.Millisecond
+
+// doGet creates request with context and returns response.
+// Network errors, 429 and 5xx responses are retried with exponential backoff,
+// or after the server's Retry-After delay when one is given. The body of a 200 response is
+// read up front, so a truncated one (see truncatedBody) is retried too, but only once:
+// a provider that keeps cutting its answer off won't do better on the third try.
+// Errors and logs only contain the URL with API keys redacted, see sanitizeURL.
+func doGet(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", redactURLError(err, secretsFrom(ctx)...))
+	}
+	cfg := configFrom(ctx)
+	req.Header.Set("User-Agent", cfg.userAgent)
+	if id := RequestIDFrom(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	var lastErr error
+	var retryAfter time.Duration
+	truncated := false
+	for attempt := 0; attempt <= cfg.retries; attempt++ {
+		if attempt > 0 {
+			delay := retryBaseDelay << (attempt - 1)
+			if retryAfter > 0 {
+				delay = retryAfter
+			}
+			// Don't wait for a retry that could never finish before the deadline
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				return nil, fmt.Errorf("%w (retry in %v exceeds deadline)", lastErr, delay.Round(time.Millisecond))
+			}
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, fmt.Errorf("%w (retry aborted: %v)", lastErr, err)
+			}
+		}
+
+		if err := cfg.limiter.Wait(ctx, req.URL.Host); err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (retry aborted: %v)", lastErr, err)
+			}
+			return nil, fmt.Errorf("request failed: %w", markTimeout(err))
+		}
+		cfg.logger.Debug("http request", "url", sanitizeURL(rawURL, secretsFrom(ctx)...), "attempt", attempt+1)
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if _, ok := ctx.Deadline(); !ok {
+			attemptCtx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		}
+		traceDone := func(string) {}
+		if tc := traceCollectorFrom(ctx); tc != nil {
+			attemptCtx, traceDone = tc.trace(attemptCtx)
+		}
+		resp, err := cfg.client.Do(req.WithContext(attemptCtx))
+		traceDone(sanitizeURL(rawURL, secretsFrom(ctx)...))
+		if err != nil {
+			cancel()
+			lastErr = fmt.Errorf("request failed: %w", markTimeout(redactURLError(err, secretsFrom(ctx)...)))
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			// The attempt's deadline also covers reading the body
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			cancel()
+			if err == nil && !truncatedBody(body) {
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				return resp, nil
+			}
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("read response: %w", markTimeout(err))
+			}
+			lastErr = fmt.Errorf("%w from %s after %d bytes, the connection was probably dropped", ErrTruncated, req.URL.Host, len(body))
+			if truncated || ctx.Err() != nil {
+				return nil, lastErr
+			}
+			truncated, retryAfter = true, 0
+			continue
+		}
+		resp.Body.Close()
+		cancel()
+		lastErr = &statusError{code: resp.StatusCode, status: resp.Status}
+		if !isRetryableStatus(resp.StatusCode) || resp.StatusCode == http.StatusTooManyRequests && cfg.noRateLimitRetry {
+			return nil, lastErr
+		}
+		retryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return nil, lastErr
+}
+
+// Errors of WeatherData, Fetch and Locate match these with errors.Is, next to ErrCityNotFound
+// and the context errors.
+var (
+	// ErrAuth: the provider rejected the API key (HTTP 401 or 403).
+	ErrAuth = errors.New("authentication failed")
+	// ErrRateLimited: the provider still answered HTTP 429 after the retries.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrTimeout: a request ran into its deadline, be it the context's or the client's.
+	ErrTimeout = errors.New("timeout")
+	// ErrTruncated: a response body ended early, even after a retry.
+	ErrTruncated = errors.New("truncated response")
+)
+
+// truncatedBody reports whether body is empty or a JSON document that ends in the middle,
+// as happens when the connection drops mid-stream. Complete but malformed JSON is left to
+// the caller's decoder.
+func truncatedBody(body []byte) bool {
+	var v json.RawMessage
+	err := json.NewDecoder(bytes.NewReader(body)).Decode(&v)
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// statusError is returned by doGet for a non-200 response; sources inspect the code with errors.As.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("HTTP %d: %s", e.code, e.status) }
+
+// Is maps the status code to the sentinel errors.
+func (e *statusError) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		return e.code == http.StatusUnauthorized || e.code == http.StatusForbidden
+	case ErrRateLimited:
+		return e.code == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// timeoutError keeps the message and chain of a timed out request and matches ErrTimeout.
+type timeoutError struct{ err error }
+
+func (e *timeoutError) Error() string        { return e.err.Error() }
+func (e *timeoutError) Unwrap() error        { return e.err }
+func (e *timeoutError) Is(target error) bool { return target == ErrTimeout }
+
+// markTimeout wraps err in a timeoutError if it is a deadline or network timeout.
+func markTimeout(err error) error {
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+		return &timeoutError{err}
+	}
+	return err
+}
+
+// hasStatus reports whether err comes from a response with one of the given status codes.
+func hasStatus(err error, codes ...int) bool {
+	var se *statusError
+	return errors.As(err, &se) && slices.Contains(codes, se.code)
+}
+
+// secretParams are the query parameters sources use to pass API keys.
+var secretParams = []string{"key", "access_key", "apikey", "appid"}
+
+// redacted replaces API keys in sanitized URLs.
+const redacted = "REDACTED"
+
+// sanitizeURL returns rawURL with API keys redacted: the values of secretParams, the
+// key path segment of Pirate Weather (/forecast/<key>/<lat,lon>), also on mirrors, and any
+// occurrence of the extra secrets (see withSecret). Unparseable URLs are dropped entirely.
+func sanitizeURL(rawURL string, secrets ...string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	q := u.Query()
+	changed := false
+	for name := range q {
+		if slices.Contains(secretParams, strings.ToLower(name)) {
+			q[name] = []string{redacted}
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	if i := strings.Index(u.Path, "/forecast/"); i >= 0 {
+		rest := u.Path[i+len("/forecast/"):]
+		if key, coords, ok := strings.Cut(rest, "/"); ok && key != "" && coords != "" {
+			u.Path, u.RawPath = u.Path[:i]+"/forecast/"+redacted+"/"+coords, ""
+		}
+	}
+	s := u.String()
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(strings.ReplaceAll(s, url.QueryEscape(secret), redacted), secret, redacted)
+		}
+	}
+	return s
+}
+
+type secretsKey struct{}
+
+// withSecret marks key as secret for the requests made with the returned context, for
+// sources that put keys where sanitizeURL wouldn't look (like GenericSource).
+func withSecret(ctx context.Context, key string) context.Context {
+	secrets, _ := ctx.Value(secretsKey{}).([]string)
+	return context.WithValue(ctx, secretsKey{}, append(slices.Clone(secrets), key))
+}
+
+func secretsFrom(ctx context.Context) []string {
+	secrets, _ := ctx.Value(secretsKey{}).([]string)
+	return secrets
+}
+
+// redactURLError sanitizes the URL of a *url.Error in err, as returned by http.Client.Do.
+func redactURLError(err error, secrets ...string) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = sanitizeURL(ue.URL, secrets...)
+	}
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header in delta-seconds or HTTP-date form.
+// Returns false if the header is absent or malformed.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isRetryableStatus reports whether an HTTP status is worth retrying (rate limits and server errors).
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code <= 504)
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// getCoordinates gets coordinates from the per-run cache, the persistent cache or performs geocoding.
+func getCoordinates(ctx context.Context, city string, coordsCache map[string][2]float64) (float64, float64, error) {
+	if coordsCache != nil {
+		if coords, ok := coordsCache[city]; ok {
+			return coords[0], coords[1], nil
+		}
+	}
+	return resolveCoordinates(ctx, city)
+}
+
+// --- Weather API Implementations ---
+// Each API source implements the WeatherSource interface.
+// Free sources without API key: Open-Meteo
+// API key required: WeatherAPI.com, Meteosource, Pirate Weather, Tomorrow.io, OpenWeatherMap
+// Every source has a baseURL (scheme, host and optional path prefix) for mirrors, caching
+// proxies and tests; the zero value queries the provider's public endpoint.
+
+// OpenMeteoSource - no key required.
+type OpenMeteoSource struct{ baseURL string }
+
+func (o *OpenMeteoSource) Name() string { return "Open-Meteo" }
+func (o *OpenMeteoSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	res := WeatherData{Source: o.Name()}
+
+	lat, lon, err := getCoordinates(ctx, city, coordsCache)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	base := baseURLOr(o.baseURL, "https://api.open-meteo.com")
+	weatherURL := fmt.Sprintf("%s/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,apparent_temperature,relative_humidity_2m,weather_code,wind_speed_10m,pressure_msl&wind_speed_unit=ms", base, lat, lon)
+	// timezone=auto returns local times plus utc_offset_seconds for sunrise/sunset and forecasts
+	daily := "sunrise,sunset"
+	spec := forecastFrom(ctx)
+	trend := configFrom(ctx).trend
+	hours := spec.Hours
+	if trend && hours < trendForecastHours {
+		hours = trendForecastHours
+	}
+	if hours > 0 {
+		weatherURL += fmt.Sprintf("&hourly=temperature_2m,weather_code&forecast_hours=%d", hours)
+	}
+	if spec.Hours == 0 && spec.Days > 0 {
+		daily += ",temperature_2m_max,temperature_2m_min,weather_code"
+		weatherURL += fmt.Sprintf("&forecast_days=%d", spec.Days)
+	}
+	weatherURL += "&daily=" + daily + "&timezone=auto"
+	resp, err := doGet(ctx, weatherURL)
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Current struct {
+			Time     string    `json:"time"`
+			Temp     flexFloat `json:"temperature_2m"`
+			Feels    *float64  `json:"apparent_temperature"`
+			Hum      flexFloat `json:"relative_humidity_2m"`
+			Code     int       `json:"weather_code"`
+			Wind     *float64  `json:"wind_speed_10m"`
+			Pressure *float64  `json:"pressure_msl"`
+		}
+		UTCOffset int `json:"utc_offset_seconds"`
+		Hourly    struct {
+			Time []string  `json:"time"`
+			Temp []float64 `json:"temperature_2m"`
+			Code []int     `json:"weather_code"`
+		}
+		Daily struct {
+			Time    []string  `json:"time"`
+			Max     []float64 `json:"temperature_2m_max"`
+			Min     []float64 `json:"temperature_2m_min"`
+			Code    []int     `json:"weather_code"`
+			Sunrise []string  `json:"sunrise"`
+			Sunset  []string  `json:"sunset"`
+		}
+		Error  bool   `json:"error"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode weather response: %w", err)
+		return res
+	}
+	if data.Error {
+		res.Error = fmt.Errorf("API error: %s", data.Reason)
+		return res
+	}
+	res.Temperature, res.FeelsLike = float64(data.Current.Temp), data.Current.Feels
+	res.Humidity = data.Current.Hum.ptr()
+	res.WindSpeed, res.Pressure = data.Current.Wind, data.Current.Pressure
+	code := data.Current.Code
+	res.RawCode = &code
+	res.Condition = mapWMOCode(code)
+	zone := time.FixedZone("", data.UTCOffset)
+	if observed, err := parseOpenMeteoTime(data.Current.Time, zone); err == nil {
+		res.ObservedAt = &observed
+	}
+	if len(data.Daily.Sunrise) > 0 && len(data.Daily.Sunset) > 0 {
+		rise, errRise := parseOpenMeteoTime(data.Daily.Sunrise[0], zone)
+		set, errSet := parseOpenMeteoTime(data.Daily.Sunset[0], zone)
+		if errRise == nil && errSet == nil {
+			res.Sunrise, res.Sunset = &rise, &set
+		}
+	}
+	if trend {
+		hourly, errHourly := openMeteoForecast(data.Hourly.Time, data.Hourly.Temp, nil, data.Hourly.Code, data.UTCOffset)
+		now, errNow := parseOpenMeteoTime(data.Current.Time, zone)
+		if errHourly == nil && errNow == nil {
+			res.Trend = temperatureTrend(res.Temperature, now, hourly)
+		}
+	}
+
+	var points []ForecastPoint
+	switch {
+	case spec.Hours > 0:
+		points, err = openMeteoForecast(data.Hourly.Time, data.Hourly.Temp, nil, data.Hourly.Code, data.UTCOffset)
+	case spec.Days > 0:
+		points, err = openMeteoForecast(data.Daily.Time, data.Daily.Max, data.Daily.Min, data.Daily.Code, data.UTCOffset)
+	}
+	if spec.enabled() {
+		if err == nil {
+			points, err = limitForecast(points, spec)
+		}
+		res.Forecast, res.ForecastError = points, err
+	}
+	return res
+}
+
+// TomorrowIOSource - requires API key, coordinate-based.
+type TomorrowIOSource struct {
+	apiKey  string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+func (t *TomorrowIOSource) Name() string { return "Tomorrow.io" }
+func (t *TomorrowIOSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return t.keys.fetch(ctx, t.apiKey, func(ctx context.Context, key string) WeatherData { return t.fetch(ctx, city, coordsCache, key) })
+}
+
+func (t *TomorrowIOSource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: t.Name()}
+
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+
+	lat, lon, err := getCoordinates(ctx, city, coordsCache)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	base := baseURLOr(t.baseURL, "https://api.tomorrow.io")
+	resp, err := doGet(ctx, fmt.Sprintf("%s/v4/weather/realtime?location=%.4f,%.4f&apikey=%s", base, lat, lon, key))
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Data struct {
+			Time   string `json:"time"` // RFC 3339 in UTC
+			Values struct {
+				Temp      flexFloat `json:"temperature"`
+				Hum       flexFloat `json:"humidity"`
+				WeatherCd int       `json:"weatherCode"`
+				Wind      *float64  `json:"windSpeed"`
+				Pressure  *float64  `json:"pressureSeaLevel"`
+			} `json:"values"`
+		} `json:"data"`
+		// Set instead of data on errors, e.g. {"code":429001,"type":"Too Many Calls","message":"..."}
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if data.Message != "" {
+		res.Error = fmt.Errorf("API error: %s", strings.TrimPrefix(data.Type+": "+data.Message, ": "))
+		return res
+	}
+
+	res.Temperature = float64(data.Data.Values.Temp)
+	res.Humidity = data.Data.Values.Hum.ptr()
+	res.WindSpeed, res.Pressure = data.Data.Values.Wind, data.Data.Values.Pressure
+	code := data.Data.Values.WeatherCd
+	res.RawCode = &code
+	res.Condition = mapTomorrowCode(code)
+	if observed, err := time.Parse(time.RFC3339, data.Data.Time); err == nil {
+		res.ObservedAt = &observed
+	}
+	return res
+}
+
+// WeatherAPISource - requires API key.
+type WeatherAPISource struct {
+	key     string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+func (w *WeatherAPISource) Name() string { return "WeatherAPI.com" }
+func (w *WeatherAPISource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return w.keys.fetch(ctx, w.key, func(ctx context.Context, key string) WeatherData { return w.fetch(ctx, city, coordsCache, key) })
+}
+
+func (w *WeatherAPISource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: w.Name()}
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+	q := url.QueryEscape(locationQuery(ctx, city))
+	// forecast.json includes the current block and, unlike current.json, the active alerts;
+	// hourly forecast data come grouped by day
+	spec := forecastFrom(ctx)
+	days := 1
+	if spec.Days > 0 {
+		days = spec.Days
+	} else if spec.Hours > 0 {
+		days = spec.Hours/24 + 2
+	}
+	base := baseURLOr(w.baseURL, "https://api.weatherapi.com")
+	resp, err := doGet(ctx, fmt.Sprintf("%s/v1/forecast.json?key=%s&q=%s&days=%d&alerts=yes", base, key, q, days))
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Location struct {
+			TZ string `json:"tz_id"`
+		} `json:"location"`
+		Current struct {
+			Updated  int64     `json:"last_updated_epoch"`
+			TempC    flexFloat `json:"temp_c"`
+			FeelsC   *float64  `json:"feelslike_c"`
+			Hum      flexFloat `json:"humidity"`
+			WindKph  *float64  `json:"wind_kph"`
+			Pressure *float64  `json:"pressure_mb"`
+			Cond     struct {
+				Text string `json:"text"`
+				Code *int   `json:"code"`
+			} `json:"condition"`
+		} `json:"current"`
+		Forecast struct {
+			Days []weatherAPIDay `json:"forecastday"`
+		} `json:"forecast"`
+		Alerts struct {
+			Alert []struct {
+				Headline string `json:"headline"`
+				Event    string `json:"event"`
+				Severity string `json:"severity"`
+				Expires  string `json:"expires"` // RFC 3339
+			} `json:"alert"`
+		} `json:"alerts"`
+		Error json.RawMessage `json:"error"` // {"code":1006,"message":"No matching location found."}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if msg := envelopeMessage(data.Error); msg != "" {
+		res.Error = fmt.Errorf("API error: %s", msg)
+		return res
+	}
+	res.Temperature, res.FeelsLike = float64(data.Current.TempC), data.Current.FeelsC
+	res.Humidity = data.Current.Hum.ptr()
+	if data.Current.WindKph != nil {
+		wind := *data.Current.WindKph / 3.6
+		res.WindSpeed = &wind
+	}
+	res.Pressure = data.Current.Pressure
+	res.Condition = data.Current.Cond.Text
+	res.RawCondition, res.RawCode = data.Current.Cond.Text, data.Current.Cond.Code
+	res.ObservedAt = unixTimeIn(data.Current.Updated, tzOrUTC(data.Location.TZ))
+	if spec.enabled() {
+		points := weatherAPIForecast(data.Forecast.Days, spec, data.Current.Updated, data.Location.TZ)
+		res.Forecast, res.ForecastError = limitForecast(points, spec)
+	}
+	for _, a := range data.Alerts.Alert {
+		alert := Alert{Title: a.Headline, Severity: a.Severity, Sources: []string{res.Source}}
+		if alert.Title == "" {
+			alert.Title = a.Event
+		}
+		if t, err := time.Parse(time.RFC3339, a.Expires); err == nil {
+			alert.Expires = &t
+		}
+		res.Alerts = append(res.Alerts, alert)
+	}
+	return res
+}
+
+// weatherAPIDay is one entry of WeatherAPI.com's forecast.forecastday array.
+type weatherAPIDay struct {
+	DateEpoch int64 `json:"date_epoch"`
+	Day       struct {
+		Max  float64 `json:"maxtemp_c"`
+		Min  float64 `json:"mintemp_c"`
+		Cond struct {
+			Text string `json:"text"`
+		} `json:"condition"`
+	} `json:"day"`
+	Hours []struct {
+		Epoch int64   `json:"time_epoch"`
+		Temp  float64 `json:"temp_c"`
+		Cond  struct {
+			Text string `json:"text"`
+		} `json:"condition"`
+	} `json:"hour"`
+}
+
+// weatherAPIForecast flattens the forecast days. Hourly points start at the hour of the
+// current reading (updated, Unix seconds), since the first day also lists past hours.
+func weatherAPIForecast(days []weatherAPIDay, spec ForecastSpec, updated int64, tz string) []ForecastPoint {
+	loc := tzOrUTC(tz)
+	from := time.Unix(updated, 0).Truncate(time.Hour)
+	var points []ForecastPoint
+	for _, d := range days {
+		if spec.Hours == 0 {
+			low := d.Day.Min
+			t := time.Unix(d.DateEpoch, 0).In(loc)
+			points = append(points, ForecastPoint{
+				Time:        time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc),
+				Temperature: d.Day.Max,
+				Low:         &low,
+				Condition:   NormalizeCondition(d.Day.Cond.Text),
+			})
+			continue
+		}
+		for _, h := range d.Hours {
+			if t := time.Unix(h.Epoch, 0); !t.Before(from) {
+				points = append(points, ForecastPoint{Time: t.In(loc), Temperature: h.Temp, Condition: NormalizeCondition(h.Cond.Text)})
+			}
+		}
+	}
+	return points
+}
+
+// MeteosourceSource - requires API key, coordinate-based, no available humidity on free tier.
+type MeteosourceSource struct {
+	key     string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+func (m *MeteosourceSource) Name() string { return "Meteosource" }
+func (m *MeteosourceSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return m.keys.fetch(ctx, m.key, func(ctx context.Context, key string) WeatherData { return m.fetch(ctx, city, coordsCache, key) })
+}
+
+func (m *MeteosourceSource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: m.Name()}
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+	lat, lon, err := getCoordinates(ctx, city, coordsCache)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	base := baseURLOr(m.baseURL, "https://www.meteosource.com")
+	resp, err := doGet(ctx, fmt.Sprintf("%s/api/v1/free/point?lat=%.4f&lon=%.4f&sections=current&language=en&units=metric&key=%s", base, lat, lon, key))
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Current *struct {
+			Temp    flexFloat  `json:"temperature"`
+			Hum     *flexFloat `json:"humidity"`
+			Summary string     `json:"summary"`
+			Wind    struct {
+				Speed *float64 `json:"speed"`
+			} `json:"wind"`
+		} `json:"current"`
+		// Meteosource may answer 200 with an error envelope instead of data
+		Error  json.RawMessage `json:"error"`
+		Detail json.RawMessage `json:"detail"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if msg := envelopeMessage(data.Error, data.Detail); msg != "" {
+		res.Error = fmt.Errorf("API error: %s", msg)
+		return res
+	}
+	if data.Current == nil {
+		res.Error = fmt.Errorf("response has no current weather")
+		return res
+	}
+	res.Temperature, res.Condition = float64(data.Current.Temp), data.Current.Summary
+	res.RawCondition = data.Current.Summary
+	res.Humidity = data.Current.Hum.ptr()
+	res.WindSpeed = data.Current.Wind.Speed
+	return res
+}
+
+// envelopeMessage extracts the message of the first non-empty JSON error field of an
+// error envelope sent with HTTP 200: a string, an object with "message" or "info"
+// (Weatherstack style), or else the raw JSON. Returns "" if none is set.
+func envelopeMessage(fields ...json.RawMessage) string {
+	for _, raw := range fields {
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+		var obj struct {
+			Message string `json:"message"`
+			Info    string `json:"info"`
+		}
+		if json.Unmarshal(raw, &obj) == nil {
+			if obj.Message != "" {
+				return obj.Message
+			}
+			if obj.Info != "" {
+				return obj.Info
+			}
+		}
+		return string(raw)
+	}
+	return ""
+}
+
+// PirateWeatherSource - requires API key, coordinate-based.
+type PirateWeatherSource struct {
+	key     string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+func (p *PirateWeatherSource) Name() string { return "Pirate-Weather" }
+func (p *PirateWeatherSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return p.keys.fetch(ctx, p.key, func(ctx context.Context, key string) WeatherData { return p.fetch(ctx, city, coordsCache, key) })
+}
+
+func (p *PirateWeatherSource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: p.Name()}
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+	lat, lon, err := getCoordinates(ctx, city, coordsCache)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	base := baseURLOr(p.baseURL, "https://api.pirateweather.net")
+	resp, err := doGet(ctx, fmt.Sprintf("%s/forecast/%s/%.4f,%.4f?units=si", base, key, lat, lon))
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Offset    float64 `json:"offset"` // hours from UTC
+		Currently struct {
+			Time     int64     `json:"time"` // unix seconds
+			Temp     flexFloat `json:"temperature"`
+			Feels    *float64  `json:"apparentTemperature"`
+			DewPoint *float64  `json:"dewPoint"`
+			Hum      flexFloat `json:"humidity"`
+			Sum      string    `json:"summary"`
+			Wind     *float64  `json:"windSpeed"`
+			Pressure *float64  `json:"pressure"`
+		} `json:"currently"`
+		Hourly struct {
+			Data []struct {
+				Time int64   `json:"time"`
+				Temp float64 `json:"temperature"`
+				Sum  string  `json:"summary"`
+			} `json:"data"`
+		} `json:"hourly"`
+		Daily struct {
+			Data []struct {
+				Time    int64   `json:"time"`
+				High    float64 `json:"temperatureHigh"`
+				Low     float64 `json:"temperatureLow"`
+				Sum     string  `json:"summary"`
+				Sunrise int64   `json:"sunriseTime"`
+				Sunset  int64   `json:"sunsetTime"`
+			} `json:"data"`
+		} `json:"daily"`
+		Alerts []struct {
+			Title    string `json:"title"`
+			Severity string `json:"severity"`
+			Expires  int64  `json:"expires"` // unix seconds
+		} `json:"alerts"`
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if msg := envelopeMessage(data.Error); msg != "" {
+		res.Error = fmt.Errorf("API error: %s", msg)
+		return res
+	}
+	res.Temperature, res.FeelsLike, res.DewPoint = float64(data.Currently.Temp), data.Currently.Feels, data.Currently.DewPoint
+	if data.Currently.Hum > 0 {
+		hum := float64(data.Currently.Hum) * 100
+		res.Humidity = &hum
+	}
+	res.WindSpeed, res.Pressure = data.Currently.Wind, data.Currently.Pressure
+	res.Condition = data.Currently.Sum
+	res.RawCondition = data.Currently.Sum
+	zone := time.FixedZone("", int(data.Offset*3600))
+	res.ObservedAt = unixTimeIn(data.Currently.Time, zone)
+	if len(data.Daily.Data) > 0 {
+		res.Sunrise, res.Sunset = unixTimeIn(data.Daily.Data[0].Sunrise, zone), unixTimeIn(data.Daily.Data[0].Sunset, zone)
+	}
+	for _, a := range data.Alerts {
+		res.Alerts = append(res.Alerts, Alert{Title: a.Title, Severity: a.Severity, Expires: unixTimeIn(a.Expires, zone), Sources: []string{res.Source}})
+	}
+
+	if spec := forecastFrom(ctx); spec.enabled() {
+		var points []ForecastPoint
+		if spec.Hours > 0 {
+			for _, h := range data.Hourly.Data {
+				points = append(points, ForecastPoint{Time: time.Unix(h.Time, 0).In(zone), Temperature: h.Temp, Condition: NormalizeCondition(h.Sum)})
+			}
+		} else {
+			for _, d := range data.Daily.Data {
+				low := d.Low
+				points = append(points, ForecastPoint{Time: time.Unix(d.Time, 0).In(zone), Temperature: d.High, Low: &low, Condition: NormalizeCondition(d.Sum)})
+			}
+		}
+		res.Forecast, res.ForecastError = limitForecast(points, spec)
+	}
+	return res
+}
+
+// OpenWeatherSource - requires API key, city-name based.
+type OpenWeatherSource struct {
+	key     string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+func (o *OpenWeatherSource) Name() string { return "OpenWeatherMap" }
+func (o *OpenWeatherSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return o.keys.fetch(ctx, o.key, func(ctx context.Context, key string) WeatherData { return o.fetch(ctx, city, coordsCache, key) })
+}
+
+func (o *OpenWeatherSource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: o.Name()}
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+	base := baseURLOr(o.baseURL, "https://api.openweathermap.org")
+	query := "q=" + url.QueryEscape(city)
+	if loc := configFrom(ctx).location; loc != nil {
+		query = fmt.Sprintf("lat=%g&lon=%g", loc[0], loc[1])
+	}
+	resp, err := doGet(ctx, fmt.Sprintf("%s/data/2.5/weather?%s&units=metric&appid=%s", base, query, key))
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Main struct {
+			Temp     flexFloat `json:"temp"`
+			Hum      flexFloat `json:"humidity"`
+			Pressure *float64  `json:"pressure"`
+		} `json:"main"`
+		Wind struct {
+			Speed *float64 `json:"speed"`
+		} `json:"wind"`
+		Weather []struct {
+			ID          int    `json:"id"`
+			Description string `json:"description"`
+		} `json:"weather"`
+		Sys struct {
+			Sunrise int64 `json:"sunrise"`
+			Sunset  int64 `json:"sunset"`
+		} `json:"sys"`
+		Observed int64 `json:"dt"`       // unix seconds
+		Timezone int   `json:"timezone"` // seconds from UTC
+		// cod is 200 (a number) on success, errors carry e.g. "404" and a message
+		Cod     json.RawMessage `json:"cod"`
+		Message string          `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if cod := strings.Trim(string(data.Cod), `"`); cod != "" && cod != "200" {
+		res.Error = fmt.Errorf("API error %s: %s", cod, data.Message)
+		return res
+	}
+	res.Temperature = float64(data.Main.Temp)
+	res.Humidity = data.Main.Hum.ptr()
+	res.WindSpeed, res.Pressure = data.Wind.Speed, data.Main.Pressure
+	if len(data.Weather) > 0 {
+		res.Condition = data.Weather[0].Description
+		res.RawCondition, res.RawCode = data.Weather[0].Description, &data.Weather[0].ID
+	}
+	zone := time.FixedZone("", data.Timezone)
+	res.Sunrise, res.Sunset = unixTimeIn(data.Sys.Sunrise, zone), unixTimeIn(data.Sys.Sunset, zone)
+	res.ObservedAt = unixTimeIn(data.Observed, zone)
+	return res
+}
+
+// VisualCrossingSource - requires API key, queries the Timeline API by city name.
+type VisualCrossingSource struct {
+	key     string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+func (v *VisualCrossingSource) Name() string { return "Visual Crossing" }
+func (v *VisualCrossingSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return v.keys.fetch(ctx, v.key, func(ctx context.Context, key string) WeatherData { return v.fetch(ctx, city, coordsCache, key) })
+}
+
+func (v *VisualCrossingSource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: v.Name()}
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+	base := baseURLOr(v.baseURL, "https://weather.visualcrossing.com")
+	loc := url.PathEscape(locationQuery(ctx, city))
+	// Errors (unknown location, bad key) come as plain text with a 4xx status, which doGet reports
+	resp, err := doGet(ctx, fmt.Sprintf("%s/VisualCrossingWebServices/rest/services/timeline/%s/today?unitGroup=metric&key=%s&include=current", base, loc, key))
+	if err != nil {
+		res.Error = fmt.Errorf("weather request failed: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data struct {
+		TZOffset float64 `json:"tzoffset"` // hours
+		Current  *struct {
+			Temp       flexFloat  `json:"temp"`
+			Humidity   *flexFloat `json:"humidity"`
+			WindSpeed  *float64   `json:"windspeed"` // km/h with unitGroup=metric
+			Pressure   *float64   `json:"pressure"`
+			Conditions string     `json:"conditions"`
+			Icon       string     `json:"icon"`
+			Observed   int64      `json:"datetimeEpoch"`
+			Sunrise    int64      `json:"sunriseEpoch"`
+			Sunset     int64      `json:"sunsetEpoch"`
+		} `json:"currentConditions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if data.Current == nil {
+		res.Error = fmt.Errorf("response has no current weather")
+		return res
+	}
+	c := data.Current
+	res.Temperature, res.Humidity, res.Pressure = float64(c.Temp), c.Humidity.ptr(), c.Pressure
+	if c.WindSpeed != nil {
+		wind := *c.WindSpeed / 3.6
+		res.WindSpeed = &wind
+	}
+	res.Condition = c.Conditions
+	res.RawCondition = c.Icon
+	zone := time.FixedZone("", int(data.TZOffset*3600))
+	res.Sunrise, res.Sunset = unixTimeIn(c.Sunrise, zone), unixTimeIn(c.Sunset, zone)
+	res.ObservedAt = unixTimeIn(c.Observed, zone)
+	return res
+}
+
+// AccuWeatherSource - requires API key. Current conditions are looked up by AccuWeather's own
+// location key, which costs a separate request and is remembered for the rest of the run.
+type AccuWeatherSource struct {
+	key     string // API key, or several separated by commas, see keyRing
+	baseURL string
+	keys    keyRing
+}
+
+// errAccuWeatherLimit explains the 503 AccuWeather answers with once the daily quota is used up.
+var errAccuWeatherLimit = errors.New("request limit reached (the free tier allows 50 calls per day)")
+
+// locationKeyCache holds AccuWeather location keys resolved during one run, keyed by query.
+// A nil cache remembers nothing.
+type locationKeyCache struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func (c *locationKeyCache) get(query string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.keys[query]
+	return key, ok
+}
+
+func (c *locationKeyCache) set(query, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]string)
+	}
+	c.keys[query] = key
+}
+
+func (a *AccuWeatherSource) Name() string { return "AccuWeather" }
+func (a *AccuWeatherSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	return a.keys.fetch(ctx, a.key, func(ctx context.Context, key string) WeatherData { return a.fetch(ctx, city, coordsCache, key) })
+}
+
+func (a *AccuWeatherSource) fetch(ctx context.Context, city string, coordsCache map[string][2]float64, key string) WeatherData {
+	res := WeatherData{Source: a.Name()}
+	if key == "" {
+		res.Error = fmt.Errorf("API key required")
+		return res
+	}
+	base := baseURLOr(a.baseURL, "https://dataservice.accuweather.com")
+	locKey, err := a.locationKey(ctx, base, city, key)
+	if err != nil {
+		res.Error = accuWeatherError("location lookup failed", err)
+		return res
+	}
+
+	resp, err := doGet(ctx, fmt.Sprintf("%s/currentconditions/v1/%s?apikey=%s&details=true", base, url.PathEscape(locKey), key))
+	if err != nil {
+		res.Error = accuWeatherError("weather request failed", err)
+		return res
+	}
+	defer resp.Body.Close()
+	var data []struct {
+		Observed    string `json:"LocalObservationDateTime"` // RFC 3339 with the local offset
+		WeatherText string `json:"WeatherText"`
+		WeatherIcon *int   `json:"WeatherIcon"`
+		Temperature struct {
+			Metric struct {
+				Value flexFloat `json:"Value"`
+			} `json:"Metric"`
+		} `json:"Temperature"`
+		RelativeHumidity *flexFloat `json:"RelativeHumidity"`
+		Wind             struct {
+			Speed struct {
+				Metric struct {
+					Value *float64 `json:"Value"` // km/h
+				} `json:"Metric"`
+			} `json:"Speed"`
+		} `json:"Wind"`
+		Pressure struct {
+			Metric struct {
+				Value *float64 `json:"Value"` // mb
+			} `json:"Metric"`
+		} `json:"Pressure"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		res.Error = fmt.Errorf("failed to decode response: %w", err)
+		return res
+	}
+	if len(data) == 0 {
+		res.Error = fmt.Errorf("response has no current weather")
+		return res
+	}
+	c := data[0]
+	res.Temperature, res.Humidity = float64(c.Temperature.Metric.Value), c.RelativeHumidity.ptr()
+	if speed := c.Wind.Speed.Metric.Value; speed != nil {
+		wind := *speed / 3.6
+		res.WindSpeed = &wind
+	}
+	res.Pressure = c.Pressure.Metric.Value
+	res.Condition = c.WeatherText
+	res.RawCondition, res.RawCode = c.WeatherText, c.WeatherIcon
+	if observed, err := time.Parse(time.RFC3339, c.Observed); err == nil {
+		res.ObservedAt = &observed
+	}
+	return res
+}
+
+// locationKey resolves city (or the fixed location) to an AccuWeather location key with the
+// API key key, consulting the run's cache first. A --country restricts the city search to that country.
+func (a *AccuWeatherSource) locationKey(ctx context.Context, base, city, key string) (string, error) {
+	cfg := configFrom(ctx)
+	query := locationQuery(ctx, city)
+	cacheKey := placeKey(query, cfg)
+	if key, ok := cfg.locationKeys.get(cacheKey); ok {
+		return key, nil
+	}
+
+	var searchURL string
+	switch {
+	case cfg.location != nil:
+		searchURL = fmt.Sprintf("%s/locations/v1/cities/geoposition/search?apikey=%s&q=%s", base, key, url.QueryEscape(query))
+	case cfg.country != "":
+		searchURL = fmt.Sprintf("%s/locations/v1/cities/%s/search?apikey=%s&q=%s", base, url.PathEscape(cfg.country), key, url.QueryEscape(query))
+	default:
+		searchURL = fmt.Sprintf("%s/locations/v1/cities/search?apikey=%s&q=%s", base, key, url.QueryEscape(query))
+	}
+	resp, err := doGet(ctx, searchURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	type location struct {
+		Key string `json:"Key"`
+	}
+	// The city search returns a list, the geoposition search a single object
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return "", fmt.Errorf("failed to decode location response: %w", err)
+	}
+	var matches []location
+	if err := json.Unmarshal(raw, &matches); err != nil {
+		var one location
+		if err := json.Unmarshal(raw, &one); err != nil {
+			return "", fmt.Errorf("failed to decode location response: %w", err)
+		}
+		matches = []location{one}
+	}
+	if len(matches) == 0 || matches[0].Key == "" {
+		return "", fmt.Errorf("no AccuWeather location found for %q", query)
+	}
+	cfg.locationKeys.set(cacheKey, matches[0].Key)
+	return matches[0].Key, nil
+}
+
+// accuWeatherError wraps err, replacing the bare status of an exhausted quota with errAccuWeatherLimit.
+func accuWeatherError(step string, err error) error {
+	if hasStatus(err, http.StatusServiceUnavailable, http.StatusTooManyRequests) {
+		return fmt.Errorf("%s: %w (%w)", step, errAccuWeatherLimit, err)
+	}
+	return fmt.Errorf("%s: %w", step, err)
+}
+
+// tzOrUTC loads the IANA time zone tz; unknown or empty zones give UTC.
+func tzOrUTC(tz string) *time.Location {
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// unixTimeIn converts Unix seconds to a time in zone; 0 (field missing) gives nil.
+func unixTimeIn(secs int64, zone *time.Location) *time.Time {
+	if secs == 0 {
+		return nil
+	}
+	t := time.Unix(secs, 0).In(zone)
+	return &t
+}
+
+// ErrImplausible marks a reading outside physical limits, see validateReading.
+var ErrImplausible = errors.New("implausible reading")
+
+// Plausible temperatures in Celsius, a little beyond the recorded extremes of −89.2°C and 56.7°C.
+const (
+	minTemperature = -90.0
+	maxTemperature = 60.0
+)
+
+// validateReading checks the temperature and humidity of a weather reading against physical
+// limits, so a provider glitch (or a fraction scaled twice) fails the source instead of
+// skewing the average. Missing humidity is fine.
+func validateReading(d WeatherData) error {
+	if math.IsNaN(d.Temperature) || d.Temperature < minTemperature || d.Temperature > maxTemperature {
+		return fmt.Errorf("%w: temperature %.1f°C outside %.0f to %.0f°C", ErrImplausible, d.Temperature, minTemperature, maxTemperature)
+	}
+	if h := d.Humidity; h != nil && (math.IsNaN(*h) || *h < 0 || *h > 100) {
+		return fmt.Errorf("%w: humidity %.1f%% outside 0 to 100%%", ErrImplausible, *h)
+	}
+	return nil
+}
+
+// fetchWithTiming fetches from one source and records its duration.
+// A positive timeout gives the source its own deadline derived from ctx.
+func fetchWithTiming(ctx context.Context, source WeatherSource, city string, coordsCache map[string][2]float64, timeout time.Duration) WeatherData {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	log := configFrom(ctx).logger.With("source", source.Name(), "city", city)
+	var tracer *traceCollector
+	if configFrom(ctx).trace {
+		tracer = &traceCollector{log: log}
+		ctx = withTraceCollector(ctx, tracer)
+	}
+	log.Debug("fetch started")
+	start := time.Now()
+	result := source.Fetch(ctx, city, coordsCache)
+	result.Duration = time.Since(start)
+	if tracer != nil {
+		result.TTFB = tracer.TTFB()
+	}
+	if result.Error == nil && !result.AirQuality {
+		result.Error = validateReading(result)
+	}
+	if result.Error == nil && result.DewPoint == nil && result.Humidity != nil {
+		if dp, ok := dewPoint(result.Temperature, *result.Humidity); ok {
+			result.DewPoint = &dp
+		}
+	}
+	// Sources that support forecasts always set one of the two fields
+	if forecastFrom(ctx).enabled() && result.Error == nil && !result.AirQuality && result.Forecast == nil && result.ForecastError == nil {
+		result.ForecastError = ErrForecastUnsupported
+	}
+	if result.Error != nil {
+		log.Info("fetch failed", "duration", result.Duration, "error", result.Error)
+	} else {
+		log.Debug("fetch finished", "duration", result.Duration, "temperature", result.Temperature)
+	}
+	return result
+}
+
+// Magnus formula coefficients (Sonntag 1990), accurate to about 0.35°C for -45..60°C.
+const (
+	magnusA = 17.62
+	magnusB = 243.12 // °C
+)
+
+// dewPoint computes the dew point in °C from the temperature (°C) and relative humidity (%)
+// with the Magnus formula. ok is false for humidity outside (0, 100].
+func dewPoint(tempC, humidity float64) (dp float64, ok bool) {
+	if humidity <= 0 || humidity > 100 {
+		return 0, false
+	}
+	gamma := math.Log(humidity/100) + magnusA*tempC/(magnusB+tempC)
+	return magnusB * gamma / (magnusA - gamma), true
+}
+
+// seedCoordinates builds the per-run coordinate map shared by all sources.
+// A fixed opts.Location is used as is; otherwise the city is geocoded once.
+// If that fails, the run's geocodeOnce remembers the error, so coordinate-based sources
+// report it right away instead of each repeating the failing lookup. Name-based sources
+// (WeatherAPI.com, OpenWeatherMap) don't need coordinates and still run.
+func seedCoordinates(ctx context.Context, city string, opts Options) map[string][2]float64 {
+	coordsCache := make(map[string][2]float64)
+	log := configFrom(ctx).logger
+	if opts.Location != nil {
+		log.Debug("using fixed location", "city", city, "lat", opts.Location[0], "lon", opts.Location[1])
+		coordsCache[city] = *opts.Location
+		return coordsCache
+	}
+	lat, lon, err := resolveCoordinates(ctx, city)
+	if err != nil {
+		log.Info("pre-geocode failed, coordinate-based sources will fail fast", "city", city, "error", err)
+		return coordsCache
+	}
+	coordsCache[city] = [2]float64{lat, lon}
+	return coordsCache
+}
+
+// fetchWeatherConcurrently fetches from all sources in parallel using goroutines.
+// Pre-geocodes the city to reduce redundant API calls.
+func fetchWeatherConcurrently(ctx context.Context, city string, sources []WeatherSource, opts Options) []WeatherData {
+	return collect(streamConcurrently(ctx, city, seedCoordinates(ctx, city, opts), sources, opts), len(sources))
+}
+
+// streamConcurrently starts one goroutine per source and sends each result as soon as it is done.
+// The channel is closed after the last source finished. A buffered channel acts as
+// semaphore when opts.MaxConcurrency caps the number of in-flight fetches.
+// coordsCache is the run's map from seedCoordinates, shared by all sources.
+func streamConcurrently(ctx context.Context, city string, coordsCache map[string][2]float64, sources []WeatherSource, opts Options) <-chan WeatherData {
+	var sem chan struct{}
+	if opts.MaxConcurrency > 0 {
+		sem = make(chan struct{}, opts.MaxConcurrency)
+	}
+
+	// Buffered so no goroutine leaks if the consumer stops reading early
+	ch := make(chan WeatherData, len(sources))
+	var wg sync.WaitGroup
+	for _, s := range sources {
+		wg.Add(1)
+		go func(src WeatherSource) {
+			defer wg.Done()
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+			d := fetchWithTiming(ctx, src, city, coordsCache, opts.SourceTimeout)
+			opts.Metrics.observe(d)
+			ch <- d
+		}(s)
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+// fetchSequential fetches weather data sequentially for performance comparison.
+func fetchSequential(ctx context.Context, city string, sources []WeatherSource, opts Options) []WeatherData {
+	return collect(streamSequential(ctx, city, seedCoordinates(ctx, city, opts), sources, opts), len(sources))
+}
+
+// streamSequential is the sequential counterpart of streamConcurrently.
+func streamSequential(ctx context.Context, city string, coordsCache map[string][2]float64, sources []WeatherSource, opts Options) <-chan WeatherData {
+	ch := make(chan WeatherData, len(sources))
+	go func() {
+		defer close(ch)
+		for _, s := range sources {
+			d := fetchWithTiming(ctx, s, city, coordsCache, opts.SourceTimeout)
+			opts.Metrics.observe(d)
+			ch <- d
+		}
+	}()
+	return ch
+}
+
+// collect drains ch into a slice.
+func collect(ch <-chan WeatherData, n int) []WeatherData {
+	results := make([]WeatherData, 0, n)
+	for d := range ch {
+		results = append(results, d)
+	}
+	return results
+}
+
+// AggregationResult summarizes the valid readings of one run.
+// AvgTemp and AvgHumidity hold the central value of the AggregationStrategy that produced
+// the result, the weighted mean for Aggregate. Humidity fields are 0 when HumidityCount is 0.
+type AggregationResult struct {
+	AvgTemp        float64
+	MedianTemp     float64
+	MinTemp        float64
+	MaxTemp        float64
+	MinSource      string  // source of MinTemp, the first one on a tie
+	MaxSource      string  // source of MaxTemp, the first one on a tie
+	StdDevTemp     float64 // population standard deviation of the valid temperatures
+	AvgFeelsLike   float64 // 0 when FeelsLikeCount is 0
+	FeelsLikeCount int
+	AvgDewPoint    float64 // 0 when DewPointCount is 0
+	DewPointCount  int
+	AvgHumidity    float64
+	MedianHumidity float64
+	HumidityCount  int
+	AvgWindSpeed   float64 // 0 when WindCount is 0
+	WindCount      int
+	AvgPressure    float64 // 0 when PressureCount is 0
+	PressureCount  int
+	Consensus      string
+	ConsensusVotes int            // sources reporting Consensus, see Agreement
+	Votes          map[string]int // normalized condition -> number of sources
+	Valid          int
+	Total          int
+	// AQI and PM25 come from the first valid air quality result; nil without one
+	AQI  *int
+	PM25 *float64
+	// Alerts of all valid sources, deduplicated by title (see MergeAlerts)
+	Alerts []Alert
+}
+
+// Aggregate calculates mean/median temp and humidity plus the consensus condition from valid data.
+// It is the MeanAggregator strategy.
+func Aggregate(data []WeatherData) AggregationResult {
+	return MeanAggregator{}.Aggregate(data)
+}
+
+// Aggregate implements AggregationStrategy with the weighted mean.
+func (MeanAggregator) Aggregate(data []WeatherData) AggregationResult {
+	res := AggregationResult{Votes: make(map[string]int), Alerts: MergeAlerts(data)}
+	var temps, feels, dews, hums, winds, pressures []float64
+	var tempWeights, humWeights []float64
+	for _, d := range data {
+		if d.AirQuality {
+			if d.Error == nil && res.AQI == nil && res.PM25 == nil {
+				res.AQI, res.PM25 = d.AQI, d.PM25
+			}
+			continue
+		}
+		res.Total++
+		if d.Error == nil {
+			w := sourceWeight(d)
+			temps, tempWeights = append(temps, d.Temperature), append(tempWeights, w)
+			if res.Valid == 0 || d.Temperature < res.MinTemp {
+				res.MinTemp, res.MinSource = d.Temperature, d.Source
+			}
+			if res.Valid == 0 || d.Temperature > res.MaxTemp {
+				res.MaxTemp, res.MaxSource = d.Temperature, d.Source
+			}
+			if d.FeelsLike != nil {
+				feels = append(feels, *d.FeelsLike)
+			}
+			if d.DewPoint != nil {
+				dews = append(dews, *d.DewPoint)
+			}
+			if d.Humidity != nil {
+				hums, humWeights = append(hums, *d.Humidity), append(humWeights, w)
+			}
+			if d.WindSpeed != nil {
+				winds = append(winds, *d.WindSpeed)
+			}
+			if d.Pressure != nil {
+				pressures = append(pressures, *d.Pressure)
+			}
+			res.Votes[NormalizeCondition(d.Condition)]++
+			res.Valid++
+		}
+	}
+
+	if res.Total == 0 {
+		res.Consensus = "No data"
+		return res
+	}
+	if res.Valid == 0 {
+		res.Consensus = "No valid data"
+		return res
+	}
+
+	res.AvgTemp, res.MedianTemp = weightedMean(temps, tempWeights), median(temps)
+	res.StdDevTemp = stdDev(temps)
+	if res.FeelsLikeCount = len(feels); res.FeelsLikeCount > 0 {
+		res.AvgFeelsLike = mean(feels)
+	}
+	if res.DewPointCount = len(dews); res.DewPointCount > 0 {
+		res.AvgDewPoint = mean(dews)
+	}
+	if res.HumidityCount = len(hums); res.HumidityCount > 0 {
+		res.AvgHumidity, res.MedianHumidity = weightedMean(hums, humWeights), median(hums)
+	}
+	if res.WindCount = len(winds); res.WindCount > 0 {
+		res.AvgWindSpeed = mean(winds)
+	}
+	if res.PressureCount = len(pressures); res.PressureCount > 0 {
+		res.AvgPressure = mean(pressures)
+	}
+	res.Consensus = consensusCondition(res.Votes)
+	res.ConsensusVotes = res.Votes[res.Consensus]
+	return res
+}
+
+// sourceWeight is the weight of d in the mean; unset weights count as 1.
+func sourceWeight(d WeatherData) float64 {
+	if d.Weight <= 0 {
+		return 1
+	}
+	return d.Weight
+}
+
+// LowAgreementStdDev is the temperature spread (°C) above which sources are considered to disagree.
+const LowAgreementStdDev = 2.0
+
+// Agreement is the share of valid sources reporting the consensus condition, from 0 to 1;
+// 0 without valid data.
+func (r AggregationResult) Agreement() float64 {
+	if r.Valid == 0 {
+		return 0
+	}
+	return float64(r.ConsensusVotes) / float64(r.Valid)
+}
+
+// LowAgreement reports whether the valid temperatures spread more than LowAgreementStdDev.
+func (r AggregationResult) LowAgreement() bool {
+	return r.Valid > 1 && r.StdDevTemp > LowAgreementStdDev
+}
+
+// AggregateWeather calculates avg temp/humidity and consensus condition from valid data.
+// Kept for callers of the original API; new code should use Aggregate.
+func AggregateWeather(data []WeatherData) (avgTemp, avgHum float64, cond string, valid int) {
+	res := Aggregate(data)
+	return res.AvgTemp, res.AvgHumidity, res.Consensus, res.Valid
+}
+
+// ErrOutlier marks a reading excluded by RejectOutliers.
+var ErrOutlier = errors.New("rejected as outlier")
+
+// outlierMinSigma is the smallest spread (°C) used by RejectOutliers, so sources
+// that agree almost perfectly don't get a 0.2°C difference flagged.
+const outlierMinSigma = 1.0
+
+// RejectOutliers marks valid readings whose temperature is more than k standard deviations
+// from the median as errors, so aggregation skips them. The deviation is estimated robustly
+// from the median absolute deviation, because with only a handful of sources a single outlier
+// inflates the plain standard deviation enough to hide itself.
+// Needs at least 3 valid readings; k <= 0 disables rejection. Returns a copy and the rejected count.
+func RejectOutliers(data []WeatherData, k float64) ([]WeatherData, int) {
+	out := append([]WeatherData(nil), data...)
+	var temps []float64
+	for _, d := range out {
+		if d.Error == nil && !d.AirQuality {
+			temps = append(temps, d.Temperature)
+		}
+	}
+	if k <= 0 || len(temps) < 3 {
+		return out, 0
+	}
+
+	med := median(temps)
+	deviations := make([]float64, len(temps))
+	for i, t := range temps {
+		deviations[i] = math.Abs(t - med)
+	}
+	// 1.4826 scales the MAD to a standard deviation for normally distributed data
+	sigma := math.Max(1.4826*median(deviations), outlierMinSigma)
+
+	rejected := 0
+	for i, d := range out {
+		if d.Error == nil && !d.AirQuality && math.Abs(d.Temperature-med) > k*sigma {
+			out[i].Error = fmt.Errorf("%w: %.1f°C is %.1f°C from median %.1f°C", ErrOutlier, d.Temperature, math.Abs(d.Temperature-med), med)
+			rejected++
+		}
+	}
+	return out, rejected
+}
+
+// ErrStale marks a reading excluded by RejectStale.
+var ErrStale = errors.New("excluded as stale")
+
+// RejectStale marks valid readings observed more than maxAge before now as errors, so a
+// provider serving cached data doesn't count as much as fresh ones. Readings without
+// ObservedAt are kept; maxAge <= 0 disables the check. Returns a copy and the excluded count.
+func RejectStale(data []WeatherData, maxAge time.Duration, now time.Time) ([]WeatherData, int) {
+	out := append([]WeatherData(nil), data...)
+	if maxAge <= 0 {
+		return out, 0
+	}
+	excluded := 0
+	for i, d := range out {
+		if d.Error == nil && !d.AirQuality && d.ObservedAt != nil && now.Sub(*d.ObservedAt) > maxAge {
+			out[i].Error = fmt.Errorf("%w: observed %v ago", ErrStale, now.Sub(*d.ObservedAt).Round(time.Minute))
+			excluded++
+		}
+	}
+	return out, excluded
+}
+
+// mean returns the arithmetic mean of values.
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// weightedMean returns the mean of values with the given weights (same length, all positive).
+func weightedMean(values, weights []float64) float64 {
+	var sum, total float64
+	for i, v := range values {
+		sum += v * weights[i]
+		total += weights[i]
+	}
+	return sum / total
+}
+
+// stdDev returns the population standard deviation of values.
+func stdDev(values []float64) float64 {
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+// median returns the middle value of values; for an even count the two middle values are averaged.
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// severityOrder ranks normalized conditions from most to least severe. Ties in the
+// consensus vote go to the more severe condition, since under-warning is the worse mistake.
+var severityOrder = []string{"Stormy", "Hail", "Freezing Rain", "Snowy", "Rainy", "Foggy", "Haze", "Windy", "Cloudy", "Partly Cloudy", "Clear"}
+
+// severityRank returns the position in severityOrder; conditions not listed rank after all of them.
+func severityRank(cond string) int {
+	if i := slices.Index(severityOrder, cond); i >= 0 {
+		return i
+	}
+	return len(severityOrder)
+}
+
+// consensusCondition returns the condition with the most votes. Ties are broken by
+// severityOrder and then alphabetically, so the result doesn't depend on map iteration order.
+func consensusCondition(condCount map[string]int) string {
+	cond, maxCount := "Unknown", 0
+	for c, count := range condCount {
+		if count > maxCount || count == maxCount && moreSevere(c, cond) {
+			maxCount, cond = count, c
+		}
+	}
+	return cond
+}
+
+// moreSevere reports whether condition a wins a tie against b.
+func moreSevere(a, b string) bool {
+	if ra, rb := severityRank(a), severityRank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// mapWMOCode converts WMO codes to readable conditions. Without loaded codes it returns
+// the raw code, e.g. "WMO 61", which is still more useful than "Unknown".
+func mapWMOCode(code int) string {
+	if len(WeatherCodes.WMO.Ranges) == 0 {
+		return fmt.Sprintf("WMO %d", code)
+	}
+	for _, r := range WeatherCodes.WMO.Ranges {
+		if code >= r.Min && code <= r.Max {
+			return r.Condition
+		}
+	}
+	return "Unknown"
+}
+
+// mapTomorrowCode converts Tomorrow.io codes to readable conditions.
+func mapTomorrowCode(code int) string {
+	if len(WeatherCodes.TomorrowIO) == 0 {
+		return fmt.Sprintf("Tomorrow.io %d", code)
+	}
+	if condition := WeatherCodes.TomorrowIO[fmt.Sprintf("%d", code)]; condition != "" {
+		return condition
+	}
+	return "Unknown"
+}
+
+// conditionOrder is the keyword matching precedence of NormalizeCondition, most specific first.
+var conditionOrder = []string{"Partly Cloudy", "Clear", "Cloudy", "Freezing Rain", "Hail", "Rainy", "Snowy", "Foggy", "Haze", "Stormy", "Windy"}
+
+// NormalizeCondition converts conditions to standard categories.
+// Checks more specific patterns first (e.g., "Partly Cloudy" before "Cloudy", "Freezing Rain" before "Rainy").
+func NormalizeCondition(c string) string {
+	lower := strings.ToLower(c)
+	for _, normalized := range conditionOrder {
+		if info, exists := WeatherCodes.Conditions[normalized]; exists {
+			for _, keyword := range info.Keywords {
+				if strings.Contains(lower, keyword) {
+					return normalized
+				}
+			}
+		}
+	}
+	return c
+}
+
+// GetConditionEmoji maps conditions to emoji. Returns thermometer if no match.
+// It goes through NormalizeCondition so overlapping keywords ("partly cloudy" vs "cloud")
+// resolve the same way as the consensus; categories only known to a custom codes file
+// still match by keyword, checked in name order to stay deterministic.
+func GetConditionEmoji(c string) string {
+	if info, ok := WeatherCodes.Conditions[NormalizeCondition(c)]; ok {
+		return info.Emoji
+	}
+	lower := strings.ToLower(c)
+	names := make([]string, 0, len(WeatherCodes.Conditions))
+	for name := range WeatherCodes.Conditions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		info := WeatherCodes.Conditions[name]
+		for _, keyword := range info.Keywords {
+			if strings.Contains(lower, keyword) {
+				return info.Emoji
+			}
+		}
+	}
+	return "🌡️"
+}
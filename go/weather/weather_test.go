@@ -0,0 +1,1635 @@
+package weather
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	if err := LoadWeatherCodes(""); err != nil {
+		panic(err)
+	}
+}
+
+func TestWeatherCodesFile(t *testing.T) {
+	t.Run("embedded copy matches shared file", func(t *testing.T) {
+		shared, err := os.ReadFile(filepath.Join("..", "..", "weather_codes.json"))
+		if err != nil {
+			t.Skipf("shared weather_codes.json not available: %v", err)
+		}
+		if !bytes.Equal(shared, embeddedWeatherCodes) {
+			t.Error("go/weather/weather_codes.json is out of date, run `go generate`")
+		}
+	})
+
+	t.Run("works from any directory", func(t *testing.T) {
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+
+		data, err := readWeatherCodes("")
+		if err != nil {
+			t.Fatalf("readWeatherCodes failed: %v", err)
+		}
+		var cfg WeatherCodeConfig
+		if err := json.Unmarshal(data, &cfg); err != nil || len(cfg.WMO.Ranges) == 0 {
+			t.Errorf("embedded codes unusable: %v", err)
+		}
+	})
+
+	t.Run("explicit path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "codes.json")
+		if err := os.WriteFile(path, []byte(`{"wmo":{"ranges":[]}}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := readWeatherCodes(path); err != nil || !bytes.Contains(data, []byte("wmo")) {
+			t.Errorf("readWeatherCodes(%q) = %q, %v", path, data, err)
+		}
+		if _, err := readWeatherCodes(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("expected error for missing explicit path")
+		}
+	})
+}
+
+// TestWithoutWeatherCodes simulates a codes file that failed to load: readings stay valid
+// and numeric conditions fall back to the raw code.
+func TestWithoutWeatherCodes(t *testing.T) {
+	orig := WeatherCodes
+	WeatherCodes = WeatherCodeConfig{}
+	t.Cleanup(func() { WeatherCodes = orig })
+
+	got, _ := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{}, `{"current":{"temperature_2m":14.2,"relative_humidity_2m":71,"weather_code":61}}`)
+	if got.Error != nil || got.Temperature != 14.2 || got.Humidity == nil || *got.Humidity != 71 {
+		t.Fatalf("reading = %+v, want 14.2°C and 71%% without error", got)
+	}
+	if got.Condition != "WMO 61" {
+		t.Errorf("condition = %q, want the raw code", got.Condition)
+	}
+	if c := mapTomorrowCode(1001); c != "Tomorrow.io 1001" {
+		t.Errorf("mapTomorrowCode = %q, want the raw code", c)
+	}
+	if res := Aggregate([]WeatherData{got}); res.Valid != 1 || res.Consensus != "WMO 61" {
+		t.Errorf("aggregate = %d valid, %q; want 1, \"WMO 61\"", res.Valid, res.Consensus)
+	}
+	if e := GetConditionEmoji(got.Condition); e != "🌡️" {
+		t.Errorf("emoji = %q, want the fallback", e)
+	}
+}
+
+func TestNormalizeSourceName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Open-Meteo", "openmeteo"},
+		{"Pirate Weather", "pirateweather"},
+		{"WeatherAPI.com", "weatherapicom"},
+		{"TOMORROW.IO", "tomorrowio"},
+		{" open_meteo ", "openmeteo"},
+		{"Open-Meteo/AQ", "openmeteoaq"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeSourceName(tt.input); got != tt.expected {
+			t.Errorf("NormalizeSourceName(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+func TestAggregateWeather(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []WeatherData
+		wantValid int
+		wantTemp  float64
+		wantHum   float64
+		wantCond  string
+	}{
+		{
+			"all valid",
+			[]WeatherData{
+				{Source: "A", Temperature: 10, Humidity: floatPtr(50), Condition: "Cloudy"},
+				{Source: "B", Temperature: 20, Humidity: floatPtr(70), Condition: "Cloudy"},
+			},
+			2, 15.0, 60.0, "Cloudy",
+		},
+		{
+			"mixed with errors",
+			[]WeatherData{
+				{Source: "A", Temperature: 20, Humidity: floatPtr(50), Condition: "Clear"},
+				{Source: "B", Error: &testError{}},
+			},
+			1, 20.0, 50.0, "Clear",
+		},
+		{
+			"missing humidity",
+			[]WeatherData{
+				{Source: "A", Temperature: 15, Humidity: floatPtr(60), Condition: "Rainy"},
+				{Source: "B", Temperature: 15, Humidity: nil, Condition: "Rainy"},
+			},
+			2, 15.0, 60.0, "Rainy",
+		},
+		{
+			"all errors",
+			[]WeatherData{
+				{Source: "A", Error: &testError{}},
+				{Source: "B", Error: &testError{}},
+			},
+			0, 0.0, 0.0, "No valid data",
+		},
+		{
+			"empty",
+			[]WeatherData{},
+			0, 0.0, 0.0, "No data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Aggregate(tt.data)
+
+			if res.Valid != tt.wantValid {
+				t.Errorf("valid = %d, want %d", res.Valid, tt.wantValid)
+			}
+			if res.Total != len(tt.data) {
+				t.Errorf("total = %d, want %d", res.Total, len(tt.data))
+			}
+			if res.Valid > 0 && res.AvgTemp != tt.wantTemp {
+				t.Errorf("temp = %.1f, want %.1f", res.AvgTemp, tt.wantTemp)
+			}
+			if res.Valid > 0 && res.AvgHumidity != tt.wantHum {
+				t.Errorf("hum = %.1f, want %.1f", res.AvgHumidity, tt.wantHum)
+			}
+			if res.Consensus != tt.wantCond {
+				t.Errorf("cond = %q, want %q", res.Consensus, tt.wantCond)
+			}
+
+			// The legacy four-value wrapper must agree with the struct
+			avgTemp, avgHum, cond, valid := AggregateWeather(tt.data)
+			if avgTemp != res.AvgTemp || avgHum != res.AvgHumidity || cond != res.Consensus || valid != res.Valid {
+				t.Errorf("AggregateWeather = (%.1f, %.1f, %q, %d), differs from Aggregate", avgTemp, avgHum, cond, valid)
+			}
+		})
+	}
+}
+
+func TestAggregateWindPressure(t *testing.T) {
+	res := Aggregate([]WeatherData{
+		{Source: "A", Temperature: 10, WindSpeed: floatPtr(2), Pressure: floatPtr(1010)},
+		{Source: "B", Temperature: 10, WindSpeed: floatPtr(4)},
+		{Source: "C", Temperature: 10, Pressure: floatPtr(1020)},
+		{Source: "D", Temperature: 10},
+		{Source: "E", WindSpeed: floatPtr(50), Error: &testError{}},
+	})
+	if res.WindCount != 2 || res.AvgWindSpeed != 3 {
+		t.Errorf("wind = %.1f over %d, want 3.0 over 2", res.AvgWindSpeed, res.WindCount)
+	}
+	if res.PressureCount != 2 || res.AvgPressure != 1015 {
+		t.Errorf("pressure = %.1f over %d, want 1015 over 2", res.AvgPressure, res.PressureCount)
+	}
+}
+
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		temp, hum, want float64
+	}{
+		{20, 50, 9.26},
+		{25, 60, 16.69},
+		{0, 100, 0},
+		{30, 30, 10.52},
+		{-10, 80, -12.84},
+	}
+	for _, tt := range tests {
+		got, ok := dewPoint(tt.temp, tt.hum)
+		if !ok || math.Abs(got-tt.want) > 0.05 {
+			t.Errorf("dewPoint(%.0f°C, %.0f%%) = %.2f, %v; want %.2f", tt.temp, tt.hum, got, ok, tt.want)
+		}
+	}
+	for _, hum := range []float64{0, -5, 101} {
+		if _, ok := dewPoint(20, hum); ok {
+			t.Errorf("dewPoint(20, %.0f) accepted invalid humidity", hum)
+		}
+	}
+
+	// computed from humidity unless the source reports its own value
+	computed, _ := fetchRecorded(t, &OpenMeteoSource{}, ForecastSpec{}, `{"current":{"temperature_2m":20,"relative_humidity_2m":50,"weather_code":0}}`)
+	if computed.DewPoint == nil || math.Abs(*computed.DewPoint-9.26) > 0.05 {
+		t.Errorf("Open-Meteo dew point = %v, want ~9.26", computed.DewPoint)
+	}
+	native, _ := fetchRecorded(t, &PirateWeatherSource{key: "k"}, ForecastSpec{}, `{"currently":{"temperature":20,"humidity":0.5,"dewPoint":9.8,"summary":"Clear"}}`)
+	if native.DewPoint == nil || *native.DewPoint != 9.8 {
+		t.Errorf("Pirate-Weather dew point = %v, want the native 9.8", native.DewPoint)
+	}
+	dry, _ := fetchRecorded(t, &MeteosourceSource{key: "k"}, ForecastSpec{}, `{"current":{"temperature":12.5,"summary":"Overcast"}}`)
+	if dry.DewPoint != nil {
+		t.Errorf("dew point without humidity = %v, want nil", *dry.DewPoint)
+	}
+
+	res := Aggregate([]WeatherData{
+		{Source: "A", Temperature: 20, DewPoint: floatPtr(9)},
+		{Source: "B", Temperature: 20, DewPoint: floatPtr(10)},
+		{Source: "C", Temperature: 20},
+	})
+	if res.DewPointCount != 2 || res.AvgDewPoint != 9.5 {
+		t.Errorf("aggregated dew point = %.1f over %d, want 9.5 over 2", res.AvgDewPoint, res.DewPointCount)
+	}
+}
+
+func TestAggregateFeelsLike(t *testing.T) {
+	res := Aggregate([]WeatherData{
+		{Source: "A", Temperature: 10, FeelsLike: floatPtr(8)},
+		{Source: "B", Temperature: 12, FeelsLike: floatPtr(11)},
+		{Source: "C", Temperature: 11},
+		{Source: "D", FeelsLike: floatPtr(-20), Error: &testError{}},
+	})
+	if res.FeelsLikeCount != 2 || res.AvgFeelsLike != 9.5 {
+		t.Errorf("feels like = %.1f over %d, want 9.5 over 2", res.AvgFeelsLike, res.FeelsLikeCount)
+	}
+	if res := Aggregate([]WeatherData{{Source: "A", Temperature: 10}}); res.FeelsLikeCount != 0 || res.AvgFeelsLike != 0 {
+		t.Errorf("without feels like = %.1f over %d, want 0 over 0", res.AvgFeelsLike, res.FeelsLikeCount)
+	}
+}
+
+func TestAggregateSpread(t *testing.T) {
+	res := Aggregate([]WeatherData{
+		{Source: "A", Temperature: 2},
+		{Source: "B", Temperature: 4},
+		{Source: "C", Temperature: 4},
+		{Source: "D", Temperature: 4},
+		{Source: "E", Temperature: 5},
+		{Source: "F", Temperature: 5},
+		{Source: "G", Temperature: 7},
+		{Source: "H", Temperature: 9},
+		{Source: "I", Temperature: -40, Error: &testError{}},
+	})
+	if res.MinTemp != 2 || res.MaxTemp != 9 || res.StdDevTemp != 2 {
+		t.Errorf("min/max/σ = %.1f/%.1f/%.3f, want 2/9/2", res.MinTemp, res.MaxTemp, res.StdDevTemp)
+	}
+	if res.LowAgreement() {
+		t.Error("σ of exactly the threshold must not count as low agreement")
+	}
+
+	res = Aggregate([]WeatherData{{Source: "A", Temperature: 10}, {Source: "B", Temperature: 16}})
+	if res.StdDevTemp != 3 || !res.LowAgreement() {
+		t.Errorf("σ = %.1f, low agreement = %v; want 3, true", res.StdDevTemp, res.LowAgreement())
+	}
+	if one := Aggregate([]WeatherData{{Source: "A", Temperature: 10}}); one.StdDevTemp != 0 || one.LowAgreement() {
+		t.Errorf("single reading: σ = %.1f, low agreement = %v", one.StdDevTemp, one.LowAgreement())
+	}
+}
+
+func TestNormalizeCondition(t *testing.T) {
+	tests := map[string]string{
+		"Partly cloudy":          "Partly Cloudy",
+		"Overcast":               "Cloudy",
+		"Light rain":             "Rainy",
+		"Freezing drizzle":       "Freezing Rain",
+		"Light freezing rain":    "Freezing Rain",
+		"Hail":                   "Hail",
+		"Blowing dust":           "Haze",
+		"Smoke":                  "Haze",
+		"Windy":                  "Windy",
+		"Thunderstorm":           "Stormy",
+		"Something else":         "Something else",
+		"Moderate or heavy hail": "Hail",
+	}
+	for in, want := range tests {
+		if got := NormalizeCondition(in); got != want {
+			t.Errorf("NormalizeCondition(%q) = %q, want %q", in, got, want)
+		}
+	}
+	for code, want := range map[int]string{55: "Rainy", 56: "Freezing Rain", 61: "Rainy", 67: "Freezing Rain", 95: "Stormy", 99: "Hail"} {
+		if got := mapWMOCode(code); got != want {
+			t.Errorf("mapWMOCode(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+// TestWMOCodeRanges checks the shipped weather_codes.json: the WMO ranges must cover the
+// whole code space 0–99 exactly once with conditions NormalizeCondition knows. Codes 4–44
+// aren't sent by Open-Meteo (they are WMO's "no precipitation" observations like haze or
+// dust) and are mapped to Cloudy.
+func TestWMOCodeRanges(t *testing.T) {
+	var codes WeatherCodeConfig
+	if err := json.Unmarshal(embeddedWeatherCodes, &codes); err != nil {
+		t.Fatal(err)
+	}
+	ranges := slices.Clone(codes.WMO.Ranges)
+	slices.SortFunc(ranges, func(a, b WeatherCodeRange) int { return cmp.Compare(a.Min, b.Min) })
+	next := 0
+	for _, r := range ranges {
+		switch {
+		case r.Min > r.Max:
+			t.Errorf("range %d–%d is reversed", r.Min, r.Max)
+		case r.Min < next:
+			t.Errorf("range %d–%d (%s) overlaps the previous one ending at %d", r.Min, r.Max, r.Condition, next-1)
+		case r.Min > next:
+			t.Errorf("codes %d–%d are not mapped", next, r.Min-1)
+		}
+		if !slices.Contains(conditionOrder, r.Condition) {
+			t.Errorf("range %d–%d maps to %q, which is not a normalized condition", r.Min, r.Max, r.Condition)
+		}
+		next = max(next, r.Max+1)
+	}
+	if next != 100 {
+		t.Errorf("ranges end at %d, want 99", next-1)
+	}
+	for code := 0; code <= 99; code++ {
+		if got := mapWMOCode(code); got == "Unknown" {
+			t.Errorf("mapWMOCode(%d) = Unknown", code)
+		}
+	}
+	if got := mapWMOCode(100); got != "Unknown" {
+		t.Errorf("mapWMOCode(100) = %q, want Unknown", got)
+	}
+}
+
+// TestWMOCodeBoundaries pins the edges of the ranges in weather_codes.json, so a shifted
+// bound (e.g. fog swallowing the unused codes below 45) shows up as a condition change.
+func TestWMOCodeBoundaries(t *testing.T) {
+	tests := map[int]string{
+		0:  "Clear",
+		1:  "Partly Cloudy",
+		3:  "Partly Cloudy", // overcast; NormalizeCondition has no finer level
+		44: "Cloudy",
+		45: "Foggy",
+		48: "Foggy", // depositing rime fog
+		49: "Rainy",
+		51: "Rainy", // light drizzle
+		57: "Freezing Rain",
+		67: "Freezing Rain", // heavy freezing rain
+		68: "Snowy",
+		71: "Snowy",
+		82: "Rainy",
+		85: "Snowy",
+		86: "Snowy", // heavy snow showers
+		95: "Stormy",
+		96: "Hail",
+		97: "Stormy", // heavy thunderstorm without hail
+		98: "Stormy", // thunderstorm with duststorm
+		99: "Hail",
+	}
+	for code, want := range tests {
+		if got := mapWMOCode(code); got != want {
+			t.Errorf("mapWMOCode(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestGetConditionEmoji(t *testing.T) {
+	tests := map[string]string{
+		"Partly cloudy":    "Partly Cloudy",
+		"Mostly cloudy":    "Cloudy",
+		"Freezing drizzle": "Freezing Rain",
+		"Light rain":       "Rainy",
+	}
+	for in, category := range tests {
+		want := WeatherCodes.Conditions[category].Emoji
+		// The conditions are a map; repeat so an order-dependent match would show up
+		for i := 0; i < 50; i++ {
+			if got := GetConditionEmoji(in); got != want {
+				t.Fatalf("GetConditionEmoji(%q) = %q, want %q (%s)", in, got, want, category)
+			}
+		}
+	}
+	if got := GetConditionEmoji("Something else"); got != "🌡️" {
+		t.Errorf("GetConditionEmoji(unknown) = %q, want thermometer", got)
+	}
+}
+
+func TestConsensusTieBreak(t *testing.T) {
+	tests := []struct {
+		votes map[string]int
+		want  string
+	}{
+		{map[string]int{"Clear": 2, "Rainy": 2}, "Rainy"},
+		{map[string]int{"Cloudy": 1, "Partly Cloudy": 1, "Clear": 1}, "Cloudy"},
+		{map[string]int{"Stormy": 1, "Snowy": 1}, "Stormy"},
+		{map[string]int{"Hazy": 1, "Clear": 1}, "Clear"},
+		{map[string]int{"Sleet": 1, "Hazy": 1}, "Hazy"},
+		{map[string]int{"Clear": 3, "Stormy": 1}, "Clear"},
+		{map[string]int{}, "Unknown"},
+	}
+	for _, tt := range tests {
+		// Map iteration order is randomized, so repeat to catch order dependence
+		for i := 0; i < 50; i++ {
+			if got := consensusCondition(tt.votes); got != tt.want {
+				t.Fatalf("consensusCondition(%v) = %q, want %q", tt.votes, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestAggregateVotes(t *testing.T) {
+	res := Aggregate([]WeatherData{
+		{Source: "A", Temperature: 10, Condition: "Light rain"},
+		{Source: "B", Temperature: 11, Condition: "Rainy"},
+		{Source: "C", Temperature: 12, Condition: "Overcast"},
+		{Source: "D", Error: &testError{}},
+	})
+	if res.Votes["Rainy"] != 2 || res.Votes["Cloudy"] != 1 || len(res.Votes) != 2 {
+		t.Errorf("votes = %v, want Rainy:2 Cloudy:1", res.Votes)
+	}
+	if res.Valid != 3 || res.Total != 4 || res.HumidityCount != 0 {
+		t.Errorf("valid/total/humidity = %d/%d/%d, want 3/4/0", res.Valid, res.Total, res.HumidityCount)
+	}
+}
+
+func TestAggregateAgreement(t *testing.T) {
+	data := []WeatherData{
+		{Source: "A", Condition: "Light rain"},
+		{Source: "B", Condition: "Rainy"},
+		{Source: "C", Condition: "Drizzle"},
+		{Source: "D", Condition: "Heavy rain"},
+		{Source: "E", Condition: "Overcast"},
+		{Source: "F", Condition: "Sunny"},
+		{Source: "G", Error: &testError{}},
+		{Source: "Air", AirQuality: true},
+	}
+	res := Aggregate(data)
+	if res.Consensus != "Rainy" || res.ConsensusVotes != 4 || res.Valid != 6 {
+		t.Fatalf("consensus = %s (%d/%d), want Rainy (4/6)", res.Consensus, res.ConsensusVotes, res.Valid)
+	}
+	if got := res.Agreement(); math.Abs(got-4.0/6) > 1e-9 {
+		t.Errorf("agreement = %v, want 4/6", got)
+	}
+	if got := Aggregate(data[6:]).Agreement(); got != 0 {
+		t.Errorf("agreement without valid data = %v, want 0", got)
+	}
+}
+
+func TestAggregateMedian(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []WeatherData
+		wantValid int
+		wantTemp  float64
+		wantHum   float64
+		wantCond  string
+	}{
+		{
+			"odd count ignores outlier",
+			[]WeatherData{
+				{Source: "A", Temperature: 14, Humidity: floatPtr(60), Condition: "Rainy"},
+				{Source: "B", Temperature: 15, Humidity: floatPtr(65), Condition: "Light rain"},
+				{Source: "C", Temperature: 45, Humidity: floatPtr(5), Condition: "Clear"},
+			},
+			3, 15.0, 60.0, "Rainy",
+		},
+		{
+			"even count averages middle values",
+			[]WeatherData{
+				{Source: "A", Temperature: 10, Humidity: floatPtr(40), Condition: "Cloudy"},
+				{Source: "B", Temperature: 30, Humidity: floatPtr(80), Condition: "Cloudy"},
+				{Source: "C", Temperature: 12, Humidity: floatPtr(50), Condition: "Cloudy"},
+				{Source: "D", Temperature: 16, Humidity: nil, Condition: "Overcast"},
+			},
+			4, 14.0, 50.0, "Cloudy",
+		},
+		{
+			"errors excluded",
+			[]WeatherData{
+				{Source: "A", Temperature: 20, Condition: "Clear"},
+				{Source: "B", Error: &testError{}},
+			},
+			1, 20.0, 0.0, "Clear",
+		},
+		{
+			"all errors",
+			[]WeatherData{{Source: "A", Error: &testError{}}},
+			0, 0.0, 0.0, "No valid data",
+		},
+		{"empty", []WeatherData{}, 0, 0.0, 0.0, "No data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Aggregate(tt.data)
+			temp, hum, cond, valid := res.MedianTemp, res.MedianHumidity, res.Consensus, res.Valid
+			if valid != tt.wantValid || temp != tt.wantTemp || hum != tt.wantHum || cond != tt.wantCond {
+				t.Errorf("got (%.1f, %.1f, %q, %d), want (%.1f, %.1f, %q, %d)",
+					temp, hum, cond, valid, tt.wantTemp, tt.wantHum, tt.wantCond, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestRejectOutliers(t *testing.T) {
+	data := []WeatherData{
+		{Source: "A", Temperature: 14.2, Humidity: floatPtr(60), Condition: "Cloudy"},
+		{Source: "B", Temperature: 15.1, Humidity: floatPtr(62), Condition: "Cloudy"},
+		{Source: "C", Temperature: 14.8, Humidity: floatPtr(58), Condition: "Cloudy"},
+		{Source: "D", Temperature: 15.9, Humidity: floatPtr(64), Condition: "Cloudy"},
+		{Source: "Ocean", Temperature: 27.0, Humidity: floatPtr(90), Condition: "Clear"},
+		{Source: "Broken", Error: &testError{}},
+	}
+
+	out, rejected := RejectOutliers(data, 3)
+	if rejected != 1 {
+		t.Fatalf("rejected = %d, want 1", rejected)
+	}
+	if !errors.Is(out[4].Error, ErrOutlier) {
+		t.Errorf("outlier error = %v, want ErrOutlier", out[4].Error)
+	}
+	if data[4].Error != nil {
+		t.Error("input slice was modified")
+	}
+
+	res := Aggregate(out)
+	if res.Valid != 4 || math.Abs(res.AvgTemp-15.0) > 1e-9 || res.Consensus != "Cloudy" {
+		t.Errorf("aggregate = (%.2f, %q, %d), want (15.00, \"Cloudy\", 4)", res.AvgTemp, res.Consensus, res.Valid)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		if _, rejected := RejectOutliers(data, 0); rejected != 0 {
+			t.Errorf("rejected = %d, want 0", rejected)
+		}
+	})
+
+	t.Run("close readings kept", func(t *testing.T) {
+		near := []WeatherData{{Temperature: 15}, {Temperature: 15}, {Temperature: 15}, {Temperature: 15.4}}
+		if _, rejected := RejectOutliers(near, 2); rejected != 0 {
+			t.Errorf("rejected = %d, want 0", rejected)
+		}
+	})
+
+	t.Run("too few readings", func(t *testing.T) {
+		if _, rejected := RejectOutliers(data[3:5], 1); rejected != 0 {
+			t.Errorf("rejected = %d, want 0", rejected)
+		}
+	})
+}
+
+func TestRejectStale(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	fresh, cached := now.Add(-10*time.Minute), now.Add(-3*time.Hour)
+	data := []WeatherData{
+		{Source: "A", Temperature: 14, Condition: "Cloudy", ObservedAt: &fresh},
+		{Source: "B", Temperature: 15, Condition: "Cloudy"}, // no observation time
+		{Source: "Cached", Temperature: 22, Condition: "Clear", ObservedAt: &cached},
+		{Source: "Broken", Error: &testError{}, ObservedAt: &cached},
+	}
+
+	out, excluded := RejectStale(data, 2*time.Hour, now)
+	if excluded != 1 || !errors.Is(out[2].Error, ErrStale) {
+		t.Fatalf("excluded = %d, Cached error = %v; want 1, ErrStale", excluded, out[2].Error)
+	}
+	if data[2].Error != nil {
+		t.Error("input slice was modified")
+	}
+	if res := Aggregate(out); res.Valid != 2 || res.AvgTemp != 14.5 || res.Consensus != "Cloudy" {
+		t.Errorf("aggregate = (%.2f, %q, %d), want (14.50, \"Cloudy\", 2)", res.AvgTemp, res.Consensus, res.Valid)
+	}
+
+	if _, excluded := RejectStale(data, 0, now); excluded != 0 {
+		t.Errorf("disabled: excluded = %d, want 0", excluded)
+	}
+}
+
+type mockSource struct {
+	name   string
+	temp   float64
+	hum    float64
+	cond   string
+	hasErr bool
+}
+
+func (m *mockSource) Name() string { return m.name }
+
+func (m *mockSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	if m.hasErr {
+		return WeatherData{Source: m.name, Error: &testError{}}
+	}
+	return WeatherData{
+		Source:      m.name,
+		Temperature: m.temp,
+		Humidity:    floatPtr(m.hum),
+		Condition:   m.cond,
+	}
+}
+
+func TestValidateReading(t *testing.T) {
+	tests := []struct {
+		name string
+		d    WeatherData
+		ok   bool
+	}{
+		{"typical", WeatherData{Temperature: 14.2, Humidity: floatPtr(71)}, true},
+		{"limits", WeatherData{Temperature: -90, Humidity: floatPtr(100)}, true},
+		{"no humidity", WeatherData{Temperature: 60}, true},
+		{"dry", WeatherData{Temperature: 45, Humidity: floatPtr(0)}, true},
+		{"too hot", WeatherData{Temperature: 60.5, Humidity: floatPtr(10)}, false},
+		{"too cold", WeatherData{Temperature: -120}, false},
+		{"Kelvin", WeatherData{Temperature: 287.4}, false},
+		{"NaN", WeatherData{Temperature: math.NaN()}, false},
+		{"humidity above 100", WeatherData{Temperature: 12, Humidity: floatPtr(6500)}, false},
+		{"negative humidity", WeatherData{Temperature: 12, Humidity: floatPtr(-1)}, false},
+	}
+	for _, tt := range tests {
+		if err := validateReading(tt.d); (err == nil) != tt.ok || err != nil && !errors.Is(err, ErrImplausible) {
+			t.Errorf("%s: validateReading = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+
+	// the sources' readings are validated before aggregation
+	sources := []WeatherSource{
+		&mockSource{name: "Good", temp: 15, hum: 60, cond: "Clear"},
+		&mockSource{name: "Glitch", temp: 15, hum: 150, cond: "Clear"},
+		&mockSource{name: "Hot", temp: 99, hum: 10, cond: "Clear"},
+	}
+	data := fetchWeatherConcurrently(context.Background(), "TestCity", sources, Options{})
+	for _, d := range data {
+		if wantErr := d.Source != "Good"; errors.Is(d.Error, ErrImplausible) != wantErr {
+			t.Errorf("%s: error = %v, want ErrImplausible = %v", d.Source, d.Error, wantErr)
+		}
+	}
+	if res := Aggregate(data); res.Valid != 1 || res.AvgTemp != 15 || res.AvgHumidity != 60 {
+		t.Errorf("aggregate = %+v, want only the plausible reading", res)
+	}
+}
+
+type testError struct{}
+
+func (e *testError) Error() string { return "test error" }
+
+func TestFetchWeatherBehavior(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sources := []WeatherSource{
+		&mockSource{name: "S1", temp: 15, hum: 60, cond: "Clear", hasErr: false},
+		&mockSource{name: "S2", temp: 16, hum: 65, cond: "Cloudy", hasErr: false},
+		&mockSource{name: "S3", temp: 0, hum: 0, cond: "", hasErr: true},
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		results := fetchWeatherConcurrently(ctx, "TestCity", sources, Options{})
+		if len(results) != 3 {
+			t.Errorf("got %d results, want 3", len(results))
+		}
+		validCount := 0
+		for _, r := range results {
+			if r.Error == nil {
+				validCount++
+			}
+		}
+		if validCount != 2 {
+			t.Errorf("valid = %d, want 2", validCount)
+		}
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		results := fetchSequential(ctx, "TestCity", sources, Options{})
+		if len(results) != 3 {
+			t.Errorf("got %d results, want 3", len(results))
+		}
+		if results[0].Source != "S1" || results[1].Source != "S2" {
+			t.Errorf("order lost")
+		}
+	})
+}
+
+// mockSlowSource returns after delay unless its context ends first.
+type mockSlowSource struct {
+	name  string
+	delay time.Duration
+}
+
+func (m *mockSlowSource) Name() string { return m.name }
+
+func (m *mockSlowSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	select {
+	case <-time.After(m.delay):
+		return WeatherData{Source: m.name, Temperature: 10, Condition: "Clear"}
+	case <-ctx.Done():
+		return WeatherData{Source: m.name, Error: ctx.Err()}
+	}
+}
+
+func TestSourceTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sources := []WeatherSource{
+		&mockSlowSource{name: "Slow", delay: time.Second},
+		&mockSlowSource{name: "Fast", delay: time.Millisecond},
+	}
+
+	check := func(t *testing.T, results []WeatherData) {
+		for _, r := range results {
+			switch r.Source {
+			case "Slow":
+				if !errors.Is(r.Error, context.DeadlineExceeded) {
+					t.Errorf("slow source error = %v, want deadline exceeded", r.Error)
+				}
+			case "Fast":
+				if r.Error != nil {
+					t.Errorf("fast source error = %v, want nil", r.Error)
+				}
+			}
+		}
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		check(t, fetchWeatherConcurrently(ctx, "TestCity", sources, Options{SourceTimeout: 50 * time.Millisecond}))
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		results := fetchSequential(ctx, "TestCity", sources, Options{SourceTimeout: 50 * time.Millisecond})
+		check(t, results)
+		if results[0].Duration > 500*time.Millisecond {
+			t.Errorf("slow source took %v, was not cut off", results[0].Duration)
+		}
+	})
+
+	t.Run("parent cancellation", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		cancelParent()
+		results := fetchSequential(parent, "TestCity", sources[:1], Options{SourceTimeout: time.Minute})
+		if !errors.Is(results[0].Error, context.Canceled) {
+			t.Errorf("error = %v, want context canceled", results[0].Error)
+		}
+	})
+}
+
+func TestContextDeadlineWithoutClientTimeout(t *testing.T) {
+	if DefaultClient.Timeout != 0 {
+		t.Fatalf("DefaultClient.Timeout = %v, deadlines should come from the context", DefaultClient.Timeout)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("stall_body") {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"current":`)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	for _, stallBody := range []bool{false, true} {
+		base := srv.URL
+		if stallBody {
+			base += "/?stall_body=1&"
+		}
+		agg := NewAggregator([]WeatherSource{&OpenMeteoSource{baseURL: base}}, Options{Location: &[2]float64{52.52, 13.41}})
+		agg.Client = &http.Client{Transport: rewriteTransport{target}}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		data, err := agg.Fetch(ctx, "Berlin")
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(data[0].Error, context.DeadlineExceeded) {
+			t.Errorf("stall body %v: error = %v, want deadline exceeded", stallBody, data[0].Error)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("stall body %v: took %v, the context deadline was not applied", stallBody, elapsed)
+		}
+	}
+}
+
+// withRetryDelay shortens the backoff for the duration of a test.
+func withRetryDelay(t *testing.T, d time.Duration) {
+	orig := retryBaseDelay
+	retryBaseDelay = d
+	t.Cleanup(func() { retryBaseDelay = orig })
+}
+
+// withGeocoders replaces the geocoder chain for the duration of the test.
+func withGeocoders(t *testing.T, gs ...geocoder) {
+	orig := geocoders
+	geocoders = gs
+	t.Cleanup(func() { geocoders = orig })
+}
+
+func TestDoGetRetry(t *testing.T) {
+	withRetryDelay(t, 10*time.Millisecond)
+
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"succeeds after two 503s", 2, http.StatusServiceUnavailable, false, 3},
+		{"succeeds after 429", 1, http.StatusTooManyRequests, false, 2},
+		{"gives up after retries", 5, http.StatusBadGateway, true, 3},
+		{"no retry on 404", 5, http.StatusNotFound, true, 1},
+		{"no retry on 401", 5, http.StatusUnauthorized, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= int32(tt.failures) {
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprint(w, `{}`)
+			}))
+			defer srv.Close()
+
+			resp, err := doGet(context.Background(), srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("context cancels backoff", func(t *testing.T) {
+		withRetryDelay(t, time.Minute)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := doGet(ctx, srv.URL); err == nil {
+			t.Fatal("expected error")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("doGet took %v, backoff ignored context", elapsed)
+		}
+	})
+}
+
+func TestDoGetTruncated(t *testing.T) {
+	withRetryDelay(t, time.Millisecond)
+	const full = `{"current":{"temperature_2m":12.5}}`
+	tests := []struct {
+		name      string
+		cutOffs   int32 // responses cut off before the full one
+		short     bool  // cut off by closing before Content-Length, else a complete but partial document
+		retries   int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"retried once", 1, false, 2, false, 2},
+		{"dropped connection retried", 1, true, 2, false, 2},
+		{"not retried twice", 5, false, 5, true, 2},
+		{"retries disabled", 1, true, 0, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) > tt.cutOffs {
+					fmt.Fprint(w, full)
+					return
+				}
+				if tt.short {
+					w.Header().Set("Content-Length", strconv.Itoa(len(full)))
+				}
+				fmt.Fprint(w, full[:12])
+			}))
+			defer srv.Close()
+
+			agg := NewAggregator(nil, Options{Retries: tt.retries})
+			resp, err := doGet(agg.withConfig(context.Background()), srv.URL)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTruncated) || !strings.Contains(err.Error(), "127.0.0.1") || !strings.Contains(err.Error(), "after 12 bytes") {
+					t.Errorf("error = %v, want ErrTruncated naming the host and size", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(body) != full {
+					t.Errorf("body = %q, want %q", body, full)
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestErrorSentinels(t *testing.T) {
+	withRetryDelay(t, time.Millisecond)
+	sentinels := []error{ErrAuth, ErrRateLimited, ErrTimeout, ErrCityNotFound}
+	tests := []struct {
+		status int
+		want   error // nil: none of the sentinels
+	}{
+		{http.StatusUnauthorized, ErrAuth},
+		{http.StatusForbidden, ErrAuth},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusNotFound, nil},
+		{http.StatusBadRequest, nil},
+		{http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		target, _ := url.Parse(srv.URL)
+		agg := NewAggregator([]WeatherSource{&OpenWeatherSource{key: "k"}}, Options{Location: &[2]float64{52.52, 13.41}})
+		agg.Client = &http.Client{Transport: rewriteTransport{target}}
+		data, _ := agg.Fetch(context.Background(), "Berlin")
+		srv.Close()
+		for _, s := range sentinels {
+			if got := errors.Is(data[0].Error, s); got != (s == tt.want) {
+				t.Errorf("HTTP %d: errors.Is(%v, %v) = %v", tt.status, data[0].Error, s, got)
+			}
+		}
+	}
+
+	// AccuWeather's quota explanation keeps the status sentinel
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	target, _ := url.Parse(srv.URL)
+	agg := NewAggregator([]WeatherSource{&AccuWeatherSource{key: "k"}}, Options{Location: &[2]float64{52.52, 13.41}})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	data, _ := agg.Fetch(context.Background(), "Berlin")
+	srv.Close()
+	if err := data[0].Error; !errors.Is(err, ErrRateLimited) || !errors.Is(err, errAccuWeatherLimit) {
+		t.Errorf("AccuWeather 429 error = %v, want ErrRateLimited and errAccuWeatherLimit", err)
+	}
+
+	// timeouts keep matching the context error as well
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+	target, _ = url.Parse(srv.URL)
+	agg = NewAggregator([]WeatherSource{&OpenWeatherSource{key: "k"}}, Options{Location: &[2]float64{52.52, 13.41}, SourceTimeout: 20 * time.Millisecond})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	data, _ = agg.Fetch(context.Background(), "Berlin")
+	if err := data[0].Error; !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrAuth) {
+		t.Errorf("timeout error = %v, want ErrTimeout and context.DeadlineExceeded", err)
+	}
+	client := &http.Client{Transport: rewriteTransport{target}, Timeout: 20 * time.Millisecond}
+	agg = NewAggregator([]WeatherSource{&OpenWeatherSource{key: "k"}}, Options{Location: &[2]float64{52.52, 13.41}})
+	agg.Client = client
+	if data, _ := agg.Fetch(context.Background(), "Berlin"); !errors.Is(data[0].Error, ErrTimeout) {
+		t.Errorf("client timeout error = %v, want ErrTimeout", data[0].Error)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"1", time.Second, true},
+		{" 30 ", 30 * time.Second, true},
+		{"-5", 0, false},
+		{"Sun, 04 Jan 2026 12:00:10 GMT", 10 * time.Second, true},
+		{"Sun, 04 Jan 2026 11:59:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.header, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDoGetRetryAfter(t *testing.T) {
+	withRetryDelay(t, time.Millisecond)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+
+	t.Run("waits for header delay", func(t *testing.T) {
+		start := time.Now()
+		resp, err := doGet(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond || elapsed > 3*time.Second {
+			t.Errorf("retry happened after %v, want about 1s", elapsed)
+		}
+	})
+
+	t.Run("delay beyond deadline fails fast", func(t *testing.T) {
+		calls.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if _, err := doGet(ctx, srv.URL); err == nil {
+			t.Fatal("expected error")
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("calls = %d, want 1", got)
+		}
+	})
+}
+
+// trackingSource wraps mockSlowSource and records how many fetches run at once.
+type trackingSource struct {
+	mockSlowSource
+	inFlight, peak *atomic.Int32
+}
+
+func (s *trackingSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		p := s.peak.Load()
+		if n <= p || s.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	return s.mockSlowSource.Fetch(ctx, city, coordsCache)
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, limit := range []int{1, 2, 0} {
+		var inFlight, peak atomic.Int32
+		sources := make([]WeatherSource, 6)
+		for i := range sources {
+			sources[i] = &trackingSource{
+				mockSlowSource: mockSlowSource{name: fmt.Sprintf("S%d", i), delay: 20 * time.Millisecond},
+				inFlight:       &inFlight,
+				peak:           &peak,
+			}
+		}
+
+		results := fetchWeatherConcurrently(ctx, "TestCity", sources, Options{MaxConcurrency: limit})
+		if len(results) != len(sources) {
+			t.Errorf("limit %d: got %d results, want %d", limit, len(results), len(sources))
+		}
+		if got := peak.Load(); limit > 0 && got > int32(limit) {
+			t.Errorf("limit %d: peak in-flight = %d", limit, got)
+		} else if limit == 0 && got < 2 {
+			t.Errorf("unlimited: peak in-flight = %d, want parallel fetches", got)
+		}
+	}
+}
+
+func TestGeocodeCity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("valid city", func(t *testing.T) {
+		lat, lon, err := geocodeCity(ctx, "Berlin")
+		if err != nil {
+			t.Fatalf("geocodeCity failed: %v", err)
+		}
+		if lat < 52.0 || lat > 53.0 || lon < 13.0 || lon > 14.0 {
+			t.Errorf("unexpected coordinates for Berlin: lat=%.2f, lon=%.2f", lat, lon)
+		}
+	})
+
+	t.Run("invalid city", func(t *testing.T) {
+		_, _, err := geocodeCity(ctx, "XyzInvalidCity12345")
+		if err == nil {
+			t.Error("expected error for invalid city, got nil")
+		}
+	})
+}
+
+func TestOpenWeatherSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/2.5/weather" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("q") != "São Paulo" || q.Get("units") != "metric" || q.Get("appid") != "test-key" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"weather":[{"id":500,"main":"Rain","description":"light rain"}],"main":{"temp":21.4,"humidity":83,"pressure":1009},"wind":{"speed":4.1}}`)
+	}))
+	defer srv.Close()
+
+	src := &OpenWeatherSource{key: "test-key", baseURL: srv.URL}
+	got := src.Fetch(context.Background(), "São Paulo", nil)
+	if got.Error != nil {
+		t.Fatalf("unexpected error: %v", got.Error)
+	}
+	if got.Source != "OpenWeatherMap" || got.Temperature != 21.4 || got.Condition != "light rain" {
+		t.Errorf("got %+v", got)
+	}
+	if got.Humidity == nil || *got.Humidity != 83 {
+		t.Errorf("humidity = %v, want 83", got.Humidity)
+	}
+	if got.RawCode == nil || *got.RawCode != 500 || got.RawCondition != "light rain" {
+		t.Errorf("raw = %v/%q, want 500/\"light rain\"", got.RawCode, got.RawCondition)
+	}
+	if got.WindSpeed == nil || *got.WindSpeed != 4.1 || got.Pressure == nil || *got.Pressure != 1009 {
+		t.Errorf("wind/pressure = %v/%v, want 4.1/1009", got.WindSpeed, got.Pressure)
+	}
+	if cond := Aggregate([]WeatherData{got}).Consensus; cond != "Rainy" {
+		t.Errorf("normalized condition = %q, want %q", cond, "Rainy")
+	}
+}
+
+// coordsSource records the coordinates a coordinate-based source would query.
+type coordsSource struct{ lat, lon float64 }
+
+func (c *coordsSource) Name() string { return "Coords" }
+func (c *coordsSource) Fetch(ctx context.Context, city string, coordsCache map[string][2]float64) WeatherData {
+	lat, lon, err := getCoordinates(ctx, city, coordsCache)
+	c.lat, c.lon = lat, lon
+	return WeatherData{Source: c.Name(), Error: err}
+}
+
+func TestFixedLocationSkipsGeocoding(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		fmt.Fprint(w, `{"weather":[{"id":800,"description":"clear sky"}],"main":{"temp":20}}`)
+	}))
+	defer srv.Close()
+
+	coords := &coordsSource{}
+	agg := NewAggregator([]WeatherSource{coords, &OpenWeatherSource{key: "k", baseURL: srv.URL}},
+		Options{Location: &[2]float64{39.8, -89.65}})
+	data, err := agg.Fetch(context.Background(), "Springfield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range data {
+		if d.Error != nil {
+			t.Errorf("%s: unexpected error: %v", d.Source, d.Error)
+		}
+	}
+	if coords.lat != 39.8 || coords.lon != -89.65 {
+		t.Errorf("coordinate source got %.2f, %.2f; want 39.80, -89.65", coords.lat, coords.lon)
+	}
+	if !strings.Contains(gotQuery, "lat=39.8&lon=-89.65") || strings.Contains(gotQuery, "q=") {
+		t.Errorf("name-based query = %q, want lat/lon instead of city name", gotQuery)
+	}
+	if q := locationQuery(agg.withConfig(context.Background()), "Springfield"); q != "39.8,-89.65" {
+		t.Errorf("locationQuery = %q, want %q", q, "39.8,-89.65")
+	}
+}
+
+// springfieldGeocoding is a trimmed recording of the Open-Meteo geocoding response for "Springfield".
+const springfieldGeocoding = `{"results":[
+	{"name":"Springfield","latitude":37.21533,"longitude":-93.29824,"country_code":"US","admin1":"Missouri","population":169176},
+	{"name":"Springfield","latitude":39.80172,"longitude":-89.64371,"country_code":"US","admin1":"Illinois","population":116250},
+	{"name":"Springfield","latitude":42.10148,"longitude":-72.58981,"country_code":"US","admin1":"Massachusetts","population":155929},
+	{"name":"Springfield","latitude":-27.65,"longitude":152.91667,"country_code":"AU","admin1":"Queensland","population":10000}
+]}`
+
+func TestGeocodePlaceDisambiguation(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		fmt.Fprint(w, springfieldGeocoding)
+	}))
+	defer srv.Close()
+	withGeocoders(t, &openMeteoGeocoder{baseURL: srv.URL})
+
+	tests := []struct {
+		name           string
+		country, admin string
+		wantAdmin      string
+		wantErr        bool
+	}{
+		{"most populous without filter", "", "", "Missouri", false},
+		{"country only", "au", "", "Queensland", false},
+		{"admin", "US", "illinois", "Illinois", false},
+		{"no match", "US", "Queensland", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := NewAggregator(nil, Options{Country: tt.country, Admin: tt.admin})
+			place, err := agg.Locate(context.Background(), "Springfield")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if place.Admin1 != tt.wantAdmin {
+				t.Errorf("admin1 = %q, want %q (place %s)", place.Admin1, tt.wantAdmin, place)
+			}
+			if tt.country != "" && !strings.Contains(gotQuery, "countryCode="+strings.ToUpper(tt.country)) {
+				t.Errorf("query %q is missing the country code", gotQuery)
+			}
+		})
+	}
+
+	place, _ := NewAggregator(nil, Options{Admin: "Illinois"}).Locate(context.Background(), "Springfield")
+	if got := place.String(); got != "Springfield, Illinois, US (39.8017, -89.6437) via Open-Meteo" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestGeocodeFailureShortCircuits(t *testing.T) {
+	var geoCalls atomic.Int32
+	geo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		geoCalls.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer geo.Close()
+	withGeocoders(t, &openMeteoGeocoder{baseURL: geo.URL})
+
+	owm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"weather":[{"id":800,"description":"clear sky"}],"main":{"temp":18}}`)
+	}))
+	defer owm.Close()
+
+	for _, sequential := range []bool{false, true} {
+		geoCalls.Store(0)
+		sources := []WeatherSource{&coordsSource{}, &coordsSource{}, &OpenWeatherSource{key: "k", baseURL: owm.URL}}
+		data, err := NewAggregator(sources, Options{Sequential: sequential}).Fetch(context.Background(), "Nowhere")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := geoCalls.Load(); n != 1 {
+			t.Errorf("sequential=%v: %d geocoding requests, want 1", sequential, n)
+		}
+		agg := Aggregate(data)
+		if agg.Valid != 1 || agg.AvgTemp != 18 {
+			t.Errorf("sequential=%v: valid=%d temp=%.1f, want the name-based source only", sequential, agg.Valid, agg.AvgTemp)
+		}
+		for _, d := range data {
+			if d.Source == "Coords" && (d.Error == nil || !strings.Contains(d.Error.Error(), "geocoding")) {
+				t.Errorf("sequential=%v: coordinate source error = %v, want the geocoding error", sequential, d.Error)
+			}
+		}
+	}
+}
+
+// countingGeocoder counts Geocode calls and fails when err is set.
+type countingGeocoder struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (g *countingGeocoder) Name() string { return "Counting" }
+func (g *countingGeocoder) Geocode(ctx context.Context, city string) (Place, error) {
+	g.calls.Add(1)
+	time.Sleep(5 * time.Millisecond) // let concurrent lookups overlap
+	if g.err != nil {
+		return Place{}, g.err
+	}
+	return Place{Name: city, Lat: 48.14, Lon: 11.58, Provider: g.Name()}, nil
+}
+
+// uncachedCoordsSource ignores the pre-geocoded map, like a source looking up coordinates itself.
+type uncachedCoordsSource struct{}
+
+func (uncachedCoordsSource) Name() string { return "Uncached" }
+func (uncachedCoordsSource) Fetch(ctx context.Context, city string, _ map[string][2]float64) WeatherData {
+	_, _, err := getCoordinates(ctx, city, nil)
+	return WeatherData{Source: "Uncached", Error: err}
+}
+
+func TestGeocodeOncePerRun(t *testing.T) {
+	for _, failing := range []bool{false, true} {
+		for _, sequential := range []bool{false, true} {
+			geo := &countingGeocoder{}
+			if failing {
+				geo.err = errors.New("geocoding failed")
+			}
+			withGeocoders(t, geo)
+			sources := []WeatherSource{&coordsSource{}, &coordsSource{}, &coordsSource{},
+				uncachedCoordsSource{}, uncachedCoordsSource{}, uncachedCoordsSource{}}
+			data, err := NewAggregator(sources, Options{Sequential: sequential}).Fetch(context.Background(), "Munich")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := geo.calls.Load(); n != 1 {
+				t.Errorf("failing=%v sequential=%v: %d geocode calls for six sources, want 1", failing, sequential, n)
+			}
+			for _, d := range data {
+				if (d.Error != nil) != failing {
+					t.Errorf("failing=%v sequential=%v: %s error = %v", failing, sequential, d.Source, d.Error)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkGeocodeCalls reports geocode calls per sequential run of six coordinate sources,
+// three of which ignore the pre-geocoded map: "per-source" without the run's geocodeOnce
+// (each of those re-geocodes), "shared" with it (the pre-geocode is reused).
+func BenchmarkGeocodeCalls(b *testing.B) {
+	sources := []WeatherSource{&coordsSource{}, &coordsSource{}, &coordsSource{},
+		uncachedCoordsSource{}, uncachedCoordsSource{}, uncachedCoordsSource{}}
+	for _, bc := range []struct {
+		name   string
+		shared bool
+	}{{"per-source", false}, {"shared", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			geo := &countingGeocoder{}
+			orig := geocoders
+			geocoders = []geocoder{geo}
+			defer func() { geocoders = orig }()
+			for i := 0; i < b.N; i++ {
+				cfg := requestConfig{client: DefaultClient, logger: discardLogger}
+				if bc.shared {
+					cfg.geocodes = &geocodeOnce{}
+				}
+				ctx := context.WithValue(context.Background(), requestConfigKey{}, cfg)
+				fetchSequential(ctx, "Munich", sources, Options{Sequential: true})
+			}
+			b.ReportMetric(float64(geo.calls.Load())/float64(b.N), "geocodes/op")
+		})
+	}
+}
+
+func TestGeocoderFallback(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer primary.Close()
+	var userAgent string
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		fmt.Fprint(w, `[{"name":"Tórshavn","lat":"62.0107","lon":"-6.7741","address":{"state":"Streymoy","country_code":"fo"}}]`)
+	}))
+	defer fallback.Close()
+
+	nominatim := &nominatimGeocoder{baseURL: fallback.URL, interval: 50 * time.Millisecond}
+	withGeocoders(t, &openMeteoGeocoder{baseURL: primary.URL}, nominatim)
+
+	place, err := NewAggregator(nil, Options{}).Locate(context.Background(), "Tórshavn")
+	if err != nil {
+		t.Fatalf("Locate failed: %v", err)
+	}
+	if place.Provider != "Nominatim" || place.CountryCode != "FO" || place.Lat != 62.0107 || place.Lon != -6.7741 {
+		t.Errorf("place = %+v, want Tórshavn via Nominatim", place)
+	}
+	if !strings.Contains(userAgent, "weather-aggregator") {
+		t.Errorf("User-Agent = %q, want a descriptive one", userAgent)
+	}
+
+	// The second lookup has to wait for the rate limit
+	start := time.Now()
+	if _, err := nominatim.Geocode(context.Background(), "Tórshavn"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("second request after %v, want rate limited to 50ms", elapsed)
+	}
+
+	// Both geocoders failing reports both errors
+	withGeocoders(t, &openMeteoGeocoder{baseURL: primary.URL}, &openMeteoGeocoder{baseURL: primary.URL})
+	if _, err := geocodePlace(context.Background(), "Atlantis"); err == nil || strings.Count(err.Error(), "not found") != 2 {
+		t.Errorf("error = %v, want one per geocoder", err)
+	}
+}
+
+func TestGeocodeNullIsland(t *testing.T) {
+	geo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"results":[{"name":"Xyzzy","latitude":0,"longitude":0,"country_code":"XX"}]}`)
+	}))
+	defer geo.Close()
+	withGeocoders(t, &openMeteoGeocoder{baseURL: geo.URL})
+
+	data, err := NewAggregator([]WeatherSource{&coordsSource{}}, Options{}).Fetch(context.Background(), "Xyzzy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data[0].Error; !errors.Is(err, ErrCityNotFound) || !strings.Contains(err.Error(), "implausible") {
+		t.Errorf("error = %v, want city not found for 0,0", err)
+	}
+
+	// an explicit location of 0,0 is taken as is
+	data, err = NewAggregator([]WeatherSource{&coordsSource{}}, Options{Location: &[2]float64{0, 0}}).Fetch(context.Background(), "Xyzzy")
+	if err != nil || data[0].Error != nil {
+		t.Errorf("fixed 0,0: %v %v, want no error", err, data[0].Error)
+	}
+
+	for _, c := range [][2]float64{{0, 0}, {math.NaN(), 10}, {10, math.NaN()}, {91, 0}, {0, -181}} {
+		if plausibleCoords(c[0], c[1]) {
+			t.Errorf("%v accepted", c)
+		}
+	}
+	for _, c := range [][2]float64{{0, 10}, {5.6, 0}, {-90, 180}} {
+		if !plausibleCoords(c[0], c[1]) {
+			t.Errorf("%v rejected", c)
+		}
+	}
+}
+
+func TestLocateIP(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	orig := ipLocateURL
+	ipLocateURL = srv.URL
+	t.Cleanup(func() { ipLocateURL = orig })
+
+	body = `{"status":"success","city":"Springfield","regionName":"Illinois","countryCode":"US","lat":39.80,"lon":-89.64}`
+	p, err := NewAggregator(nil, Options{}).LocateIP(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Place{Name: "Springfield", Admin1: "Illinois", CountryCode: "US", Lat: 39.80, Lon: -89.64, Provider: "ip-api.com"}); p != want {
+		t.Errorf("place = %+v, want %+v", p, want)
+	}
+
+	for _, failing := range []string{
+		`{"status":"fail","message":"private range"}`,
+		`{"status":"success","city":"","lat":0,"lon":0}`,
+		`{"status":"success","city":"Nowhere","lat":0,"lon":0}`,
+		`<html>`,
+	} {
+		body = failing
+		if p, err := NewAggregator(nil, Options{}).LocateIP(context.Background()); err == nil {
+			t.Errorf("%s: place = %+v, want an error", failing, p)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewAggregator(nil, Options{}).LocateIP(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: error = %v, want context.Canceled", err)
+	}
+}
+
+func TestAggregatorStream(t *testing.T) {
+	sources := []WeatherSource{
+		&mockSlowSource{name: "Slow", delay: 300 * time.Millisecond},
+		&mockSource{name: "Fast", temp: 12},
+	}
+	agg := NewAggregator(sources, Options{Location: &[2]float64{0, 0}})
+
+	start := time.Now()
+	ch, err := agg.Stream(context.Background(), "TestCity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-ch
+	if first.Source != "Fast" || time.Since(start) > 200*time.Millisecond {
+		t.Errorf("first result %q after %v, want Fast right away", first.Source, time.Since(start))
+	}
+	var rest []WeatherData
+	for d := range ch {
+		rest = append(rest, d)
+	}
+	if len(rest) != 1 || rest[0].Source != "Slow" {
+		t.Errorf("remaining results = %+v, want only Slow before close", rest)
+	}
+
+	if _, err := NewAggregator(nil, Options{}).Stream(context.Background(), "TestCity"); !errors.Is(err, ErrNoSources) {
+		t.Errorf("error = %v, want ErrNoSources", err)
+	}
+}
+
+func TestFetchCoords(t *testing.T) {
+	var lookups int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		fmt.Fprint(w, `{"results":[{"name":"Berlin","latitude":52.52,"longitude":13.41,"country_code":"DE"}]}`)
+	}))
+	defer srv.Close()
+	withGeocoders(t, &openMeteoGeocoder{baseURL: srv.URL})
+	sources := []WeatherSource{&mockSource{name: "A", temp: 10}}
+
+	data, coords, err := NewAggregator(sources, Options{}).FetchCoords(context.Background(), "Berlin")
+	if err != nil || len(data) != 1 {
+		t.Fatalf("data = %+v, err = %v", data, err)
+	}
+	if coords == nil || *coords != [2]float64{52.52, 13.41} || lookups != 1 {
+		t.Errorf("coords = %v after %d lookups, want 52.52, 13.41 after one", coords, lookups)
+	}
+
+	fixed := &[2]float64{1, 2}
+	if _, coords, _ := NewAggregator(sources, Options{Location: fixed}).FetchCoords(context.Background(), "Berlin"); coords == nil || *coords != *fixed {
+		t.Errorf("fixed location: coords = %v, want %v", coords, *fixed)
+	}
+	if lookups != 1 {
+		t.Errorf("fixed location geocoded: %d lookups", lookups)
+	}
+}
+
+func TestFetchLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	sources := []WeatherSource{&mockSource{name: "Good", temp: 10}, &mockSource{name: "Bad", hasErr: true}}
+	agg := NewAggregator(sources, Options{Location: &[2]float64{1, 2}, Logger: logger})
+	if _, err := agg.Fetch(context.Background(), "TestCity"); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`msg="using fixed location" city=TestCity lat=1 lon=2`,
+		`level=DEBUG msg="fetch started" source=Good city=TestCity`,
+		`level=DEBUG msg="fetch finished" source=Good city=TestCity`,
+		`level=INFO msg="fetch failed" source=Bad city=TestCity`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log missing %q:\n%s", want, out)
+		}
+	}
+
+	// Without a logger nothing is written and nothing panics
+	if _, err := NewAggregator(sources, Options{Location: &[2]float64{1, 2}}).Fetch(context.Background(), "TestCity"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSanitizeURL(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"https://api.weatherapi.com/v1/forecast.json?key=s3cr3t&q=Berlin", "https://api.weatherapi.com/v1/forecast.json?key=REDACTED&q=Berlin"},
+		{"https://api.tomorrow.io/v4/weather/realtime?location=1,2&apikey=s3cr3t", "https://api.tomorrow.io/v4/weather/realtime?apikey=REDACTED&location=1%2C2"},
+		{"https://api.openweathermap.org/data/2.5/weather?q=Rome&APPID=s3cr3t", "https://api.openweathermap.org/data/2.5/weather?APPID=REDACTED&q=Rome"},
+		{"http://api.weatherstack.com/current?access_key=s3cr3t&query=Oslo", "http://api.weatherstack.com/current?access_key=REDACTED&query=Oslo"},
+		{"https://api.pirateweather.net/forecast/s3cr3t/52.5200,13.4100?units=si", "https://api.pirateweather.net/forecast/REDACTED/52.5200,13.4100?units=si"},
+		{"http://mirror.local/pw/forecast/s3cr3t/1,2?units=si", "http://mirror.local/pw/forecast/REDACTED/1,2?units=si"},
+		{"https://api.open-meteo.com/v1/forecast?latitude=1&longitude=2", "https://api.open-meteo.com/v1/forecast?latitude=1&longitude=2"},
+		{"https://example.com/%zz?key=s3cr3t", "<invalid URL>"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeURL(tt.in); got != tt.want {
+			t.Errorf("sanitizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestErrorsHideAPIKeys(t *testing.T) {
+	const key = "s3cr3t-api-key"
+	// A closed server makes every request fail with a *url.Error carrying the request URL
+	srv := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(srv.URL)
+	srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	sources := []WeatherSource{&TomorrowIOSource{apiKey: key}, &WeatherAPISource{key: key}, &MeteosourceSource{key: key},
+		&PirateWeatherSource{key: key}, &OpenWeatherSource{key: key}}
+	agg := NewAggregator(sources, Options{Location: &[2]float64{52.52, 13.41}, Logger: logger})
+	agg.Client = &http.Client{Transport: rewriteTransport{target}}
+	data, err := agg.Fetch(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range data {
+		if d.Error == nil {
+			t.Fatalf("%s: expected a connection error", d.Source)
+		}
+		if msg := d.Error.Error(); strings.Contains(msg, key) || !strings.Contains(msg, redacted) {
+			t.Errorf("%s error leaks the API key or lost the URL: %s", d.Source, msg)
+		}
+	}
+	if strings.Contains(buf.String(), key) {
+		t.Errorf("log leaks the API key:\n%s", buf.String())
+	}
+
+	if _, err := doGet(context.Background(), "https://example.com/%zz?key="+key); err == nil || strings.Contains(err.Error(), key) {
+		t.Errorf("invalid URL error = %v, want one without the key", err)
+	}
+}